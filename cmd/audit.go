@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Values of the --fail-on flag of the audit subcommand.
+const (
+	auditFailOnError   = "error"
+	auditFailOnWarning = "warning"
+	auditFailOnNever   = "never"
+)
+
+var auditConfig struct {
+	output string
+	failOn string
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report misconfigurations of autoresize in the cluster",
+	Long: `Audit the StorageClasses and the PVCs in the cluster, and report the misconfigurations which ` +
+		`prevent or will prevent resizing, such as StorageClasses not allowing volume expansion, invalid ` +
+		`annotations and PVCs approaching their storage limits.
+
+The command exits with a non-zero status if any finding of the severity specified by --fail-on is found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return audit(cmd)
+	},
+}
+
+func init() {
+	fs := auditCmd.Flags()
+	fs.StringSliceVar(&config.namespaces, "namespaces", []string{},
+		"Namespaces to audit PersistentVolumeClaims within. Empty for all namespaces.")
+	fs.StringVar(&config.namespaceSelector, "namespace-selector", "",
+		"Label selector of the namespaces to audit PersistentVolumeClaims within. Empty for all namespaces.")
+	fs.StringVar(&config.namespaceExcludeSelector, "namespace-exclude-selector", "",
+		"Label selector of the namespaces to exclude from the audit. Empty to exclude none.")
+	fs.StringSliceVar(&config.excludeNamespaces, "exclude-namespaces", []string{},
+		"Namespaces to exclude from the audit.")
+	fs.StringVar(&config.prometheusURL, "prometheus-url", "",
+		"Prometheus URL to query volume stats. The volume usage is not checked if neither this nor "+
+			"--use-k8s-metrics-api is given.")
+	fs.BoolVar(&config.useK8sMetricsApi, "use-k8s-metrics-api", false, "Use Kubernetes metrics API instead of Prometheus")
+	fs.BoolVar(&config.skipAnnotation, "no-annotation-check", false, "Skip annotation check for StorageClass")
+	fs.StringSliceVar(&config.limitWarningPercentages, "limit-warning-percentages", []string{},
+		"Percentages of the storage limit used by the capacity of a PVC to warn at, e.g. 80%,95%")
+	fs.IntVar(&config.limitWarningResizes, "limit-warning-resizes-remaining", 0,
+		"Warn when the estimated number of the resizes remaining until the storage limit is this or less. "+
+			"Set 0 to disable.")
+	fs.StringVar(&config.defaultThreshold, "default-threshold", pvcautoresizer.DefaultThreshold,
+		"Threshold of the free space of the PVCs without the "+pvcautoresizer.ResizeThresholdAnnotation+" annotation")
+	fs.StringVar(&config.defaultInodesThreshold, "default-inodes-threshold", pvcautoresizer.DefaultInodesThreshold,
+		"Threshold of the free inodes of the PVCs without the "+pvcautoresizer.ResizeInodesThresholdAnnotation+
+			" annotation")
+	fs.StringVar(&config.defaultIncrease, "default-increase", pvcautoresizer.DefaultIncrease,
+		"Amount to increase the PVCs without the "+pvcautoresizer.ResizeIncreaseAnnotation+" annotation by")
+	fs.StringVarP(&auditConfig.output, "output", "o", "table", "Output format: table, json or yaml")
+	fs.StringVar(&auditConfig.failOn, "fail-on", auditFailOnError,
+		"Severity of the findings to exit with a non-zero status for: error, warning or never")
+	if f := flag.CommandLine.Lookup("kubeconfig"); f != nil {
+		fs.AddGoFlag(f)
+	}
+
+	rootCmd.AddCommand(auditCmd)
+}
+
+func audit(cmd *cobra.Command) error {
+	switch auditConfig.failOn {
+	case auditFailOnError, auditFailOnWarning, auditFailOnNever:
+	default:
+		return fmt.Errorf("unknown severity %q: must be error, warning or never", auditConfig.failOn)
+	}
+	limitWarning, err := config.limitWarningOptions()
+	if err != nil {
+		return err
+	}
+	namespaceFilter, err := config.namespaceFilter()
+	if err != nil {
+		return err
+	}
+	defaults, err := config.resizeDefaults()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	var metricsClient runners.MetricsClient
+	if config.useK8sMetricsApi {
+		metricsClient, err = runners.NewK8sMetricsApiClientForConfig(cfg)
+	} else if config.prometheusURL != "" {
+		metricsClient, err = runners.NewPrometheusClient(config.prometheusURL)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to initialize metrics client: %w", err)
+	}
+
+	report, err := runners.Audit(cmd.Context(), c, metricsClient, runners.AuditOptions{
+		Namespaces:          config.namespaces,
+		NamespaceFilter:     namespaceFilter,
+		SkipAnnotationCheck: config.skipAnnotation,
+		LimitWarning:        limitWarning,
+		Defaults:            defaults,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	switch auditConfig.output {
+	case "table":
+		err = printAudit(out, report)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "yaml":
+		var data []byte
+		data, err = yaml.Marshal(report)
+		if err == nil {
+			_, err = out.Write(data)
+		}
+	default:
+		return fmt.Errorf("unknown output format %q: must be table, json or yaml", auditConfig.output)
+	}
+	if err != nil {
+		return err
+	}
+
+	errors, warnings := report.Count(runners.AuditSeverityError), report.Count(runners.AuditSeverityWarning)
+	switch {
+	case auditConfig.failOn == auditFailOnNever:
+	case errors > 0:
+		return fmt.Errorf("%d error(s) and %d warning(s) found", errors, warnings)
+	case auditConfig.failOn == auditFailOnWarning && warnings > 0:
+		return fmt.Errorf("%d warning(s) found", warnings)
+	}
+	return nil
+}
+
+func printAudit(out io.Writer, report *runners.AuditReport) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "STORAGECLASS\tENABLED\tEXPANSION")
+	for _, sc := range report.StorageClasses {
+		fmt.Fprintf(w, "%s\t%t\t%t\n", sc.Name, sc.Enabled, sc.AllowVolumeExpansion)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSTORAGECLASS\tENABLED\tCAPACITY\tLIMIT\tVOLUME USED\tLIMIT USED")
+	for _, pvc := range report.PVCs {
+		volumeUsed := "-"
+		if pvc.VolumeUsedRatio != nil {
+			volumeUsed = fmt.Sprintf("%.0f%%", *pvc.VolumeUsedRatio*100)
+		}
+		limit, limitUsed := "-", "-"
+		if !pvc.Limit.IsZero() {
+			limit = pvc.Limit.String()
+			limitUsed = fmt.Sprintf("%.0f%%", pvc.LimitUsedRatio*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n", pvc.Namespace, pvc.Name, pvc.StorageClass,
+			pvc.Enabled, pvc.Capacity.String(), limit, volumeUsed, limitUsed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	var findings []string
+	for _, sc := range report.StorageClasses {
+		for _, f := range sc.Findings {
+			findings = append(findings, fmt.Sprintf("%-7s storageclass/%s: %s (%s)", f.Severity, sc.Name, f.Message, f.Reason))
+		}
+	}
+	for _, pvc := range report.PVCs {
+		for _, f := range pvc.Findings {
+			findings = append(findings, fmt.Sprintf("%-7s %s/%s: %s (%s)", f.Severity, pvc.Namespace, pvc.Name,
+				f.Message, f.Reason))
+		}
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "No misconfigurations found.")
+		return nil
+	}
+	fmt.Fprintln(out, strings.Join(findings, "\n"))
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"sigs.k8s.io/yaml"
+)
+
+// reloadableFlags are the flags whose changes in the config file are applied without a restart.
+var reloadableFlags = map[string]bool{
+	"interval":                            true,
+	"namespace-selector":                  true,
+	"namespace-exclude-selector":          true,
+	"exclude-namespaces":                  true,
+	"prometheus-url":                      true,
+	"use-k8s-metrics-api":                 true,
+	"metrics-reset-size-threshold":        true,
+	"quota-bump-annotation":               true,
+	"check-backend-capacity":              true,
+	"resize-timeout":                      true,
+	"recover-expansion-failure":           true,
+	"offline-resize":                      true,
+	"offline-stats-lookback":              true,
+	"max-bytes-per-hour":                  true,
+	"max-bytes-per-hour-per-namespace":    true,
+	"max-bytes-per-hour-per-storageclass": true,
+	"max-resizes-per-pvc-per-day":         true,
+	"circuit-breaker-cooldown":            true,
+	"failure-backoff-base":                true,
+	"failure-backoff-max":                 true,
+	"max-consecutive-failures":            true,
+	"limit-warning-percentages":           true,
+	"limit-warning-resizes-remaining":     true,
+	"limit-warning-webhook-url":           true,
+	"default-threshold":                   true,
+	"default-inodes-threshold":            true,
+	"default-increase":                    true,
+}
+
+// applyConfigFile sets the values in the YAML config file to the flags which are not given on the
+// command line. The keys of the file are the names of the flags.
+func applyConfigFile(fs *pflag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("config file %s must be a map of the settings: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown setting %q in config file %s", name, path)
+		}
+		if f.Changed {
+			continue
+		}
+		if err := setFlag(f, values[name]); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+func setFlag(f *pflag.Flag, val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		sv, ok := f.Value.(pflag.SliceValue)
+		if !ok {
+			return errors.New("must not be a list")
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalarString(item)
+			if err != nil {
+				return err
+			}
+			items = append(items, s)
+		}
+		return sv.Replace(items)
+	case map[string]interface{}:
+		if f.Value.Type() != "stringToString" {
+			return errors.New("must not be a map")
+		}
+		if len(v) == 0 {
+			return nil
+		}
+		pairs := make([]string, 0, len(v))
+		for key, item := range v {
+			s, err := scalarString(item)
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, key+"="+s)
+		}
+		sort.Strings(pairs)
+		// The value of stringToString is parsed as a CSV record.
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(pairs); err != nil {
+			return err
+		}
+		w.Flush()
+		return f.Value.Set(strings.TrimSuffix(buf.String(), "\n"))
+	}
+	s, err := scalarString(val)
+	if err != nil {
+		return err
+	}
+	return f.Value.Set(s)
+}
+
+func scalarString(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("must be a scalar value: %v", val)
+}
+
+// loadOptions parses the command line arguments and the config file into new options.
+func loadOptions(args []string) (*options, *pflag.FlagSet, error) {
+	c := &options{}
+	fs := pflag.NewFlagSet("pvc-autoresizer", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if c.configFile != "" {
+		if err := applyConfigFile(fs, c.configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c, fs, nil
+}
+
+// configReloader watches the config file, and passes the reloadable settings to pvcAutoresizer
+// when the file is changed. Changes of the other settings are only logged since they require a
+// restart.
+type configReloader struct {
+	args      []string
+	path      string
+	effective *effectiveConfig
+	reloads   chan runners.Reload
+	log       logr.Logger
+}
+
+func newConfigReloader(args []string, path string, effective *effectiveConfig, log logr.Logger) *configReloader {
+	return &configReloader{
+		args:      args,
+		path:      path,
+		effective: effective,
+		reloads:   make(chan runners.Reload, 1),
+		log:       log,
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. The config file is reloaded on all
+// the replicas, so that /debug/config is up to date and the leader elected later uses it.
+func (r *configReloader) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (r *configReloader) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// Watch the directory since a ConfigMap volume is updated by replacing the symlink to the
+	// directory of the files, and editors often replace the file.
+	if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	last, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			r.log.Error(err, "failed to watch config file")
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			data, err := os.ReadFile(r.path)
+			if err != nil {
+				r.log.Error(err, "failed to read config file")
+				continue
+			}
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			r.reload()
+		}
+	}
+}
+
+func (r *configReloader) reload() {
+	c, fs, err := loadOptions(r.args)
+	if err != nil {
+		r.log.Error(err, "invalid config file, keeping the current settings")
+		return
+	}
+	mc, opts, err := c.build()
+	if err != nil {
+		r.log.Error(err, "invalid config file, keeping the current settings")
+		return
+	}
+
+	current := r.effective.get()
+	values := flagValues(fs)
+	for name, val := range values {
+		if val == current[name] || reloadableFlags[name] {
+			continue
+		}
+		r.log.Info("change of the setting requires a restart", "name", name, "current", current[name], "new", val)
+		values[name] = current[name]
+	}
+
+	// Replace the reload not received yet, e.g. since this replica is not the leader.
+	select {
+	case <-r.reloads:
+	default:
+	}
+	r.reloads <- runners.Reload{MetricsClient: mc, Options: opts}
+	r.effective.set(values)
+	r.log.Info("config file reloaded", "config", values)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestFlagSet(t *testing.T, args ...string) (*options, *pflag.FlagSet) {
+	t.Helper()
+	c := &options{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	c.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return c, fs
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	testCases := []struct {
+		description string
+		content     string
+		expected    map[string]string
+		expectErr   string
+	}{
+		{
+			description: "scalars",
+			content: `interval: 5m
+prometheus-url: http://prometheus:9090
+offline-resize: true
+max-consecutive-failures: 3
+`,
+			expected: map[string]string{
+				"interval":                 "5m0s",
+				"prometheus-url":           "http://prometheus:9090",
+				"offline-resize":           "true",
+				"max-consecutive-failures": "3",
+			},
+		},
+		{
+			description: "list and map",
+			content: `exclude-namespaces: [kube-system, kube-public]
+alert-labels:
+  cluster: prod
+`,
+			expected: map[string]string{
+				"exclude-namespaces": "[kube-system,kube-public]",
+				"alert-labels":       "[cluster=prod]",
+			},
+		},
+		{
+			description: "null is ignored",
+			content:     "interval: null\n",
+			expected:    map[string]string{"interval": "1m0s"},
+		},
+		{description: "empty", content: "", expected: map[string]string{"interval": "1m0s"}},
+		{description: "unknown setting", content: "unknown: 1\n", expectErr: `unknown setting "unknown"`},
+		{description: "config itself", content: "config: other.yaml\n", expectErr: `unknown setting "config"`},
+		{description: "not a map", content: "- interval\n", expectErr: "must be a map of the settings"},
+		{description: "invalid value", content: "interval: soon\n", expectErr: "invalid interval"},
+		{description: "list to a scalar", content: "interval: [1m]\n", expectErr: "must not be a list"},
+		{description: "map to a scalar", content: "interval: {a: b}\n", expectErr: "must not be a map"},
+		{description: "nested list", content: "exclude-namespaces: [[a]]\n", expectErr: "must be a scalar value"},
+	}
+	for _, tc := range testCases {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		writeConfigFile(t, path, tc.content)
+		_, fs := newTestFlagSet(t)
+
+		err := applyConfigFile(fs, path)
+		if tc.expectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+				t.Errorf("%s: error should contain %q: %v", tc.description, tc.expectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: applyConfigFile failed: %v", tc.description, err)
+			continue
+		}
+		for name, val := range tc.expected {
+			if actual := fs.Lookup(name).Value.String(); actual != val {
+				t.Errorf("%s: %s = %q, expected %q", tc.description, name, actual, val)
+			}
+		}
+	}
+
+	_, fs := newTestFlagSet(t)
+	if err := applyConfigFile(fs, filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing config file should be an error")
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		val      interface{}
+		expected interface{}
+	}{
+		{name: "prometheus-url", val: "http://prometheus:9090", expected: "http://prometheus:9090"},
+		{name: "offline-resize", val: true, expected: true},
+		{name: "exclude-namespaces", val: []interface{}{"a", "b"}, expected: []string{"a", "b"}},
+		{name: "exclude-namespaces", val: []interface{}{}, expected: []string{}},
+		{
+			name: "alert-labels",
+			val:  map[string]interface{}{"cluster": "prod", "region": "us-east-1"},
+			expected: map[string]string{
+				"cluster": "prod",
+				"region":  "us-east-1",
+			},
+		},
+		{
+			// The values are encoded as a CSV record, so commas and quotes are kept.
+			name: "alert-labels",
+			val: map[string]interface{}{
+				"hosts": "a,b",
+				"note":  `say "hi"`,
+				"empty": "",
+			},
+			expected: map[string]string{
+				"hosts": "a,b",
+				"note":  `say "hi"`,
+				"empty": "",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		_, fs := newTestFlagSet(t)
+		if err := setFlag(fs.Lookup(tc.name), tc.val); err != nil {
+			t.Errorf("setFlag(%s, %v) failed: %v", tc.name, tc.val, err)
+			continue
+		}
+		var actual interface{}
+		var err error
+		switch tc.expected.(type) {
+		case string:
+			actual, err = fs.GetString(tc.name)
+		case bool:
+			actual, err = fs.GetBool(tc.name)
+		case []string:
+			actual, err = fs.GetStringSlice(tc.name)
+		case map[string]string:
+			actual, err = fs.GetStringToString(tc.name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("setFlag(%s, %v): %v, expected %v", tc.name, tc.val, actual, tc.expected)
+		}
+	}
+}
+
+func TestLoadOptionsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `interval: 2m
+namespace-selector: team=a
+alert-labels:
+  cluster: file
+`)
+
+	c, _, err := loadOptions([]string{"--config", path, "--interval", "3m", "--alert-labels", "cluster=flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command line takes precedence over the config file, which takes precedence over the defaults.
+	if c.watchInterval != 3*time.Minute {
+		t.Errorf("interval given on the command line is not used: %s", c.watchInterval)
+	}
+	if !reflect.DeepEqual(c.alertLabels, map[string]string{"cluster": "flag"}) {
+		t.Errorf("alert labels given on the command line are not used: %v", c.alertLabels)
+	}
+	if c.namespaceSelector != "team=a" {
+		t.Errorf("namespace selector in the config file is not used: %s", c.namespaceSelector)
+	}
+	if c.healthAddr != ":8081" {
+		t.Errorf("default health address is not used: %s", c.healthAddr)
+	}
+
+	if _, _, err := loadOptions([]string{"--unknown"}); err == nil {
+		t.Error("unknown flag should be an error")
+	}
+}
+
+func newTestReloader(t *testing.T, path string) *configReloader {
+	t.Helper()
+	args := []string{"--config", path, "--prometheus-url", "http://prometheus:9090"}
+	_, fs, err := loadOptions(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newConfigReloader(args, path, newEffectiveConfig(fs), logr.Discard())
+}
+
+func TestConfigReloaderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "interval: 1m\nhealth-addr: :8081\n")
+	r := newTestReloader(t, path)
+
+	// The change of health-addr requires a restart, so only the interval is applied.
+	writeConfigFile(t, path, "interval: 2m\nhealth-addr: :9091\n")
+	r.reload()
+	var reload runners.Reload
+	select {
+	case reload = <-r.reloads:
+	default:
+		t.Fatal("config file is not reloaded")
+	}
+	if reload.Options.Interval != 2*time.Minute {
+		t.Errorf("interval is not reloaded: %s", reload.Options.Interval)
+	}
+	effective := r.effective.get()
+	if effective["interval"] != "2m0s" || effective["health-addr"] != ":8081" {
+		t.Errorf("unexpected effective config: interval=%s, health-addr=%s",
+			effective["interval"], effective["health-addr"])
+	}
+
+	// Invalid config files keep the current settings.
+	for _, content := range []string{"interval: soon\n", "interval: -1m\n", "default-threshold: 200%\n"} {
+		writeConfigFile(t, path, content)
+		r.reload()
+		select {
+		case reload := <-r.reloads:
+			t.Errorf("invalid config file %q is reloaded: %+v", content, reload.Options)
+		default:
+		}
+		if interval := r.effective.get()["interval"]; interval != "2m0s" {
+			t.Errorf("effective config is changed by the invalid config file %q: interval=%s", content, interval)
+		}
+	}
+}
+
+func TestConfigReloaderSymlinkSwap(t *testing.T) {
+	// The files of a ConfigMap volume are symlinks to ..data, which is a symlink to the directory
+	// of the current files. It is replaced by renaming a new symlink on update.
+	dir := t.TempDir()
+	writeVersion := func(version, content string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeConfigFile(t, filepath.Join(dir, version, "config.yaml"), content)
+		if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeVersion("..v1", "interval: 1m\n")
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestReloader(t, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+	// Wait for the watcher to be set up.
+	time.Sleep(200 * time.Millisecond)
+
+	writeVersion("..v2", "interval: 2m\n")
+	select {
+	case reload := <-r.reloads:
+		if reload.Options.Interval != 2*time.Minute {
+			t.Errorf("interval is not reloaded: %s", reload.Options.Interval)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config file is not reloaded after the symlink is swapped")
+	}
+}
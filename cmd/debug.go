@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/spf13/pflag"
+)
+
+// effectiveConfig holds the configuration in effect, i.e. the values of all the flags including the
+// defaults and the values of the config file. It serves them at /debug/config. The passwords and
+// the query values in URLs are redacted.
+type effectiveConfig struct {
+	values atomic.Pointer[map[string]string]
+}
+
+func newEffectiveConfig(fs *pflag.FlagSet) *effectiveConfig {
+	e := &effectiveConfig{}
+	e.set(flagValues(fs))
+	return e
+}
+
+func (e *effectiveConfig) get() map[string]string {
+	return *e.values.Load()
+}
+
+func (e *effectiveConfig) set(values map[string]string) {
+	e.values.Store(&values)
+}
+
+// ServeHTTP implements http.Handler.
+func (e *effectiveConfig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(e.get())
+}
+
+func flagValues(fs *pflag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *pflag.Flag) {
+		values[f.Name] = redactURL(f.Value.String())
+	})
+	return values
+}
+
+// redactURL redacts the password and the query values of the URL, which may hold credentials such
+// as API keys.
+func redactURL(val string) string {
+	u, err := url.Parse(val)
+	if err != nil || u.Scheme == "" || (u.User == nil && u.RawQuery == "") {
+		return val
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{"xxxxx"}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
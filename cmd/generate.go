@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"github.com/topolvm/pvc-autoresizer/internal/monitoring"
+)
+
+var generateConfig struct {
+	outputDir          string
+	metricsAggregation string
+	ruleName           string
+	ruleNamespace      string
+	ruleLabels         map[string]string
+}
+
+// File names of the generated monitoring configurations.
+const (
+	prometheusRuleFile   = "prometheusrule.yaml"
+	grafanaDashboardFile = "grafana-dashboard.json"
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate configurations for pvc-autoresizer",
+}
+
+var generateMonitoringCmd = &cobra.Command{
+	Use:   "monitoring",
+	Short: "Generate a PrometheusRule and a Grafana dashboard for the metrics",
+	Long: `Generate a PrometheusRule with the recording and alerting rules, and a Grafana dashboard ` +
+		`from the metrics exported by this version of pvc-autoresizer.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return generateMonitoring(cmd)
+	},
+}
+
+func init() {
+	fs := generateMonitoringCmd.Flags()
+	fs.StringVarP(&generateConfig.outputDir, "output-dir", "o", ".",
+		"Directory to write "+prometheusRuleFile+" and "+grafanaDashboardFile+" to")
+	fs.StringVar(&generateConfig.metricsAggregation, "metrics-aggregation", metrics.AggregationPVC,
+		"Level which the per-PVC counters are aggregated to. Specify the same value as the controller.")
+	fs.StringVar(&generateConfig.ruleName, "rule-name", "pvc-autoresizer", "Name of the PrometheusRule")
+	fs.StringVar(&generateConfig.ruleNamespace, "rule-namespace", "", "Namespace of the PrometheusRule")
+	fs.StringToStringVar(&generateConfig.ruleLabels, "rule-labels", map[string]string{},
+		"Labels of the PrometheusRule, e.g. release=prometheus")
+
+	generateCmd.AddCommand(generateMonitoringCmd)
+	rootCmd.AddCommand(generateCmd)
+}
+
+func generateMonitoring(cmd *cobra.Command) error {
+	err := metrics.ConfigureCardinality(metrics.CardinalityOptions{Aggregation: generateConfig.metricsAggregation})
+	if err != nil {
+		return err
+	}
+	defs, err := metrics.Definitions()
+	if err != nil {
+		return err
+	}
+
+	rule, err := monitoring.PrometheusRule(defs, monitoring.Options{
+		Name:      generateConfig.ruleName,
+		Namespace: generateConfig.ruleNamespace,
+		Labels:    generateConfig.ruleLabels,
+	})
+	if err != nil {
+		return err
+	}
+	dashboard, err := monitoring.Dashboard(defs)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(generateConfig.outputDir, 0755); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{prometheusRuleFile, rule},
+		{grafanaDashboardFile, dashboard},
+	} {
+		path := filepath.Join(generateConfig.outputDir, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), path)
+	}
+	return nil
+}
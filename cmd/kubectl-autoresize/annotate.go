@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var enableConfig struct {
+	storageLimit    string
+	threshold       string
+	inodesThreshold string
+	increase        string
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable (PVC | storageclass/NAME)",
+	Short: "Enable the autoresize of the PVC or the StorageClass",
+	Long: `Enable the autoresize of the PVC by annotating it with the storage limit and ` +
+		pvcautoresizer.AutoResizeEnabledKey + `=true, which overrides its StorageClass, or of the PVCs of the ` +
+		`StorageClass by annotating it with ` + pvcautoresizer.AutoResizeEnabledKey + `=true.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAnnotate(cmd, args[0], true)
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable (PVC | storageclass/NAME)",
+	Short: "Disable the autoresize of the PVC or the StorageClass",
+	Long: `Disable the autoresize of the PVC by annotating it with ` + pvcautoresizer.AutoResizeEnabledKey +
+		`=false, which overrides its StorageClass, or of the PVCs of the StorageClass by removing the ` +
+		pvcautoresizer.AutoResizeEnabledKey + ` annotation.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAnnotate(cmd, args[0], false)
+	},
+}
+
+var setLimitCmd = &cobra.Command{
+	Use:   "set-limit PVC SIZE",
+	Short: "Set the storage limit of the PVC",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSetLimit(cmd, args[0], args[1])
+	},
+}
+
+func init() {
+	fs := enableCmd.Flags()
+	fs.StringVar(&enableConfig.storageLimit, "storage-limit", "",
+		"Storage limit of the PVC. Required unless the PVC already has one.")
+	fs.StringVar(&enableConfig.threshold, "threshold", "", "Threshold of the free space of the PVC, e.g. 20% or 5Gi")
+	fs.StringVar(&enableConfig.inodesThreshold, "inodes-threshold", "",
+		"Threshold of the free inodes of the PVC, e.g. 20%")
+	fs.StringVar(&enableConfig.increase, "increase", "", "Amount to increase the PVC by, e.g. 20% or 10Gi")
+
+	rootCmd.AddCommand(enableCmd)
+	rootCmd.AddCommand(disableCmd)
+	rootCmd.AddCommand(setLimitCmd)
+}
+
+// parseTarget parses the argument as "storageclass/NAME" or a PVC name with an optional
+// "pvc/" prefix. It returns true if the target is a StorageClass.
+func parseTarget(arg string) (string, bool, error) {
+	kind, name, found := strings.Cut(arg, "/")
+	if !found {
+		return arg, false, nil
+	}
+	switch strings.ToLower(kind) {
+	case "storageclass", "storageclasses", "sc":
+		return name, true, nil
+	case "persistentvolumeclaim", "persistentvolumeclaims", "pvc":
+		return name, false, nil
+	}
+	return "", false, fmt.Errorf("unsupported resource type %q: specify a PVC or storageclass/NAME", kind)
+}
+
+// patchAnnotations patches the annotations of the object with a merge patch. Empty values remove
+// the annotations.
+func patchAnnotations(ctx context.Context, c client.Client, obj client.Object, annotations map[string]string) error {
+	orig := obj.DeepCopyObject().(client.Object)
+	updated := obj.GetAnnotations()
+	if updated == nil {
+		updated = make(map[string]string)
+	}
+	for k, v := range annotations {
+		if v == "" {
+			delete(updated, k)
+		} else {
+			updated[k] = v
+		}
+	}
+	obj.SetAnnotations(updated)
+	return c.Patch(ctx, obj, client.MergeFrom(orig))
+}
+
+func runAnnotate(cmd *cobra.Command, arg string, enable bool) error {
+	name, isStorageClass, err := parseTarget(arg)
+	if err != nil {
+		return err
+	}
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	if isStorageClass {
+		return annotateStorageClass(cmd, c, name, enable)
+	}
+	var pvc corev1.PersistentVolumeClaim
+	if err := c.Get(cmd.Context(), types.NamespacedName{Namespace: c.namespace, Name: name}, &pvc); err != nil {
+		return err
+	}
+	if enable {
+		return enablePVC(cmd, c, &pvc)
+	}
+	return disablePVC(cmd, c, &pvc)
+}
+
+func annotateStorageClass(cmd *cobra.Command, c client.Client, name string, enable bool) error {
+	var sc storagev1.StorageClass
+	if err := c.Get(cmd.Context(), types.NamespacedName{Name: name}, &sc); err != nil {
+		return err
+	}
+	value := ""
+	if enable {
+		value = "true"
+		if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+			warn(cmd, "storageclass/%s does not allow volume expansion", name)
+		}
+	}
+	err := patchAnnotations(cmd.Context(), c, &sc, map[string]string{pvcautoresizer.AutoResizeEnabledKey: value})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "storageclass/%s %s\n", name, enabledString(enable))
+	return nil
+}
+
+func enablePVC(cmd *cobra.Command, c *kubeClient, pvc *corev1.PersistentVolumeClaim) error {
+	annotations := map[string]string{
+		pvcautoresizer.AutoResizeEnabledKey:            "true",
+		pvcautoresizer.StorageLimitAnnotation:          enableConfig.storageLimit,
+		pvcautoresizer.ResizeThresholdAnnotation:       enableConfig.threshold,
+		pvcautoresizer.ResizeInodesThresholdAnnotation: enableConfig.inodesThreshold,
+		pvcautoresizer.ResizeIncreaseAnnotation:        enableConfig.increase,
+	}
+	// Do not remove the annotations which are not specified.
+	for k, v := range annotations {
+		if v == "" {
+			delete(annotations, k)
+		}
+	}
+	if enableConfig.storageLimit == "" {
+		limit, err := runners.PvcStorageLimit(pvc)
+		if err != nil || limit.IsZero() {
+			return fmt.Errorf("persistentvolumeclaim/%s has no valid storage limit: specify --storage-limit", pvc.Name)
+		}
+	} else if err := validateLimit(cmd, pvc, enableConfig.storageLimit); err != nil {
+		return err
+	}
+
+	if err := patchAnnotations(cmd.Context(), c, pvc, annotations); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "persistentvolumeclaim/%s %s\n", pvc.Name, enabledString(true))
+	warnIfNotTarget(cmd, pvc)
+	return nil
+}
+
+// disablePVC opts the PVC out of the autoresize. The other annotations are kept, so the PVC is
+// enabled again as before by removing the annotation.
+func disablePVC(cmd *cobra.Command, c *kubeClient, pvc *corev1.PersistentVolumeClaim) error {
+	err := patchAnnotations(cmd.Context(), c, pvc, map[string]string{pvcautoresizer.AutoResizeEnabledKey: "false"})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "persistentvolumeclaim/%s %s\n", pvc.Name, enabledString(false))
+	return nil
+}
+
+// validateLimit validates the storage limit and warns if it does not allow the PVC to grow.
+func validateLimit(cmd *cobra.Command, pvc *corev1.PersistentVolumeClaim, value string) error {
+	limit, err := resource.ParseQuantity(value)
+	if err != nil {
+		return fmt.Errorf("invalid storage limit %q: %w", value, err)
+	}
+	if limit.Sign() <= 0 {
+		return fmt.Errorf("storage limit must be positive: %s", value)
+	}
+	if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok && limit.Cmp(capacity) <= 0 {
+		warn(cmd, "the storage limit %s is not larger than the capacity %s of persistentvolumeclaim/%s",
+			value, capacity.String(), pvc.Name)
+	}
+	return nil
+}
+
+// warnIfNotTarget warns if the controller still does not resize the PVC. The StorageClass is not
+// checked since the annotation of the PVC overrides it.
+func warnIfNotTarget(cmd *cobra.Command, pvc *corev1.PersistentVolumeClaim) {
+	if target, err := runners.IsTargetPVC(pvc); err == nil && !target {
+		warn(cmd, "persistentvolumeclaim/%s is not a bound filesystem volume", pvc.Name)
+	}
+}
+
+func runSetLimit(cmd *cobra.Command, name, value string) error {
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	var pvc corev1.PersistentVolumeClaim
+	if err := c.Get(cmd.Context(), types.NamespacedName{Namespace: c.namespace, Name: name}, &pvc); err != nil {
+		return err
+	}
+	if err := validateLimit(cmd, &pvc, value); err != nil {
+		return err
+	}
+	err = patchAnnotations(cmd.Context(), c, &pvc, map[string]string{pvcautoresizer.StorageLimitAnnotation: value})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "persistentvolumeclaim/%s storage limit set to %s\n", name, value)
+	return nil
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "autoresize enabled"
+	}
+	return "autoresize disabled"
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseTarget(t *testing.T) {
+	testCases := []struct {
+		arg            string
+		name           string
+		isStorageClass bool
+		expectErr      bool
+	}{
+		{arg: "data", name: "data"},
+		{arg: "pvc/data", name: "data"},
+		{arg: "PersistentVolumeClaim/data", name: "data"},
+		{arg: "storageclass/standard", name: "standard", isStorageClass: true},
+		{arg: "sc/standard", name: "standard", isStorageClass: true},
+		{arg: "StorageClasses/standard", name: "standard", isStorageClass: true},
+		{arg: "pod/data", expectErr: true},
+	}
+	for _, tc := range testCases {
+		name, isStorageClass, err := parseTarget(tc.arg)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("parseTarget(%q) should fail", tc.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTarget(%q) failed: %v", tc.arg, err)
+			continue
+		}
+		if name != tc.name || isStorageClass != tc.isStorageClass {
+			t.Errorf("parseTarget(%q) = (%q, %t), expected (%q, %t)",
+				tc.arg, name, isStorageClass, tc.name, tc.isStorageClass)
+		}
+	}
+}
+
+func newTestCommand() (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	var out, errOut bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetContext(context.Background())
+	return cmd, &out, &errOut
+}
+
+func getAnnotations(t *testing.T, c client.Client, key types.NamespacedName, obj client.Object) map[string]string {
+	t.Helper()
+	if err := c.Get(context.Background(), key, obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj.GetAnnotations()
+}
+
+func TestEnablePVC(t *testing.T) {
+	defer func(orig struct{ storageLimit, threshold, inodesThreshold, increase string }) {
+		enableConfig = orig
+	}(enableConfig)
+	key := types.NamespacedName{Namespace: "default", Name: "test"}
+
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		config      struct{ storageLimit, threshold, inodesThreshold, increase string }
+		expected    map[string]string
+		expectErr   bool
+		warning     string
+	}{
+		{
+			name:   "with limit",
+			config: struct{ storageLimit, threshold, inodesThreshold, increase string }{"100Gi", "20%", "", "5Gi"},
+			expected: map[string]string{
+				pvcautoresizer.AutoResizeEnabledKey:      "true",
+				pvcautoresizer.StorageLimitAnnotation:    "100Gi",
+				pvcautoresizer.ResizeThresholdAnnotation: "20%",
+				pvcautoresizer.ResizeIncreaseAnnotation:  "5Gi",
+			},
+		},
+		{
+			name: "keep the existing annotations",
+			annotations: map[string]string{
+				pvcautoresizer.AutoResizeEnabledKey:      "false",
+				pvcautoresizer.StorageLimitAnnotation:    "50Gi",
+				pvcautoresizer.ResizeThresholdAnnotation: "30%",
+			},
+			expected: map[string]string{
+				pvcautoresizer.AutoResizeEnabledKey:      "true",
+				pvcautoresizer.StorageLimitAnnotation:    "50Gi",
+				pvcautoresizer.ResizeThresholdAnnotation: "30%",
+			},
+		},
+		{
+			name:      "without limit",
+			expectErr: true,
+		},
+		{
+			name:      "invalid limit",
+			config:    struct{ storageLimit, threshold, inodesThreshold, increase string }{"foo", "", "", ""},
+			expectErr: true,
+		},
+		{
+			name:   "small limit",
+			config: struct{ storageLimit, threshold, inodesThreshold, increase string }{"5Gi", "", "", ""},
+			expected: map[string]string{
+				pvcautoresizer.AutoResizeEnabledKey:   "true",
+				pvcautoresizer.StorageLimitAnnotation: "5Gi",
+			},
+			warning: "is not larger than the capacity 10Gi",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			enableConfig = tc.config
+			pvc := testPVC("test", tc.annotations)
+			c := &kubeClient{Client: fake.NewClientBuilder().WithObjects(pvc).Build(), namespace: "default"}
+			cmd, out, errOut := newTestCommand()
+
+			err := enablePVC(cmd, c, pvc)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("enablePVC should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != "persistentvolumeclaim/test autoresize enabled\n" {
+				t.Errorf("unexpected output: %q", out.String())
+			}
+			if !strings.Contains(errOut.String(), tc.warning) || (tc.warning == "") != (errOut.Len() == 0) {
+				t.Errorf("unexpected warning: %q", errOut.String())
+			}
+			actual := getAnnotations(t, c, key, &corev1.PersistentVolumeClaim{})
+			if len(actual) != len(tc.expected) {
+				t.Errorf("annotations = %v, expected %v", actual, tc.expected)
+			}
+			for k, v := range tc.expected {
+				if actual[k] != v {
+					t.Errorf("annotation %s = %q, expected %q", k, actual[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestDisablePVC(t *testing.T) {
+	pvc := testPVC("test", map[string]string{
+		pvcautoresizer.AutoResizeEnabledKey:   "true",
+		pvcautoresizer.StorageLimitAnnotation: "100Gi",
+	})
+	c := &kubeClient{Client: fake.NewClientBuilder().WithObjects(pvc).Build(), namespace: "default"}
+	cmd, out, _ := newTestCommand()
+
+	if err := disablePVC(cmd, c, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "persistentvolumeclaim/test autoresize disabled\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	actual := getAnnotations(t, c, types.NamespacedName{Namespace: "default", Name: "test"},
+		&corev1.PersistentVolumeClaim{})
+	if actual[pvcautoresizer.AutoResizeEnabledKey] != "false" || actual[pvcautoresizer.StorageLimitAnnotation] != "100Gi" {
+		t.Errorf("unexpected annotations: %v", actual)
+	}
+}
+
+func TestAnnotateStorageClass(t *testing.T) {
+	allowed := true
+	testCases := []struct {
+		name     string
+		sc       *storagev1.StorageClass
+		enable   bool
+		expected map[string]string
+		output   string
+		warning  string
+	}{
+		{
+			name: "enable",
+			sc: &storagev1.StorageClass{
+				ObjectMeta:           metav1.ObjectMeta{Name: "standard"},
+				AllowVolumeExpansion: &allowed,
+			},
+			enable:   true,
+			expected: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true"},
+			output:   "storageclass/standard autoresize enabled\n",
+		},
+		{
+			name:     "enable without volume expansion",
+			sc:       &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}},
+			enable:   true,
+			expected: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true"},
+			output:   "storageclass/standard autoresize enabled\n",
+			warning:  "Warning: storageclass/standard does not allow volume expansion\n",
+		},
+		{
+			name: "disable",
+			sc: &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "standard",
+					Annotations: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true", "foo": "bar"},
+				},
+			},
+			expected: map[string]string{"foo": "bar"},
+			output:   "storageclass/standard autoresize disabled\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithObjects(tc.sc).Build()
+			cmd, out, errOut := newTestCommand()
+
+			if err := annotateStorageClass(cmd, c, "standard", tc.enable); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.output {
+				t.Errorf("unexpected output: %q", out.String())
+			}
+			if errOut.String() != tc.warning {
+				t.Errorf("unexpected warning: %q", errOut.String())
+			}
+			actual := getAnnotations(t, c, types.NamespacedName{Name: "standard"}, &storagev1.StorageClass{})
+			if len(actual) != len(tc.expected) {
+				t.Errorf("annotations = %v, expected %v", actual, tc.expected)
+			}
+			for k, v := range tc.expected {
+				if actual[k] != v {
+					t.Errorf("annotation %s = %q, expected %q", k, actual[k], v)
+				}
+			}
+		})
+	}
+
+	c := fake.NewClientBuilder().Build()
+	cmd, _, _ := newTestCommand()
+	if err := annotateStorageClass(cmd, c, "missing", true); err == nil {
+		t.Error("annotateStorageClass should fail for a missing StorageClass")
+	}
+}
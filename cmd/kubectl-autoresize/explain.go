@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/humanize"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain PVC",
+	Short: "Explain why the PVC will or will not be resized",
+	Long: `Evaluate the PVC in the same way as the controller and show each check with the decision. ` +
+		`Checks depending on the state of the controller, such as backoffs and growth budgets, are not included.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExplain(cmd, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+}
+
+func runExplain(cmd *cobra.Command, name string) error {
+	ctx := cmd.Context()
+	defaults, err := resizeDefaults()
+	if err != nil {
+		return err
+	}
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	var pvc corev1.PersistentVolumeClaim
+	if err := c.Get(ctx, types.NamespacedName{Namespace: c.namespace, Name: name}, &pvc); err != nil {
+		return err
+	}
+	enabledSCs, err := enabledStorageClasses(ctx, c)
+	if err != nil {
+		return err
+	}
+	info := newPVCInfo(&pvc, enabledSCs, volumeStats(cmd, c), defaults)
+	printExplain(cmd.OutOrStdout(), info)
+	return nil
+}
+
+// annotationValue returns the value of the annotation of the PVC, or the default value marked so.
+func annotationValue(pvc *corev1.PersistentVolumeClaim, key, defaultVal string) string {
+	if v, ok := pvc.Annotations[key]; ok && v != "" {
+		return v
+	}
+	return defaultVal + " (default)"
+}
+
+func printExplain(out io.Writer, info *pvcInfo) {
+	pvc := info.pvc
+	d := info.decision
+
+	fmt.Fprintf(out, "PVC:           %s/%s\n", pvc.Namespace, pvc.Name)
+	fmt.Fprintf(out, "StorageClass:  %s\n", d.StorageClass)
+	fmt.Fprintf(out, "Request:       %s\n", d.Request.String())
+	fmt.Fprintf(out, "Capacity:      %s\n", d.Capacity.String())
+	fmt.Fprintln(out, "Annotations:")
+	fmt.Fprintf(out, "  %s: %s\n", pvcautoresizer.StorageLimitAnnotation,
+		annotationValue(pvc, pvcautoresizer.StorageLimitAnnotation, "none"))
+	fmt.Fprintf(out, "  %s: %s\n", pvcautoresizer.ResizeThresholdAnnotation,
+		annotationValue(pvc, pvcautoresizer.ResizeThresholdAnnotation, config.defaultThreshold))
+	fmt.Fprintf(out, "  %s: %s\n", pvcautoresizer.ResizeInodesThresholdAnnotation,
+		annotationValue(pvc, pvcautoresizer.ResizeInodesThresholdAnnotation, config.defaultInodesThreshold))
+	fmt.Fprintf(out, "  %s: %s\n", pvcautoresizer.ResizeIncreaseAnnotation,
+		annotationValue(pvc, pvcautoresizer.ResizeIncreaseAnnotation, config.defaultIncrease))
+
+	// Each check is a condition for the resize. The first unmet one tells why it is not resized.
+	fmt.Fprintln(out, "Checks:")
+	check := func(ok bool, format string, args ...any) bool {
+		result := "OK"
+		if !ok {
+			result = "NG"
+		}
+		fmt.Fprintf(out, "  [%s] %s\n", result, fmt.Sprintf(format, args...))
+		return ok
+	}
+	result := func(format string, args ...any) {
+		fmt.Fprintf(out, "Result:        %s\n", fmt.Sprintf(format, args...))
+	}
+
+	switch info.pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] {
+	case "true":
+		check(true, "PVC is annotated with %s=true", pvcautoresizer.AutoResizeEnabledKey)
+	case "false":
+		check(false, "PVC is not annotated with %s=false", pvcautoresizer.AutoResizeEnabledKey)
+		result("not resized because the PVC disables the autoresize")
+		return
+	default:
+		if !check(info.scEnabled, "StorageClass %q is annotated with %s=true", d.StorageClass,
+			pvcautoresizer.AutoResizeEnabledKey) {
+			result("not resized because the StorageClass does not enable the autoresize")
+			return
+		}
+	}
+	if info.targetErr != nil {
+		check(false, "PVC has a valid storage limit: %v", info.targetErr)
+		result("not resized because of the invalid storage limit")
+		return
+	}
+	if !check(!d.Limit.IsZero(), "PVC has a non-zero storage limit") {
+		result("not resized because the storage limit is not set")
+		return
+	}
+	if !check(info.target, "PVC is a bound filesystem volume") {
+		result("not resized because the PVC is not a bound filesystem volume")
+		return
+	}
+	vs := info.stats
+	if !check(vs != nil, "volume stats are found") {
+		result("not resized because the volume may not be mounted by any pod")
+		return
+	}
+	check(true, "volume has %s available of %s, and %d inodes available of %d",
+		humanize.Bytes(vs.AvailableBytes), humanize.Bytes(vs.CapacityBytes), vs.AvailableInodeSize, vs.CapacityInodeSize)
+	// The stats are found only for mounted volumes, so they are the current ones.
+	pending, _ := runners.IsExpansionPending(pvc, vs, true)
+	if !check(!pending, "no volume expansion is in progress") {
+		result("not resized until the expansion requested by the previous resize completes")
+		return
+	}
+
+	switch d.Action {
+	case runners.DecisionActionResize:
+		if vs.AvailableBytes < d.ThresholdBytes {
+			check(true, "available bytes %s are less than the threshold %s",
+				humanize.Bytes(vs.AvailableBytes), humanize.Bytes(d.ThresholdBytes))
+		} else {
+			check(true, "available inodes %d are less than the threshold %d",
+				vs.AvailableInodeSize, d.InodesThreshold)
+		}
+		result("resized from %s to %s (increase %s, limit %s)", d.Capacity.String(), d.NewSize.String(),
+			humanize.Bytes(d.IncreaseBytes), d.Limit.String())
+	case runners.DecisionActionSkip:
+		if d.Reason == runners.ReasonBelowThreshold {
+			check(false, "available bytes %s or inodes %d are less than the thresholds %s or %d",
+				humanize.Bytes(vs.AvailableBytes), vs.AvailableInodeSize, humanize.Bytes(d.ThresholdBytes), d.InodesThreshold)
+			result("not resized because the usage is below the thresholds")
+			return
+		}
+		check(false, "%s: %s", d.Reason, d.Message)
+		result("not resized (%s)", d.Reason)
+	default:
+		check(false, "%s: %s", d.Reason, d.Message)
+		result("not resized because of the error (%s)", d.Reason)
+	}
+}
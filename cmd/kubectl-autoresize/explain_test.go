@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPrintExplain(t *testing.T) {
+	limited := map[string]string{pvcautoresizer.StorageLimitAnnotation: "100Gi"}
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		scEnabled   bool
+		available   int64
+		noStats     bool
+		increase    string
+		expected    []string
+	}{
+		{
+			name:        "resize",
+			annotations: limited,
+			scEnabled:   true,
+			available:   512 << 20,
+			expected: []string{
+				"  [OK] volume has 512Mi available of 10Gi, and 1000 inodes available of 1000",
+				"  [OK] available bytes 512Mi are less than the threshold 1Gi",
+				"Result:        resized from 10Gi to 11Gi (increase 1Gi, limit 100Gi)",
+			},
+		},
+		{
+			name:        "default increase",
+			annotations: limited,
+			scEnabled:   true,
+			available:   512 << 20,
+			increase:    "5Gi",
+			expected: []string{
+				"  resize.topolvm.io/increase: 5Gi (default)",
+				"Result:        resized from 10Gi to 15Gi (increase 5Gi, limit 100Gi)",
+			},
+		},
+		{
+			name:        "below threshold",
+			annotations: limited,
+			scEnabled:   true,
+			available:   5 << 30,
+			expected: []string{
+				"  [NG] available bytes 5Gi or inodes 1000 are less than the thresholds 1Gi or 100",
+				"Result:        not resized because the usage is below the thresholds",
+			},
+		},
+		{
+			name:        "storage class disabled",
+			annotations: limited,
+			available:   512 << 20,
+			expected: []string{
+				"  [NG] StorageClass \"standard\" is annotated with resize.topolvm.io/enabled=true",
+				"Result:        not resized because the StorageClass does not enable the autoresize",
+			},
+		},
+		{
+			name: "PVC disabled",
+			annotations: map[string]string{
+				pvcautoresizer.StorageLimitAnnotation: "100Gi",
+				pvcautoresizer.AutoResizeEnabledKey:   "false",
+			},
+			scEnabled: true,
+			available: 512 << 20,
+			expected: []string{
+				"Result:        not resized because the PVC disables the autoresize",
+			},
+		},
+		{
+			name:        "no limit",
+			annotations: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true"},
+			available:   512 << 20,
+			expected: []string{
+				"  [OK] PVC is annotated with resize.topolvm.io/enabled=true",
+				"  [NG] PVC has a non-zero storage limit",
+				"Result:        not resized because the storage limit is not set",
+			},
+		},
+		{
+			name:        "no stats",
+			annotations: limited,
+			scEnabled:   true,
+			noStats:     true,
+			expected: []string{
+				"  [NG] volume stats are found",
+				"Result:        not resized because the volume may not be mounted by any pod",
+			},
+		},
+		{
+			name: "expansion in progress",
+			annotations: map[string]string{
+				pvcautoresizer.StorageLimitAnnotation:          "100Gi",
+				pvcautoresizer.PreviousCapacityBytesAnnotation: "10737418240",
+			},
+			scEnabled: true,
+			available: 512 << 20,
+			expected: []string{
+				"  [NG] no volume expansion is in progress",
+				"Result:        not resized until the expansion requested by the previous resize completes",
+			},
+		},
+	}
+	defer func(orig string) { config.defaultIncrease = orig }(config.defaultIncrease)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.defaultIncrease = pvcautoresizer.DefaultIncrease
+			if tc.increase != "" {
+				config.defaultIncrease = tc.increase
+			}
+			defaults, err := resizeDefaults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pvc := testPVC("test", tc.annotations)
+			var vsMap map[types.NamespacedName]*runners.VolumeStats
+			if !tc.noStats {
+				vsMap = testStats(pvc, tc.available)
+			}
+			info := newPVCInfo(pvc, map[string]bool{"standard": tc.scEnabled}, vsMap, defaults)
+
+			var out bytes.Buffer
+			printExplain(&out, info)
+			for _, line := range tc.expected {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("%q is not found in the output:\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var config struct {
+	kubeconfig             string
+	context                string
+	namespace              string
+	prometheusURL          string
+	skipAnnotation         bool
+	defaultThreshold       string
+	defaultInodesThreshold string
+	defaultIncrease        string
+}
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "kubectl-autoresize",
+	Short: "Inspect and control pvc-autoresizer",
+	Long: `kubectl-autoresize is a kubectl plugin to inspect and control the automatic volume resize ` +
+		`by pvc-autoresizer. It evaluates the PVCs in the same way as the controller.`,
+	SilenceUsage: true,
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	fs := rootCmd.PersistentFlags()
+	fs.StringVar(&config.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	fs.StringVar(&config.context, "context", "", "Name of the kubeconfig context to use")
+	fs.StringVarP(&config.namespace, "namespace", "n", "", "Namespace of the PVCs")
+	fs.StringVar(&config.prometheusURL, "prometheus-url", "",
+		"URL of the Prometheus to get the volume stats from. If not given, they are got from kubelets via the API server.")
+	fs.BoolVar(&config.skipAnnotation, "no-annotation-check", false,
+		"Regard all StorageClasses as enabled, as the controller with the same flag does")
+	fs.StringVar(&config.defaultThreshold, "default-threshold", pvcautoresizer.DefaultThreshold,
+		"Threshold of the free space of the PVCs without the annotation, as the controller with the same flag uses")
+	fs.StringVar(&config.defaultInodesThreshold, "default-inodes-threshold", pvcautoresizer.DefaultInodesThreshold,
+		"Threshold of the free inodes of the PVCs without the annotation, as the controller with the same flag uses")
+	fs.StringVar(&config.defaultIncrease, "default-increase", pvcautoresizer.DefaultIncrease,
+		"Amount to increase the PVCs without the annotation by, as the controller with the same flag uses")
+}
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+}
+
+// kubeClient holds the clients to the cluster and the namespace to work on.
+type kubeClient struct {
+	client.Client
+	restConfig *rest.Config
+	namespace  string
+}
+
+func newKubeClient() (*kubeClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = config.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: config.context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	namespace := config.namespace
+	if namespace == "" {
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	return &kubeClient{Client: c, restConfig: restConfig, namespace: namespace}, nil
+}
+
+// resizeDefaults returns the defaults of the annotations given by the flags.
+func resizeDefaults() (runners.ResizeDefaults, error) {
+	defaults := runners.ResizeDefaults{
+		Threshold:       config.defaultThreshold,
+		InodesThreshold: config.defaultInodesThreshold,
+		Increase:        config.defaultIncrease,
+	}
+	if err := defaults.Validate(); err != nil {
+		return runners.ResizeDefaults{}, err
+	}
+	return defaults, nil
+}
+
+// metricsClient returns the client to get the volume stats from the same sources as the controller.
+func (c *kubeClient) metricsClient() (runners.MetricsClient, error) {
+	if config.prometheusURL != "" {
+		return runners.NewPrometheusClient(config.prometheusURL)
+	}
+	return runners.NewK8sMetricsApiClientForConfig(c.restConfig)
+}
+
+// warn prints the warning to the stderr.
+func warn(cmd *cobra.Command, format string, args ...any) {
+	fmt.Fprintf(cmd.ErrOrStderr(), "Warning: "+format+"\n", args...)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/humanize"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var statusConfig struct {
+	allNamespaces bool
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the autoresize status of the PVCs",
+	Long: `Show the usage, the threshold, the storage limit, the size of the next resize and the time of ` +
+		`the last resize of the PVCs.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStatus(cmd)
+	},
+}
+
+func init() {
+	statusCmd.Flags().BoolVarP(&statusConfig.allNamespaces, "all-namespaces", "A", false,
+		"Show the PVCs in all namespaces")
+	rootCmd.AddCommand(statusCmd)
+}
+
+// pvcInfo is a PVC evaluated in the same way as the controller.
+type pvcInfo struct {
+	pvc       *corev1.PersistentVolumeClaim
+	scEnabled bool
+	target    bool
+	targetErr error
+
+	// resizeEnabled is true if the PVC or its StorageClass enables the autoresize.
+	resizeEnabled bool
+
+	// stats is nil if the volume stats are not found.
+	stats *runners.VolumeStats
+
+	// decision is evaluated with the capacity of the PVC as the volume size if the volume stats
+	// are not found, so that the thresholds and the next size are available.
+	decision *runners.Decision
+}
+
+// enabled returns the enabled state shown to the users.
+func (i *pvcInfo) enabled() string {
+	switch {
+	case i.targetErr != nil:
+		return "invalid"
+	case i.resizeEnabled && i.target:
+		return "yes"
+	}
+	return "no"
+}
+
+// nextSize returns the size which the PVC is resized to next time, or nil if it cannot be resized.
+func (i *pvcInfo) nextSize() *resource.Quantity {
+	d := i.decision
+	if d.NewSize != nil {
+		return d.NewSize
+	}
+	if d.Limit.IsZero() || d.IncreaseBytes <= 0 || d.Capacity.Cmp(d.Limit) >= 0 {
+		return nil
+	}
+	return runners.NextSize(d.Capacity, d.IncreaseBytes, d.Limit)
+}
+
+func newPVCInfo(pvc *corev1.PersistentVolumeClaim, enabledSCs map[string]bool,
+	vsMap map[types.NamespacedName]*runners.VolumeStats, defaults runners.ResizeDefaults) *pvcInfo {
+	info := &pvcInfo{pvc: pvc}
+	if pvc.Spec.StorageClassName != nil {
+		info.scEnabled = enabledSCs[*pvc.Spec.StorageClassName]
+	}
+	info.resizeEnabled = runners.IsAutoresizeEnabled(pvc, info.scEnabled)
+	info.target, info.targetErr = runners.IsTargetPVC(pvc)
+
+	vs, ok := vsMap[types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}]
+	if ok {
+		info.stats = vs
+	} else {
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		vs = &runners.VolumeStats{CapacityBytes: capacity.Value(), AvailableBytes: capacity.Value()}
+	}
+	info.decision = runners.EvaluateResizeWithDefaults(pvc, vs, defaults)
+	return info
+}
+
+// enabledStorageClasses returns the names of the StorageClasses enabling the autoresize.
+func enabledStorageClasses(ctx context.Context, c client.Client) (map[string]bool, error) {
+	var scs storagev1.StorageClassList
+	if err := c.List(ctx, &scs); err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(scs.Items))
+	for _, sc := range scs.Items {
+		enabled[sc.Name] = config.skipAnnotation || sc.Annotations[pvcautoresizer.AutoResizeEnabledKey] == "true"
+	}
+	return enabled, nil
+}
+
+// volumeStats returns the volume stats of the PVCs. Failures are warned and result in no stats
+// since the other information is still useful.
+func volumeStats(cmd *cobra.Command, c *kubeClient) map[types.NamespacedName]*runners.VolumeStats {
+	mc, err := c.metricsClient()
+	if err == nil {
+		var vsMap map[types.NamespacedName]*runners.VolumeStats
+		vsMap, err = mc.GetMetrics(cmd.Context())
+		if err == nil {
+			return vsMap
+		}
+	}
+	warn(cmd, "failed to get volume stats: %v", err)
+	return nil
+}
+
+// eventTime returns the time when the event was last observed.
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// lastResizes returns the time of the last Resized event of each PVC. Events expire in the
+// API server, so older resizes are not found.
+func lastResizes(ctx context.Context, c client.Client,
+	opts ...client.ListOption) (map[types.NamespacedName]time.Time, error) {
+	var events corev1.EventList
+	opts = append(opts, client.MatchingFields{
+		"involvedObject.kind": "PersistentVolumeClaim",
+		"reason":              runners.EventReasonResized,
+	})
+	if err := c.List(ctx, &events, opts...); err != nil {
+		return nil, err
+	}
+	last := make(map[types.NamespacedName]time.Time)
+	for i := range events.Items {
+		e := &events.Items[i]
+		key := types.NamespacedName{Namespace: e.InvolvedObject.Namespace, Name: e.InvolvedObject.Name}
+		if t := eventTime(e); t.After(last[key]) {
+			last[key] = t
+		}
+	}
+	return last, nil
+}
+
+func runStatus(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+	defaults, err := resizeDefaults()
+	if err != nil {
+		return err
+	}
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	var opts []client.ListOption
+	if !statusConfig.allNamespaces {
+		opts = append(opts, client.InNamespace(c.namespace))
+	}
+
+	enabledSCs, err := enabledStorageClasses(ctx, c)
+	if err != nil {
+		return err
+	}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := c.List(ctx, &pvcs, opts...); err != nil {
+		return err
+	}
+	if len(pvcs.Items) == 0 {
+		fmt.Fprintln(cmd.ErrOrStderr(), "No PVCs found.")
+		return nil
+	}
+	sort.Slice(pvcs.Items, func(i, j int) bool {
+		if pvcs.Items[i].Namespace != pvcs.Items[j].Namespace {
+			return pvcs.Items[i].Namespace < pvcs.Items[j].Namespace
+		}
+		return pvcs.Items[i].Name < pvcs.Items[j].Name
+	})
+
+	vsMap := volumeStats(cmd, c)
+	resizes, err := lastResizes(ctx, c, opts...)
+	if err != nil {
+		warn(cmd, "failed to list events: %v", err)
+	}
+
+	infos := make([]*pvcInfo, 0, len(pvcs.Items))
+	for i := range pvcs.Items {
+		infos = append(infos, newPVCInfo(&pvcs.Items[i], enabledSCs, vsMap, defaults))
+	}
+	return printStatus(cmd.OutOrStdout(), infos, resizes, statusConfig.allNamespaces, time.Now())
+}
+
+func printStatus(out io.Writer, infos []*pvcInfo, resizes map[types.NamespacedName]time.Time,
+	withNamespace bool, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	if withNamespace {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tSTORAGECLASS\tENABLED\tCAPACITY\tUSED\tTHRESHOLD\tLIMIT\tNEXT SIZE\tLAST RESIZE")
+
+	for _, info := range infos {
+		pvc := info.pvc
+		d := info.decision
+		if withNamespace {
+			fmt.Fprintf(w, "%s\t", pvc.Namespace)
+		}
+		storageClass := "-"
+		if d.StorageClass != "" {
+			storageClass = d.StorageClass
+		}
+		capacity, used, threshold, limit, next, last := "-", "-", "-", "-", "-", "-"
+		if !d.Capacity.IsZero() {
+			capacity = d.Capacity.String()
+		}
+		if info.stats != nil && info.stats.CapacityBytes > 0 {
+			used = fmt.Sprintf("%d%%", 100-info.stats.AvailableBytes*100/info.stats.CapacityBytes)
+		}
+		if info.enabled() == "yes" {
+			if d.ThresholdBytes > 0 {
+				threshold = humanize.Bytes(d.ThresholdBytes)
+			}
+			limit = d.Limit.String()
+			if size := info.nextSize(); size != nil {
+				next = size.String()
+			}
+		}
+		if t, ok := resizes[types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}]; ok {
+			last = duration.HumanDuration(now.Sub(t)) + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			pvc.Name, storageClass, info.enabled(), capacity, used, threshold, limit, next, last)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testPVC(name string, annotations map[string]string) *corev1.PersistentVolumeClaim {
+	sc := "standard"
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: annotations},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &sc,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+		},
+	}
+}
+
+func testStats(pvc *corev1.PersistentVolumeClaim, availableBytes int64) map[types.NamespacedName]*runners.VolumeStats {
+	return map[types.NamespacedName]*runners.VolumeStats{
+		{Namespace: pvc.Namespace, Name: pvc.Name}: {
+			AvailableBytes:     availableBytes,
+			CapacityBytes:      10 << 30,
+			AvailableInodeSize: 1000,
+			CapacityInodeSize:  1000,
+		},
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	enabledSCs := map[string]bool{"standard": true}
+	resizing := testPVC("resizing", map[string]string{pvcautoresizer.StorageLimitAnnotation: "100Gi"})
+	idle := testPVC("idle", map[string]string{pvcautoresizer.StorageLimitAnnotation: "100Gi"})
+	disabled := testPVC("disabled", map[string]string{
+		pvcautoresizer.StorageLimitAnnotation: "100Gi",
+		pvcautoresizer.AutoResizeEnabledKey:   "false",
+	})
+	invalid := testPVC("invalid", map[string]string{pvcautoresizer.StorageLimitAnnotation: "foo"})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	infos := []*pvcInfo{
+		newPVCInfo(resizing, enabledSCs, testStats(resizing, 512<<20), runners.ResizeDefaults{}),
+		newPVCInfo(idle, enabledSCs, nil, runners.ResizeDefaults{}),
+		newPVCInfo(disabled, enabledSCs, testStats(disabled, 5<<30), runners.ResizeDefaults{}),
+		newPVCInfo(invalid, enabledSCs, nil, runners.ResizeDefaults{}),
+	}
+	resizes := map[types.NamespacedName]time.Time{
+		{Namespace: "default", Name: "resizing"}: now.Add(-5 * time.Minute),
+	}
+
+	var out bytes.Buffer
+	if err := printStatus(&out, infos, resizes, true, now); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"NAMESPACE", "NAME", "STORAGECLASS", "ENABLED", "CAPACITY", "USED", "THRESHOLD", "LIMIT", "NEXT", "SIZE",
+			"LAST", "RESIZE"},
+		{"default", "resizing", "standard", "yes", "10Gi", "95%", "1Gi", "100Gi", "11Gi", "5m", "ago"},
+		{"default", "idle", "standard", "yes", "10Gi", "-", "1Gi", "100Gi", "11Gi", "-"},
+		{"default", "disabled", "standard", "no", "10Gi", "50%", "-", "-", "-", "-"},
+		{"default", "invalid", "standard", "invalid", "10Gi", "-", "-", "-", "-", "-"},
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+	for i, line := range lines {
+		if actual := strings.Fields(line); strings.Join(actual, " ") != strings.Join(expected[i], " ") {
+			t.Errorf("line %d = %q, expected %q", i, actual, expected[i])
+		}
+	}
+}
@@ -7,17 +7,25 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	//+kubebuilder:scaffold:imports
 )
 
-var config struct {
+// options holds the values of the flags of the controller.
+type options struct {
+	configFile                string
 	certDir                   string
 	webhookAddr               string
 	metricsAddr               string
+	metricsSecure             bool
 	healthAddr                string
 	namespaces                []string
+	namespaceSelector         string
+	namespaceExcludeSelector  string
+	excludeNamespaces         []string
 	watchInterval             time.Duration
 	prometheusURL             string
 	useK8sMetricsApi          bool
@@ -25,9 +33,50 @@ var config struct {
 	development               bool
 	zapOpts                   zap.Options
 	pvcMutatingWebhookEnabled bool
+	stsMutatingWebhookEnabled bool
 	metricsResetSizeThreshold uint64
+	quotaBumpAnnotation       string
+	checkBackendCapacity      bool
+	resizeTimeout             time.Duration
+	recoverExpansionFailure   bool
+	offlineResize             bool
+	offlineStatsLookback      time.Duration
+	maxBytesPerHour           string
+	maxBytesPerHourPerNS      string
+	maxBytesPerHourPerSC      string
+	maxResizesPerPVCPerDay    int
+	circuitBreakerCooldown    time.Duration
+	failureBackoffBase        time.Duration
+	failureBackoffMax         time.Duration
+	maxConsecutiveFailures    int
+	fieldManager              string
+	desiredSizeConfigMap      string
+	desiredSizeWebhookURL     string
+	desiredSizePatchDir       string
+	metricsDropDeletedPVCs    bool
+	metricsAggregation        string
+	metricsTopN               int
+	otlpTracesEndpoint        string
+	decisionLogFile           string
+	decisionLogMaxSize        string
+	decisionLogMaxBackups     int
+	decisionBufferSize        int
+	debugAPIEnabled           bool
+	eventDedupInterval        time.Duration
+	limitWarningPercentages   []string
+	limitWarningResizes       int
+	limitWarningWebhookURL    string
+	alertmanagerURL           string
+	alertFailureThreshold     int
+	alertLabels               map[string]string
+	traceSampleRatio          float64
+	defaultThreshold          string
+	defaultInodesThreshold    string
+	defaultIncrease           string
 }
 
+var config options
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "pvc-autoresizer",
@@ -36,7 +85,7 @@ var rootCmd = &cobra.Command{
 		`amount of free filesystem capacity.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		return subMain()
+		return subMain(cmd.Flags())
 	},
 }
 
@@ -48,24 +97,127 @@ func main() {
 }
 
 func init() {
-	fs := rootCmd.Flags()
-	fs.StringVar(&config.certDir, "cert-dir", "/certs", "webhook certificate directory")
-	fs.StringVar(&config.webhookAddr, "webhook-addr", ":9443", "Listen address for the webhook endpoint")
-	fs.StringVar(&config.metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	fs.StringVar(&config.healthAddr, "health-addr", ":8081", "The address of health/readiness probes.")
-	fs.StringSliceVar(&config.namespaces, "namespaces", []string{},
+	config.addFlags(rootCmd.Flags())
+}
+
+func (c *options) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.configFile, "config", "",
+		"YAML file of the settings, whose keys are the names of the flags. The flags given on the command line "+
+			"take precedence. The file is reloaded when it is changed.")
+	fs.StringVar(&c.certDir, "cert-dir", "/certs", "webhook certificate directory")
+	fs.StringVar(&c.webhookAddr, "webhook-addr", ":9443", "Listen address for the webhook endpoint")
+	fs.StringVar(&c.metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	fs.BoolVar(&c.metricsSecure, "metrics-secure", false,
+		"Serve the metrics endpoint via HTTPS and allow only the requests authorized by the Kubernetes API")
+	fs.StringVar(&c.healthAddr, "health-addr", ":8081", "The address of health/readiness probes.")
+	fs.StringSliceVar(&c.namespaces, "namespaces", []string{},
 		"Namespaces to resize PersistentVolumeClaims within. Empty for all namespaces.")
-	fs.DurationVar(&config.watchInterval, "interval", 1*time.Minute, "Interval to monitor pvc capacity.")
-	fs.StringVar(&config.prometheusURL, "prometheus-url", "", "Prometheus URL to query volume stats.")
-	fs.BoolVar(&config.useK8sMetricsApi, "use-k8s-metrics-api", false, "Use Kubernetes metrics API instead of Prometheus")
-	fs.BoolVar(&config.skipAnnotation, "no-annotation-check", false, "Skip annotation check for StorageClass")
-	fs.BoolVar(&config.development, "development", false, "Use development logger config")
-	fs.BoolVar(&config.pvcMutatingWebhookEnabled, "pvc-mutating-webhook-enabled", true,
+	fs.StringVar(&c.namespaceSelector, "namespace-selector", "",
+		"Label selector of the namespaces to resize PersistentVolumeClaims within. Empty for all namespaces.")
+	fs.StringVar(&c.namespaceExcludeSelector, "namespace-exclude-selector", "",
+		"Label selector of the namespaces to exclude from resizing. Empty to exclude none.")
+	fs.StringSliceVar(&c.excludeNamespaces, "exclude-namespaces", []string{},
+		"Namespaces to exclude from resizing.")
+	fs.DurationVar(&c.watchInterval, "interval", 1*time.Minute, "Interval to monitor pvc capacity.")
+	fs.StringVar(&c.prometheusURL, "prometheus-url", "", "Prometheus URL to query volume stats.")
+	fs.BoolVar(&c.useK8sMetricsApi, "use-k8s-metrics-api", false, "Use Kubernetes metrics API instead of Prometheus")
+	fs.BoolVar(&c.skipAnnotation, "no-annotation-check", false, "Skip annotation check for StorageClass")
+	fs.BoolVar(&c.development, "development", false, "Use development logger config")
+	fs.BoolVar(&c.pvcMutatingWebhookEnabled, "pvc-mutating-webhook-enabled", true,
 		"Enable the pvc mutating webhook endpoint")
-	fs.Uint64Var(&config.metricsResetSizeThreshold, "metrics-reset-size-threshold", 0,
+	fs.BoolVar(&c.stsMutatingWebhookEnabled, "statefulset-mutating-webhook-enabled", false,
+		"Enable the statefulset mutating webhook endpoint")
+	fs.Uint64Var(&c.metricsResetSizeThreshold, "metrics-reset-size-threshold", 0,
 		"Reset metrics when their encoded size exceeds this threshold in bytes. Set 0 to disable. (default 0)")
+	fs.BoolVar(&c.metricsDropDeletedPVCs, "metrics-drop-deleted-pvcs", true,
+		"Delete the metrics of PersistentVolumeClaims when they are deleted")
+	fs.StringVar(&c.metricsAggregation, "metrics-aggregation", "pvc",
+		"Level to aggregate the per-PVC counters to: pvc, namespace or storageclass")
+	fs.IntVar(&c.metricsTopN, "metrics-top-n", 0,
+		"Export the per-PVC gauges only for the N PVCs with the highest volume usage. "+
+			"Set 0 to export them for all PVCs (only with --metrics-aggregation=pvc).")
+	fs.StringVar(&c.otlpTracesEndpoint, "otlp-traces-endpoint", "",
+		"URL of the OTLP/HTTP endpoint to export traces to (e.g. http://otel-collector:4318/v1/traces). "+
+			"Empty to disable tracing.")
+	fs.Float64Var(&c.traceSampleRatio, "trace-sample-ratio", 1,
+		"Ratio of the traces to be sampled, between 0 and 1")
+	fs.StringVar(&c.quotaBumpAnnotation, "quota-bump-annotation", "",
+		"Annotation key set to the namespace to request a ResourceQuota bump when it prevents a resize. "+
+			"Empty to disable.")
+	fs.BoolVar(&c.checkBackendCapacity, "check-backend-capacity", false,
+		"Check the free capacity of the storage backend (CSIStorageCapacity or TopoLVM node annotations) before resizing")
+	fs.DurationVar(&c.resizeTimeout, "resize-timeout", 0,
+		"Duration to wait for a volume expansion to complete before it is regarded as stuck. Set 0 to disable.")
+	fs.BoolVar(&c.recoverExpansionFailure, "recover-expansion-failure", false,
+		"Retry an infeasible volume expansion with a smaller size. "+
+			"Requires the RecoverVolumeExpansionFailure feature of Kubernetes.")
+	fs.BoolVar(&c.offlineResize, "offline-resize", false,
+		"Resize volumes not mounted by any pod based on their last-known volume stats in Prometheus")
+	fs.DurationVar(&c.offlineStatsLookback, "offline-stats-lookback", 7*24*time.Hour,
+		"Period to look back for the last-known volume stats of offline volumes")
+	fs.StringVar(&c.maxBytesPerHour, "max-bytes-per-hour", "",
+		"Maximum total bytes added to PVCs in the cluster per hour (e.g. 1Ti). Empty to disable.")
+	fs.StringVar(&c.maxBytesPerHourPerNS, "max-bytes-per-hour-per-namespace", "",
+		"Maximum total bytes added to PVCs in a namespace per hour (e.g. 100Gi). Empty to disable.")
+	fs.StringVar(&c.maxBytesPerHourPerSC, "max-bytes-per-hour-per-storageclass", "",
+		"Maximum total bytes added to PVCs of a StorageClass per hour (e.g. 500Gi). Empty to disable.")
+	fs.IntVar(&c.maxResizesPerPVCPerDay, "max-resizes-per-pvc-per-day", 0,
+		"Maximum number of resizes of a PVC per day. Set 0 to disable.")
+	fs.DurationVar(&c.circuitBreakerCooldown, "circuit-breaker-cooldown", time.Hour,
+		"Duration to pause resizing in the cluster, namespace or StorageClass whose growth budget is exceeded")
+	fs.DurationVar(&c.failureBackoffBase, "failure-backoff-base", 30*time.Second,
+		"Delay before retrying a failed resize of a PVC. The delay doubles on every consecutive failure. "+
+			"Set 0 to disable. Requires --metrics-secure.")
+	fs.DurationVar(&c.failureBackoffMax, "failure-backoff-max", time.Hour,
+		"Maximum delay before retrying a failed resize of a PVC")
+	fs.IntVar(&c.maxConsecutiveFailures, "max-consecutive-failures", 10,
+		"Number of consecutive failures after which resizing a PVC is given up until the PVC is modified. "+
+			"Set 0 to disable.")
+	fs.StringVar(&c.fieldManager, "field-manager", "pvc-autoresizer",
+		"Name of the field manager of the patches to PersistentVolumeClaims")
+	fs.StringVar(&c.desiredSizeConfigMap, "desired-size-configmap", "",
+		"ConfigMap (<namespace>/<name>) to record the desired sizes of resized PVCs. Empty to disable.")
+	fs.StringVar(&c.desiredSizeWebhookURL, "desired-size-webhook-url", "",
+		"URL to POST the desired sizes of resized PVCs to. Empty to disable.")
+	fs.StringVar(&c.desiredSizePatchDir, "desired-size-patch-dir", "",
+		"Directory to write the patch files of resized PVCs to. Empty to disable.")
+	fs.StringVar(&c.decisionLogFile, "decision-log-file", "",
+		"File to write the decision records of the evaluations of PVCs to in JSON lines. Empty to disable.")
+	fs.StringVar(&c.decisionLogMaxSize, "decision-log-max-size", "100Mi",
+		"Size of the decision log file to rotate it at")
+	fs.IntVar(&c.decisionLogMaxBackups, "decision-log-max-backups", 3,
+		"Number of the rotated decision log files to keep")
+	fs.IntVar(&c.decisionBufferSize, "decision-buffer-size", 0,
+		"Number of the latest decision records served at /debug/decisions of the metrics endpoint. "+
+			"Set 0 to disable.")
+	fs.BoolVar(&c.debugAPIEnabled, "debug-api-enabled", false,
+		"Serve the states of the targeted PVCs at /debug/pvcs and the configuration at /debug/config "+
+			"of the metrics endpoint. Requires --metrics-secure.")
+	fs.DurationVar(&c.eventDedupInterval, "event-dedup-interval", time.Hour,
+		"Interval in which the events of the same reason to a PVC are emitted only once. Set 0 to disable.")
+	fs.StringSliceVar(&c.limitWarningPercentages, "limit-warning-percentages", []string{},
+		"Percentages of the storage limit used by the capacity of a PVC to warn at, e.g. 80%,95%")
+	fs.IntVar(&c.limitWarningResizes, "limit-warning-resizes-remaining", 0,
+		"Warn when the estimated number of the resizes remaining until the storage limit is this or less. "+
+			"Set 0 to disable.")
+	fs.StringVar(&c.limitWarningWebhookURL, "limit-warning-webhook-url", "",
+		"URL to POST the notifications of the PVCs approaching their storage limits to. Empty to disable.")
+	fs.StringVar(&c.alertmanagerURL, "alertmanager-url", "",
+		"URL of Alertmanager to push the alerts of stuck expansions, failing resizes and reached storage limits to. "+
+			"Empty to disable.")
+	fs.IntVar(&c.alertFailureThreshold, "alert-failure-threshold", 3,
+		"Number of consecutive resize failures of a PVC to raise the PVCResizeFailing alert")
+	fs.StringToStringVar(&c.alertLabels, "alert-labels", map[string]string{},
+		"Labels added to all the alerts pushed to Alertmanager, e.g. cluster=prod")
+	fs.StringVar(&c.defaultThreshold, "default-threshold", pvcautoresizer.DefaultThreshold,
+		"Threshold of the free space of the PVCs without the "+pvcautoresizer.ResizeThresholdAnnotation+" annotation")
+	fs.StringVar(&c.defaultInodesThreshold, "default-inodes-threshold", pvcautoresizer.DefaultInodesThreshold,
+		"Threshold of the free inodes of the PVCs without the "+pvcautoresizer.ResizeInodesThresholdAnnotation+
+			" annotation")
+	fs.StringVar(&c.defaultIncrease, "default-increase", pvcautoresizer.DefaultIncrease,
+		"Amount to increase the PVCs without the "+pvcautoresizer.ResizeIncreaseAnnotation+" annotation by")
 
 	goflags := flag.NewFlagSet("zap", flag.ExitOnError)
-	config.zapOpts.BindFlags(goflags)
+	c.zapOpts.BindFlags(goflags)
 	fs.AddGoFlagSet(goflags)
 }
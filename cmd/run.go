@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/topolvm/pvc-autoresizer/internal/hooks"
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
 	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -16,12 +29,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 	//+kubebuilder:scaffold:imports
 )
 
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -34,14 +51,46 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
-func subMain() error {
+func subMain(fs *pflag.FlagSet) error {
+	if config.configFile != "" {
+		if err := applyConfigFile(fs, config.configFile); err != nil {
+			return err
+		}
+	}
 	if config.development {
 		config.zapOpts.Development = true
 	}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&config.zapOpts)))
 
+	metricsClient, runnerOpts, err := config.build()
+	if err != nil {
+		setupLog.Error(err, "invalid configuration")
+		return err
+	}
+	effective := newEffectiveConfig(fs)
+	setupLog.Info("effective configuration", "config", effective.get())
+
+	if config.otlpTracesEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+			Endpoint:    config.otlpTracesEndpoint,
+			SampleRatio: config.traceSampleRatio,
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				setupLog.Error(err, "failed to flush traces")
+			}
+		}()
+	}
+
+	webhookEnabled := config.pvcMutatingWebhookEnabled || config.stsMutatingWebhookEnabled
 	var webhookServer webhook.Server
-	if config.pvcMutatingWebhookEnabled {
+	if webhookEnabled {
 		hookHost, portStr, err := net.SplitHostPort(config.webhookAddr)
 		if err != nil {
 			setupLog.Error(err, "invalid webhook addr")
@@ -62,6 +111,40 @@ func subMain() error {
 
 	graceTimeout := 10 * time.Second
 
+	metricsExtraHandlers := make(map[string]http.Handler)
+	metricsOpts := metricsserver.Options{BindAddress: config.metricsAddr, ExtraHandlers: metricsExtraHandlers}
+	if config.metricsSecure {
+		metricsOpts.SecureServing = true
+		metricsOpts.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+	decisionSinks, err := config.decisionLogSinks(metricsExtraHandlers)
+	if err != nil {
+		setupLog.Error(err, "invalid decision log")
+		return err
+	}
+	defer func() {
+		// The manager has stopped the resizer, so no more decisions are recorded.
+		for _, sink := range decisionSinks {
+			if closer, ok := sink.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					setupLog.Error(err, "failed to close decision log")
+				}
+			}
+		}
+	}()
+	var state *runners.StateStore
+	if config.debugAPIEnabled {
+		// The debug API exposes the PVCs and the settings, so it is served only to authorized clients.
+		if !config.metricsSecure {
+			err := errors.New("--debug-api-enabled requires --metrics-secure")
+			setupLog.Error(err, "invalid configuration")
+			return err
+		}
+		state = runners.NewStateStore()
+		metricsExtraHandlers["/debug/pvcs"] = state
+		metricsExtraHandlers["/debug/config"] = effective
+	}
+
 	var pvcCacheTarget cache.ByObject
 	if len(config.namespaces) == 0 {
 		pvcCacheTarget = cache.ByObject{
@@ -81,15 +164,20 @@ func subMain() error {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:        scheme,
 		WebhookServer: webhookServer,
-		Metrics: metricsserver.Options{
-			BindAddress: config.metricsAddr,
-		},
+		Metrics:       metricsOpts,
 		Cache: cache.Options{
 			ByObject: map[client.Object]cache.ByObject{
 				&corev1.PersistentVolumeClaim{}: pvcCacheTarget,
+				&corev1.ResourceQuota{}:         pvcCacheTarget,
 				&storagev1.StorageClass{}:       {},
 			},
 		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// ConfigMaps are only written as a desired size sink, so they are not cached.
+				DisableFor: []client.Object{&corev1.ConfigMap{}},
+			},
+		},
 		HealthProbeBindAddress:  config.healthAddr,
 		LeaderElection:          true,
 		LeaderElectionID:        "49e22f61.topolvm.io",
@@ -106,24 +194,15 @@ func subMain() error {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		return err
 	}
-	if config.pvcMutatingWebhookEnabled {
+	if webhookEnabled {
 		if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
 			return err
 		}
 	}
 
-	var metricsClient runners.MetricsClient
-	if config.useK8sMetricsApi {
-		metricsClient, err = runners.NewK8sMetricsApiClient()
-	} else if config.prometheusURL != "" {
-		metricsClient, err = runners.NewPrometheusClient(config.prometheusURL)
-	} else {
-		setupLog.Error(err, "enable use-k8s-metrics-api or provide prometheus-url")
-		return err
-	}
-
+	sinks, err := config.desiredSizeSinks(mgr.GetClient())
 	if err != nil {
-		setupLog.Error(err, "unable to initialize metrics client")
+		setupLog.Error(err, "invalid desired size sink")
 		return err
 	}
 
@@ -132,21 +211,52 @@ func subMain() error {
 		return err
 	}
 
-	pvcAutoresizer := runners.NewPVCAutoresizer(metricsClient, mgr.GetClient(),
-		ctrl.Log.WithName("pvc-autoresizer"),
-		config.watchInterval, mgr.GetEventRecorder("pvc-autoresizer"), config.metricsResetSizeThreshold)
+	err = metrics.ConfigureCardinality(metrics.CardinalityOptions{
+		Aggregation: config.metricsAggregation,
+		TopN:        config.metricsTopN,
+	})
+	if err != nil {
+		setupLog.Error(err, "invalid metrics cardinality options")
+		return err
+	}
+	if config.metricsDropDeletedPVCs {
+		if err := runners.SetupMetricsCleanup(mgr); err != nil {
+			setupLog.Error(err, "unable to set up metrics cleanup")
+			return err
+		}
+	}
+
+	runnerOpts.DesiredSizeSinks = sinks
+	runnerOpts.DecisionSinks = decisionSinks
+	runnerOpts.State = state
+	if config.configFile != "" {
+		reloader := newConfigReloader(os.Args[1:], config.configFile, effective, ctrl.Log.WithName("config"))
+		runnerOpts.Reloads = reloader.reloads
+		if err := mgr.Add(reloader); err != nil {
+			setupLog.Error(err, "unable to add config reloader to manager")
+			return err
+		}
+	}
+	pvcAutoresizer := runners.NewPVCAutoresizer(metricsClient, mgr.GetClient(), mgr.GetAPIReader(),
+		ctrl.Log.WithName("pvc-autoresizer"), mgr.GetEventRecorder("pvc-autoresizer"), runnerOpts)
 	if err := mgr.Add(pvcAutoresizer); err != nil {
 		setupLog.Error(err, "unable to add autoresier to manager")
 		return err
 	}
 
+	dec := admission.NewDecoder(scheme)
 	if config.pvcMutatingWebhookEnabled {
-		dec := admission.NewDecoder(scheme)
 		if err = hooks.SetupPersistentVolumeClaimWebhook(mgr, dec, ctrl.Log.WithName("hooks")); err != nil {
 			setupLog.Error(err, "unable to create PersistentVolumeClaim webhook")
 			return err
 		}
 	}
+	if config.stsMutatingWebhookEnabled {
+		if err = hooks.SetupStatefulSetWebhook(mgr, dec, ctrl.Log.WithName("hooks")); err != nil {
+			setupLog.Error(err, "unable to create StatefulSet webhook")
+			return err
+		}
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -157,3 +267,178 @@ func subMain() error {
 	}
 	return nil
 }
+
+// namespaceFilter returns the filter of the namespaces whose PVCs are resized.
+func (c *options) namespaceFilter() (runners.NamespaceFilter, error) {
+	return runners.ParseNamespaceFilter(c.namespaceSelector, c.namespaceExcludeSelector, c.excludeNamespaces)
+}
+
+// build returns the metrics client and the settings of pvcAutoresizer except the sinks and the
+// state store. It is also used to validate the settings reloaded from the config file.
+func (c *options) build() (runners.MetricsClient, runners.Options, error) {
+	var metricsClient runners.MetricsClient
+	var err error
+	if c.useK8sMetricsApi {
+		metricsClient, err = runners.NewK8sMetricsApiClient()
+	} else if c.prometheusURL != "" {
+		metricsClient, err = runners.NewPrometheusClient(c.prometheusURL)
+	} else {
+		return nil, runners.Options{}, errors.New("enable use-k8s-metrics-api or provide prometheus-url")
+	}
+	if err != nil {
+		return nil, runners.Options{}, fmt.Errorf("unable to initialize metrics client: %w", err)
+	}
+	if _, ok := metricsClient.(runners.HistoricalMetricsClient); c.offlineResize && !ok {
+		return nil, runners.Options{}, errors.New("offline-resize requires prometheus-url")
+	}
+	if c.watchInterval <= 0 {
+		return nil, runners.Options{}, fmt.Errorf("interval must be positive: %s", c.watchInterval)
+	}
+
+	budget, err := c.budgetOptions()
+	if err != nil {
+		return nil, runners.Options{}, fmt.Errorf("invalid growth budget: %w", err)
+	}
+	limitWarning, err := c.limitWarningOptions()
+	if err != nil {
+		return nil, runners.Options{}, fmt.Errorf("invalid limit warning: %w", err)
+	}
+	namespaces, err := c.namespaceFilter()
+	if err != nil {
+		return nil, runners.Options{}, err
+	}
+	defaults, err := c.resizeDefaults()
+	if err != nil {
+		return nil, runners.Options{}, err
+	}
+
+	return metricsClient, runners.Options{
+		Interval:                  c.watchInterval,
+		MetricsResetSizeThreshold: c.metricsResetSizeThreshold,
+		QuotaBumpAnnotation:       c.quotaBumpAnnotation,
+		CheckBackendCapacity:      c.checkBackendCapacity,
+		ResizeTimeout:             c.resizeTimeout,
+		RecoverExpansionFailure:   c.recoverExpansionFailure,
+		OfflineResize:             c.offlineResize,
+		OfflineStatsLookback:      c.offlineStatsLookback,
+		FieldManager:              c.fieldManager,
+		EventDedupInterval:        c.eventDedupInterval,
+		Namespaces:                namespaces,
+		Defaults:                  defaults,
+		LimitWarning:              limitWarning,
+		Budget:                    budget,
+		Backoff: runners.BackoffOptions{
+			BaseDelay:              c.failureBackoffBase,
+			MaxDelay:               c.failureBackoffMax,
+			MaxConsecutiveFailures: c.maxConsecutiveFailures,
+		},
+		Alerts: runners.AlertOptions{
+			AlertmanagerURL:  c.alertmanagerURL,
+			FailureThreshold: c.alertFailureThreshold,
+			Labels:           c.alertLabels,
+		},
+	}, nil
+}
+
+func (c *options) resizeDefaults() (runners.ResizeDefaults, error) {
+	defaults := runners.ResizeDefaults{
+		Threshold:       c.defaultThreshold,
+		InodesThreshold: c.defaultInodesThreshold,
+		Increase:        c.defaultIncrease,
+	}
+	if err := defaults.Validate(); err != nil {
+		return runners.ResizeDefaults{}, err
+	}
+	return defaults, nil
+}
+
+func (c *options) budgetOptions() (runners.BudgetOptions, error) {
+	opts := runners.BudgetOptions{
+		MaxResizesPerPVCPerDay: c.maxResizesPerPVCPerDay,
+		CircuitBreakerCooldown: c.circuitBreakerCooldown,
+	}
+	for _, f := range []struct {
+		name string
+		val  string
+		dst  *int64
+	}{
+		{"max-bytes-per-hour", c.maxBytesPerHour, &opts.MaxBytesPerHour},
+		{"max-bytes-per-hour-per-namespace", c.maxBytesPerHourPerNS, &opts.MaxBytesPerHourPerNamespace},
+		{"max-bytes-per-hour-per-storageclass", c.maxBytesPerHourPerSC, &opts.MaxBytesPerHourPerStorageClass},
+	} {
+		if f.val == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(f.val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s: %w", f.name, err)
+		}
+		*f.dst = q.Value()
+	}
+	return opts, nil
+}
+
+func (c *options) limitWarningOptions() (runners.LimitWarningOptions, error) {
+	opts := runners.LimitWarningOptions{ResizesRemaining: c.limitWarningResizes}
+	if c.limitWarningResizes < 0 {
+		return opts, fmt.Errorf("limit-warning-resizes-remaining must not be negative: %d", c.limitWarningResizes)
+	}
+	for _, v := range c.limitWarningPercentages {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid limit-warning-percentages %q: %w", v, err)
+		}
+		if p <= 0 || p > 100 {
+			return opts, fmt.Errorf("invalid limit-warning-percentages %q: must be in (0, 100]", v)
+		}
+		opts.UsedPercentages = append(opts.UsedPercentages, p)
+	}
+	if c.limitWarningWebhookURL != "" {
+		opts.Notifiers = append(opts.Notifiers, runners.NewLimitWebhookNotifier(c.limitWarningWebhookURL))
+	}
+	return opts, nil
+}
+
+func (c *options) desiredSizeSinks(cl client.Client) ([]runners.DesiredSizeSink, error) {
+	var sinks []runners.DesiredSizeSink
+	if c.desiredSizeConfigMap != "" {
+		ns, name, ok := strings.Cut(c.desiredSizeConfigMap, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid desired-size-configmap %q: must be <namespace>/<name>",
+				c.desiredSizeConfigMap)
+		}
+		sinks = append(sinks, runners.NewConfigMapSink(cl, types.NamespacedName{Namespace: ns, Name: name}))
+	}
+	if c.desiredSizeWebhookURL != "" {
+		sinks = append(sinks, runners.NewWebhookSink(c.desiredSizeWebhookURL))
+	}
+	if c.desiredSizePatchDir != "" {
+		sinks = append(sinks, runners.NewPatchFileSink(c.desiredSizePatchDir))
+	}
+	return sinks, nil
+}
+
+func (c *options) decisionLogSinks(handlers map[string]http.Handler) ([]runners.DecisionSink, error) {
+	var sinks []runners.DecisionSink
+	if c.decisionLogFile != "" {
+		maxSize, err := resource.ParseQuantity(c.decisionLogMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decision-log-max-size: %w", err)
+		}
+		sink, err := runners.NewDecisionFileSink(c.decisionLogFile, maxSize.Value(), c.decisionLogMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if c.decisionBufferSize > 0 {
+		// The records expose the PVCs, so they are served only to authorized clients like the debug API.
+		if !c.metricsSecure {
+			return nil, errors.New("--decision-buffer-size requires --metrics-secure")
+		}
+		buf := runners.NewDecisionBuffer(c.decisionBufferSize)
+		sinks = append(sinks, buf)
+		handlers["/debug/decisions"] = buf
+	}
+	return sinks, nil
+}
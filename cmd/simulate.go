@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/humanize"
+	"github.com/topolvm/pvc-autoresizer/internal/simulator"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var simulateConfig struct {
+	input           string
+	format          string
+	output          string
+	initialSize     string
+	storageLimit    string
+	threshold       string
+	inodesThreshold string
+	increase        string
+	expansionDelay  time.Duration
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate a resize policy with a usage time series",
+	Long: `Replay a usage time series of a volume through the same evaluation as the controller with a resize ` +
+		`policy, and show the resulting resizes, the peak over-provisioning and the moments when the volume would ` +
+		`have been full.
+
+The input is a CSV of "time,used_bytes[,used_inodes,capacity_inodes]" lines, or a result of a Prometheus ` +
+		`range query such as kubelet_volume_stats_used_bytes of a PVC in JSON.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return simulate(cmd)
+	},
+}
+
+func init() {
+	fs := simulateCmd.Flags()
+	fs.StringVarP(&simulateConfig.input, "input", "i", "", "File of the usage time series. \"-\" reads the stdin.")
+	fs.StringVar(&simulateConfig.format, "format", "",
+		"Format of the input: csv or prometheus. Determined by the file extension if not given.")
+	fs.StringVarP(&simulateConfig.output, "output", "o", "text", "Output format: text or json")
+	fs.StringVar(&simulateConfig.initialSize, "initial-size", "", "Capacity of the PVC at the first sample")
+	fs.StringVar(&simulateConfig.storageLimit, "storage-limit", "", "Storage limit of the PVC")
+	fs.StringVar(&simulateConfig.threshold, "threshold", "",
+		"Threshold of the free space of the PVC. Empty for --default-threshold.")
+	fs.StringVar(&simulateConfig.inodesThreshold, "inodes-threshold", "",
+		"Threshold of the free inodes of the PVC. Empty for --default-inodes-threshold. "+
+			"Evaluated only if the input has inodes.")
+	fs.StringVar(&simulateConfig.increase, "increase", "", "Amount to increase the PVC by. Empty for --default-increase.")
+	fs.StringVar(&config.defaultThreshold, "default-threshold", pvcautoresizer.DefaultThreshold,
+		"Threshold of the free space of the PVCs without the "+pvcautoresizer.ResizeThresholdAnnotation+" annotation")
+	fs.StringVar(&config.defaultInodesThreshold, "default-inodes-threshold", pvcautoresizer.DefaultInodesThreshold,
+		"Threshold of the free inodes of the PVCs without the "+pvcautoresizer.ResizeInodesThresholdAnnotation+
+			" annotation")
+	fs.StringVar(&config.defaultIncrease, "default-increase", pvcautoresizer.DefaultIncrease,
+		"Amount to increase the PVCs without the "+pvcautoresizer.ResizeIncreaseAnnotation+" annotation by")
+	fs.DurationVar(&simulateConfig.expansionDelay, "expansion-delay", 0,
+		"Time until a resize is reflected to the volume. 0 reflects it at the next sample.")
+	for _, name := range []string{"input", "initial-size", "storage-limit"} {
+		if err := simulateCmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	rootCmd.AddCommand(simulateCmd)
+}
+
+func simulate(cmd *cobra.Command) error {
+	initialSize, err := resource.ParseQuantity(simulateConfig.initialSize)
+	if err != nil {
+		return fmt.Errorf("invalid initial size: %w", err)
+	}
+	defaults, err := config.resizeDefaults()
+	if err != nil {
+		return err
+	}
+	format := simulateConfig.format
+	if format == "" {
+		format = simulator.FormatCSV
+		if strings.EqualFold(filepath.Ext(simulateConfig.input), ".json") {
+			format = simulator.FormatPrometheus
+		}
+	}
+
+	var in io.Reader = cmd.InOrStdin()
+	if simulateConfig.input != "-" {
+		f, err := os.Open(simulateConfig.input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	samples, err := simulator.ReadSamples(in, format)
+	if err != nil {
+		return err
+	}
+
+	res, err := simulator.Simulate(samples, simulator.Policy{
+		InitialSize:     initialSize,
+		StorageLimit:    simulateConfig.storageLimit,
+		Threshold:       simulateConfig.threshold,
+		InodesThreshold: simulateConfig.inodesThreshold,
+		Increase:        simulateConfig.increase,
+		Defaults:        defaults,
+		ExpansionDelay:  simulateConfig.expansionDelay,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch simulateConfig.output {
+	case "json":
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		return printSimulation(cmd.OutOrStdout(), len(samples), res)
+	}
+	return fmt.Errorf("unknown output format %q: must be text or json", simulateConfig.output)
+}
+
+func printSimulation(out io.Writer, numSamples int, res *simulator.Result) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tUSED\tCAPACITY\tNEW SIZE")
+	for _, e := range res.Timeline {
+		newSize := "-"
+		if e.NewSize != nil {
+			newSize = e.NewSize.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Type,
+			humanize.Bytes(e.UsedBytes), humanize.Bytes(e.CapacityBytes), newSize)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Samples:                 %d\n", numSamples)
+	fmt.Fprintf(out, "Expansions:              %d\n", res.Expansions)
+	fmt.Fprintf(out, "Final capacity:          %s\n", res.FinalCapacity.String())
+	fmt.Fprintf(out, "Peak over-provisioning:  %s (%.0f%% of the capacity) at %s\n",
+		humanize.Bytes(res.PeakOverProvisioningBytes), res.PeakOverProvisioningRatio*100,
+		res.PeakOverProvisioningTime.Format(time.RFC3339))
+	if len(res.FullPeriods) == 0 {
+		fmt.Fprintln(out, "Volume full:             never")
+		return nil
+	}
+	fmt.Fprintf(out, "Volume full:             %d time(s)\n", len(res.FullPeriods))
+	for _, p := range res.FullPeriods {
+		fmt.Fprintf(out, "  %s - %s\n", p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339))
+	}
+	return nil
+}
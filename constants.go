@@ -1,6 +1,8 @@
 package pvcautoresizer
 
 // AutoResizeEnabledKey is the key of flag that enables pvc-autoresizer.
+// PVCs override their StorageClasses with "true" or "false", and namespaces are opted out of
+// pvc-autoresizer by setting it to "false".
 const AutoResizeEnabledKey = "resize.topolvm.io/enabled"
 
 // ResizeThresholdAnnotation is the key of resize threshold.
@@ -18,6 +20,12 @@ const StorageLimitAnnotation = "resize.topolvm.io/storage_limit"
 // PreviousCapacityBytesAnnotation is the key of previous volume capacity.
 const PreviousCapacityBytesAnnotation = "resize.topolvm.io/pre_capacity_bytes"
 
+// ResizeStartedAtAnnotation is the key of the time when the ongoing resize was requested.
+const ResizeStartedAtAnnotation = "resize.topolvm.io/resize_started_at"
+
+// DesiredSizeAnnotation is the key of the storage request decided by the last resize.
+const DesiredSizeAnnotation = "resize.topolvm.io/desired_size"
+
 // InitialResizeGroupByAnnotation is the key of the initial-resize group by.
 const InitialResizeGroupByAnnotation = "resize.topolvm.io/initial-resize-group-by"
 
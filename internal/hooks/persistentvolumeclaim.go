@@ -9,8 +9,12 @@ import (
 	"github.com/go-logr/logr"
 	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
 	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -19,8 +23,12 @@ import (
 )
 
 //+kubebuilder:webhook:path=/pvc/mutate,mutating=true,failurePolicy=fail,sideEffects=None,groups="",resources=persistentvolumeclaims,verbs=create,versions=v1,name=mpersistentvolumeclaim.topolvm.io,admissionReviewVersions={v1}
+//+kubebuilder:webhook:path=/pvc/validate,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=persistentvolumeclaims,verbs=update,versions=v1,name=vpersistentvolumeclaim.topolvm.io,admissionReviewVersions={v1}
 
 type persistentVolumeClaimMutator struct {
+	// client reads the StorageClasses from the cache of the manager, so that the creations of PVCs
+	// do not wait for the API server only for the warnings.
+	client    client.Reader
 	apiReader client.Reader
 	dec       admission.Decoder
 	log       logr.Logger
@@ -29,13 +37,36 @@ type persistentVolumeClaimMutator struct {
 var _ admission.Handler = &persistentVolumeClaimMutator{}
 
 func (m *persistentVolumeClaimMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := startSpan(ctx, "PersistentVolumeClaimMutator.Handle", req,
+		tracing.PVCAttributes(req.Namespace, req.Name)...)
+	resp := m.handle(ctx, req)
+	endSpan(span, resp)
+	return resp
+}
+
+func (m *persistentVolumeClaimMutator) handle(ctx context.Context, req admission.Request) admission.Response {
 	if req.Operation != admissionv1.Create {
 		return admission.Allowed("not a Create request")
 	}
+	return m.handleCreate(ctx, req)
+}
+
+func (m *persistentVolumeClaimMutator) handleCreate(ctx context.Context, req admission.Request) admission.Response {
 	pvc := &corev1.PersistentVolumeClaim{}
 	if err := m.dec.Decode(req, pvc); err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	warnings := m.expansionWarnings(ctx, pvc)
+	resp := m.mutateCreate(ctx, req, pvc)
+	if resp.Allowed {
+		resp.Warnings = append(resp.Warnings, warnings...)
+	}
+	return resp
+}
+
+// mutateCreate sets the storage request of the PVC to the largest one in its initial-resize group.
+func (m *persistentVolumeClaimMutator) mutateCreate(ctx context.Context, req admission.Request,
+	pvc *corev1.PersistentVolumeClaim) admission.Response {
 	groupLabelKey, ok := pvc.Annotations[pvcautoresizer.InitialResizeGroupByAnnotation]
 	if !ok || groupLabelKey == "" {
 		return admission.Allowed("annotation not set")
@@ -53,25 +84,11 @@ func (m *persistentVolumeClaimMutator) Handle(ctx context.Context, req admission
 		return admission.Allowed("ignore the PVC because it has no storage limit annotation")
 	}
 
-	pvcList := &corev1.PersistentVolumeClaimList{}
-	err = m.apiReader.List(ctx, pvcList, &client.ListOptions{
-		Namespace:     pvc.Namespace,
-		LabelSelector: labels.SelectorFromSet(map[string]string{groupLabelKey: group}),
-	})
+	requestedSize := *pvc.Spec.Resources.Requests.Storage()
+	newSize, err := groupRequestSize(ctx, m.apiReader, pvc.Namespace, groupLabelKey, group, requestedSize, storageLimit)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
-
-	requestedSize := *pvc.Spec.Resources.Requests.Storage()
-	newSize := requestedSize
-	for _, item := range pvcList.Items {
-		if itemSize := item.Spec.Resources.Requests.Storage(); itemSize.Cmp(newSize) > 0 {
-			newSize = *itemSize
-		}
-	}
-	if newSize.Cmp(storageLimit) > 0 {
-		newSize = storageLimit
-	}
 	if requestedSize.Cmp(newSize) == 0 {
 		return admission.Allowed("PVC request storage size unchanged")
 	}
@@ -90,14 +107,132 @@ func (m *persistentVolumeClaimMutator) Handle(ctx context.Context, req admission
 	return admission.PatchResponseFromRaw(req.Object.Raw, data)
 }
 
+// expansionWarnings returns the warnings if the PVC has the storage limit but its volume cannot be
+// expanded. The PVC is not denied since the StorageClass may be fixed later. PVCs opting out of the
+// autoresize are not warned.
+func (m *persistentVolumeClaimMutator) expansionWarnings(ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim) []string {
+	storageLimit, err := runners.PvcStorageLimit(pvc)
+	if err != nil || storageLimit.IsZero() || pvc.Spec.StorageClassName == nil ||
+		!runners.IsAutoresizeEnabled(pvc, true) {
+		return nil
+	}
+	var sc storagev1.StorageClass
+	if err := m.client.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, &sc); err != nil {
+		if !apierrors.IsNotFound(err) {
+			m.log.Error(err, "failed to get StorageClass", "name", *pvc.Spec.StorageClassName)
+		}
+		return nil
+	}
+	if reason := runners.CheckVolumeExpansion(&sc); reason != "" {
+		return []string{fmt.Sprintf("PVC has %s annotation but may not be resized: %s",
+			pvcautoresizer.StorageLimitAnnotation, reason)}
+	}
+	return nil
+}
+
+// persistentVolumeClaimValidator validates the changes of the autoresize settings made by users.
+// It is registered separately from the mutator with failurePolicy=ignore, so updates of PVCs,
+// including the resizes by the controller, are not blocked while the webhook is unavailable.
+type persistentVolumeClaimValidator struct {
+	dec admission.Decoder
+	log logr.Logger
+}
+
+var _ admission.Handler = &persistentVolumeClaimValidator{}
+
+func (v *persistentVolumeClaimValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	_, span := startSpan(ctx, "PersistentVolumeClaimValidator.Handle", req,
+		tracing.PVCAttributes(req.Namespace, req.Name)...)
+	resp := v.handle(req)
+	endSpan(span, resp)
+	return resp
+}
+
+// handle validates an update. Updates that do not touch the storage limit or the resize group
+// are always allowed, so PVCs that were created before this validation existed can still be
+// updated.
+func (v *persistentVolumeClaimValidator) handle(req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Update {
+		return admission.Allowed("not an Update request")
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := v.dec.Decode(req, pvc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	oldPVC := &corev1.PersistentVolumeClaim{}
+	if err := v.dec.DecodeRaw(req.OldObject, oldPVC); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] != oldPVC.Annotations[pvcautoresizer.StorageLimitAnnotation] {
+		storageLimit, err := runners.PvcStorageLimit(pvc)
+		if err != nil {
+			return admission.Denied(fmt.Sprintf("invalid %s annotation: %v", pvcautoresizer.StorageLimitAnnotation, err))
+		}
+		capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+		if !storageLimit.IsZero() && ok && storageLimit.Cmp(capacity) < 0 {
+			return admission.Denied(fmt.Sprintf("%s annotation (%s) must not be lower than the current capacity (%s)",
+				pvcautoresizer.StorageLimitAnnotation, storageLimit.String(), capacity.String()))
+		}
+	}
+
+	groupLabelKey := pvc.Annotations[pvcautoresizer.InitialResizeGroupByAnnotation]
+	if groupLabelKey == "" {
+		return admission.Allowed("annotation not set")
+	}
+	oldGroupLabelKey := oldPVC.Annotations[pvcautoresizer.InitialResizeGroupByAnnotation]
+	if groupLabelKey == oldGroupLabelKey && pvc.Labels[groupLabelKey] == oldPVC.Labels[groupLabelKey] {
+		return admission.Allowed("resize group unchanged")
+	}
+	if pvc.Labels[groupLabelKey] == "" {
+		return admission.Denied(fmt.Sprintf("no value is set to the label key %s", groupLabelKey))
+	}
+
+	v.log.Info("resize group of the PVC is changed",
+		"name", pvc.Name,
+		"namespace", pvc.Namespace,
+		"from-group", oldPVC.Labels[oldGroupLabelKey],
+		"to-group", pvc.Labels[groupLabelKey],
+	)
+	return admission.Allowed("resize group changed")
+}
+
+// groupRequestSize returns the largest storage request among the PVCs in the resize group and
+// the requested size, capped by the storage limit.
+func groupRequestSize(ctx context.Context, apiReader client.Reader, namespace, groupLabelKey, group string,
+	requestedSize, storageLimit resource.Quantity) (resource.Quantity, error) {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	err := apiReader.List(ctx, pvcList, &client.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{groupLabelKey: group}),
+	})
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+
+	newSize := requestedSize
+	for _, item := range pvcList.Items {
+		if itemSize := item.Spec.Resources.Requests.Storage(); itemSize.Cmp(newSize) > 0 {
+			newSize = *itemSize
+		}
+	}
+	if newSize.Cmp(storageLimit) > 0 {
+		newSize = storageLimit
+	}
+	return newSize, nil
+}
+
 // SetupPersistentVolumeClaimWebhook registers the webhooks for PersistentVolumeClaim
 func SetupPersistentVolumeClaimWebhook(mgr manager.Manager, dec admission.Decoder, log logr.Logger) error {
 	serv := mgr.GetWebhookServer()
 	m := &persistentVolumeClaimMutator{
+		client:    mgr.GetClient(),
 		apiReader: mgr.GetAPIReader(),
 		dec:       dec,
 		log:       log,
 	}
 	serv.Register("/pvc/mutate", &webhook.Admission{Handler: m})
+	serv.Register("/pvc/validate", &webhook.Admission{Handler: &persistentVolumeClaimValidator{dec: dec, log: log}})
 	return nil
 }
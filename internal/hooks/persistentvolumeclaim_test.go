@@ -0,0 +1,103 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPersistentVolumeClaimValidator(t *testing.T) {
+	v := &persistentVolumeClaimValidator{dec: newTestDecoder(), log: logr.Discard()}
+	oldPVC := testGroupPVC("data-0", "db", "10Gi")
+	oldPVC.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+
+	testCases := []struct {
+		description string
+		mutate      func(pvc *corev1.PersistentVolumeClaim)
+		allowed     bool
+	}{
+		{"resize", func(pvc *corev1.PersistentVolumeClaim) {
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("11Gi")
+		}, true},
+		{"raise the storage limit", func(pvc *corev1.PersistentVolumeClaim) {
+			pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] = "30Gi"
+		}, true},
+		{"lower the storage limit below the capacity", func(pvc *corev1.PersistentVolumeClaim) {
+			pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] = "5Gi"
+		}, false},
+		{"set an invalid storage limit", func(pvc *corev1.PersistentVolumeClaim) {
+			pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] = "large"
+		}, false},
+		{"move to another group", func(pvc *corev1.PersistentVolumeClaim) {
+			pvc.Labels["group"] = "other"
+		}, true},
+		{"remove the group label", func(pvc *corev1.PersistentVolumeClaim) {
+			delete(pvc.Labels, "group")
+		}, false},
+	}
+	for _, tc := range testCases {
+		pvc := oldPVC.DeepCopy()
+		tc.mutate(pvc)
+		resp := v.Handle(context.Background(), testRequest(t, admissionv1.Update, pvc, oldPVC))
+		if resp.Allowed != tc.allowed {
+			t.Errorf("%s: allowed should be %t: %+v", tc.description, tc.allowed, resp.Result)
+		}
+	}
+}
+
+func TestPersistentVolumeClaimMutatorWarnings(t *testing.T) {
+	allowed := true
+	// The StorageClasses are only in the cache, so the API server is not read for the warnings.
+	cached := fake.NewClientBuilder().WithObjects(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "expandable"}, AllowVolumeExpansion: &allowed},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fixed"}},
+	).Build()
+	m := &persistentVolumeClaimMutator{
+		client:    cached,
+		apiReader: fake.NewClientBuilder().Build(),
+		dec:       newTestDecoder(),
+		log:       logr.Discard(),
+	}
+
+	testCases := []struct {
+		description  string
+		storageClass string
+		annotations  map[string]string
+		warned       bool
+	}{
+		{"expandable", "expandable", map[string]string{pvcautoresizer.StorageLimitAnnotation: "20Gi"}, false},
+		{"not expandable", "fixed", map[string]string{pvcautoresizer.StorageLimitAnnotation: "20Gi"}, true},
+		{"no storage limit", "fixed", nil, false},
+		{"opt out", "fixed", map[string]string{
+			pvcautoresizer.StorageLimitAnnotation: "20Gi",
+			pvcautoresizer.AutoResizeEnabledKey:   "false",
+		}, false},
+		{"missing StorageClass", "missing", map[string]string{pvcautoresizer.StorageLimitAnnotation: "20Gi"}, false},
+	}
+	for _, tc := range testCases {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "data", Annotations: tc.annotations},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &tc.storageClass,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				},
+			},
+		}
+		resp := m.Handle(context.Background(), testRequest(t, admissionv1.Create, pvc, nil))
+		if !resp.Allowed {
+			t.Errorf("%s: should be allowed: %+v", tc.description, resp.Result)
+		}
+		if warned := len(resp.Warnings) > 0; warned != tc.warned {
+			t.Errorf("%s: warned should be %t: %v", tc.description, tc.warned, resp.Warnings)
+		}
+	}
+}
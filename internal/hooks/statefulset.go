@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/statefulset/mutate,mutating=true,failurePolicy=fail,sideEffects=None,groups=apps,resources=statefulsets,verbs=create,versions=v1,name=mstatefulset.topolvm.io,admissionReviewVersions={v1}
+
+// statefulSetMutator sets the current size of the resize group to the volumeClaimTemplates of
+// a StatefulSet. Only Create requests are mutated because the API server forbids updating
+// volumeClaimTemplates of an existing StatefulSet.
+type statefulSetMutator struct {
+	apiReader client.Reader
+	dec       admission.Decoder
+	log       logr.Logger
+}
+
+var _ admission.Handler = &statefulSetMutator{}
+
+func (m *statefulSetMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := startSpan(ctx, "StatefulSetMutator.Handle", req,
+		tracing.NamespaceKey.String(req.Namespace), attribute.String("k8s.statefulset.name", req.Name))
+	resp := m.handle(ctx, req)
+	endSpan(span, resp)
+	return resp
+}
+
+func (m *statefulSetMutator) handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("not a Create request")
+	}
+	sts := &appsv1.StatefulSet{}
+	if err := m.dec.Decode(req, sts); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	mutated := false
+	for i := range sts.Spec.VolumeClaimTemplates {
+		vct := &sts.Spec.VolumeClaimTemplates[i]
+		groupLabelKey := vct.Annotations[pvcautoresizer.InitialResizeGroupByAnnotation]
+		if groupLabelKey == "" {
+			continue
+		}
+		group := vct.Labels[groupLabelKey]
+		if group == "" {
+			continue
+		}
+		storageLimit, err := runners.PvcStorageLimit(vct)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if storageLimit.IsZero() {
+			continue
+		}
+
+		requestedSize := *vct.Spec.Resources.Requests.Storage()
+		newSize, err := groupRequestSize(ctx, m.apiReader, sts.Namespace, groupLabelKey, group, requestedSize, storageLimit)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if requestedSize.Cmp(newSize) == 0 {
+			continue
+		}
+		if vct.Spec.Resources.Requests == nil {
+			vct.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		vct.Spec.Resources.Requests[corev1.ResourceStorage] = newSize
+		mutated = true
+
+		m.log.Info("need mutate the volumeClaimTemplate size",
+			"name", sts.Name,
+			"namespace", sts.Namespace,
+			"volumeClaimTemplate", vct.Name,
+			"from-request", requestedSize.Value(),
+			"to-request", newSize.Value(),
+		)
+	}
+	if !mutated {
+		return admission.Allowed("volumeClaimTemplates unchanged")
+	}
+
+	data, err := json.Marshal(sts)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, data)
+}
+
+// SetupStatefulSetWebhook registers the webhooks for StatefulSet
+func SetupStatefulSetWebhook(mgr manager.Manager, dec admission.Decoder, log logr.Logger) error {
+	serv := mgr.GetWebhookServer()
+	m := &statefulSetMutator{
+		apiReader: mgr.GetAPIReader(),
+		dec:       dec,
+		log:       log,
+	}
+	serv.Register("/statefulset/mutate", &webhook.Admission{Handler: m})
+	return nil
+}
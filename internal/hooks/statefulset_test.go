@@ -0,0 +1,103 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func testRequest(t *testing.T, op admissionv1.Operation, obj, oldObj client.Object) admission.Request {
+	t.Helper()
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: op,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}}
+	var err error
+	req.Object.Raw, err = json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldObj != nil {
+		req.OldObject.Raw, err = json.Marshal(oldObj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return req
+}
+
+func testGroupPVC(name, group, request string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{"group": group},
+			Annotations: map[string]string{
+				pvcautoresizer.InitialResizeGroupByAnnotation: "group",
+				pvcautoresizer.StorageLimitAnnotation:         "20Gi",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(request)},
+			},
+		},
+	}
+}
+
+func newTestDecoder() admission.Decoder {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	return admission.NewDecoder(scheme)
+}
+
+func TestStatefulSetMutator(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		testGroupPVC("data-0", "db", "10Gi"),
+		testGroupPVC("data-1", "db", "30Gi"),
+		testGroupPVC("other", "other", "15Gi"),
+	).Build()
+	m := &statefulSetMutator{apiReader: c, dec: newTestDecoder(), log: logr.Discard()}
+
+	unlimited := testGroupPVC("unlimited", "db", "5Gi")
+	delete(unlimited.Annotations, pvcautoresizer.StorageLimitAnnotation)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				*testGroupPVC("data", "db", "5Gi"),
+				*unlimited,
+				*testGroupPVC("ungrouped", "", "5Gi"),
+			},
+		},
+	}
+
+	resp := m.Handle(context.Background(), testRequest(t, admissionv1.Create, sts, nil))
+	if !resp.Allowed {
+		t.Fatalf("request is not allowed: %+v", resp.Result)
+	}
+	// The size of the group is capped by the storage limit 20Gi.
+	if len(resp.Patches) != 1 || resp.Patches[0].Path != "/spec/volumeClaimTemplates/0/spec/resources/requests/storage" ||
+		resp.Patches[0].Value != "20Gi" {
+		t.Errorf("unexpected patches: %+v", resp.Patches)
+	}
+
+	resp = m.Handle(context.Background(), testRequest(t, admissionv1.Update, sts, sts))
+	if !resp.Allowed || len(resp.Patches) != 0 {
+		t.Errorf("update is mutated: %+v", resp)
+	}
+}
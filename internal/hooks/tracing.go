@@ -0,0 +1,30 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// startSpan starts a span of the admission request. attrs identify the object of the request.
+func startSpan(ctx context.Context, name string, req admission.Request,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("k8s.admission.operation", string(req.Operation)),
+		attribute.String("k8s.admission.uid", string(req.UID)),
+	)
+	return tracing.Start(ctx, name, attrs...)
+}
+
+// endSpan records the result of the admission request to the span and ends it.
+func endSpan(span trace.Span, resp admission.Response) {
+	span.SetAttributes(attribute.Bool("k8s.admission.allowed", resp.Allowed))
+	if resp.Result != nil && resp.Result.Code >= 500 {
+		span.SetStatus(codes.Error, resp.Result.Message)
+	}
+	span.End()
+}
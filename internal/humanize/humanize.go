@@ -0,0 +1,29 @@
+// Package humanize formats values for the outputs of the commands.
+package humanize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Bytes returns the bytes in the binary SI units, rounded to a tenth if not exact.
+func Bytes(b int64) string {
+	if b < 1024 {
+		return strconv.FormatInt(b, 10)
+	}
+	if s := resource.NewQuantity(b, resource.BinarySI).String(); strings.HasSuffix(s, "i") {
+		return s
+	}
+	v, unit := float64(b), ""
+	for _, u := range []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei"} {
+		if v < 1024 {
+			break
+		}
+		v /= 1024
+		unit = u
+	}
+	return fmt.Sprintf("%.1f%s", v, unit)
+}
@@ -0,0 +1,24 @@
+package humanize
+
+import "testing"
+
+func TestBytes(t *testing.T) {
+	testCases := []struct {
+		bytes    int64
+		expected string
+	}{
+		{bytes: 0, expected: "0"},
+		{bytes: 1000, expected: "1000"},
+		{bytes: 1024, expected: "1Ki"},
+		{bytes: 1 << 30, expected: "1Gi"},
+		{bytes: 1536 << 20, expected: "1536Mi"},
+		{bytes: 1<<30 + 1, expected: "1.0Gi"},
+		{bytes: 1<<40 + 300<<30, expected: "1324Gi"},
+		{bytes: 1<<40 + 300<<30 + 1, expected: "1.3Ti"},
+	}
+	for _, tc := range testCases {
+		if actual := Bytes(tc.bytes); actual != tc.expected {
+			t.Errorf("Bytes(%d) = %q, expected %q", tc.bytes, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Aggregation levels of the per-PVC counters.
+const (
+	AggregationPVC          = "pvc"
+	AggregationNamespace    = "namespace"
+	AggregationStorageClass = "storageclass"
+)
+
+// CardinalityOptions holds the settings to bound the cardinality of the per-PVC metrics.
+type CardinalityOptions struct {
+	// Aggregation is the level which the per-PVC counters are aggregated to.
+	Aggregation string
+
+	// TopN limits the per-PVC gauges to the N PVCs with the highest volume usage ratio.
+	// 0 exports the gauges of all PVCs if Aggregation is AggregationPVC, and none otherwise.
+	TopN int
+}
+
+// PVCKey identifies a PVC in the metrics.
+type PVCKey struct {
+	Namespace string
+	Name      string
+}
+
+var (
+	cardinalityMu sync.Mutex
+	cardinality   = CardinalityOptions{Aggregation: AggregationPVC}
+
+	// pvcStorageClasses holds the StorageClass of the PVCs for AggregationStorageClass.
+	pvcStorageClasses = make(map[PVCKey]string)
+
+	// topPVCs is the set of the PVCs whose gauges are exported when TopN is set. nil means the set
+	// has not been decided yet.
+	topPVCs map[PVCKey]struct{}
+
+	// gaugePVCs is the set of the PVCs which have the per-PVC gauges.
+	gaugePVCs = make(map[PVCKey]struct{})
+)
+
+// pvcCounterDef defines a counter whose labels depend on the aggregation level.
+type pvcCounterDef struct {
+	vec    **prometheus.CounterVec
+	metric *prometheus.CounterVec
+	key    string
+	help   string
+}
+
+var pvcCounterDefs = []pvcCounterDef{
+	{&resizerSuccessResizeTotal, &ResizerSuccessResizeTotal.metric, ResizerSuccessResizeTotalKey,
+		"counter that indicates how many volume expansion processing resized succeed."},
+	{&resizerFailedResizeTotal, &ResizerFailedResizeTotal.metric, ResizerFailedResizeTotalKey,
+		"counter that indicates how many volume expansion processing resizes fail."},
+	{&resizerLimitReachedTotal, &ResizerLimitReachedTotal.metric, ResizerLimitReachedTotalKey,
+		"counter that indicates how many storage limits were reached."},
+	{&resizerQuotaExceededTotal, &ResizerQuotaExceededTotal.metric, ResizerQuotaExceededTotalKey,
+		"counter that indicates how many volume expansions were capped or blocked by resource quotas."},
+	{&resizerInsufficientBackendCapacityTotal, &ResizerInsufficientBackendCapacityTotal.metric,
+		ResizerInsufficientBackendCapacityTotalKey,
+		"counter that indicates how many volume expansions were capped or blocked by insufficient backend capacity."},
+	{&resizerBudgetExceededTotal, &ResizerBudgetExceededTotal.metric, ResizerBudgetExceededTotalKey,
+		"counter that indicates how many volume expansions were skipped by the growth budgets."},
+	{&resizerExternalReductionTotal, &ResizerExternalReductionTotal.metric, ResizerExternalReductionTotalKey,
+		"counter that indicates how many times the storage request was reduced by others after the resize."},
+	{&resizerExpansionUnsupportedTotal, &ResizerExpansionUnsupportedTotal.metric, ResizerExpansionUnsupportedTotalKey,
+		"counter that indicates how many volume expansions were skipped because the StorageClass does not allow them."},
+}
+
+// pvcGauges returns the gauges which have the labels identifying a PVC.
+func pvcGauges() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		resizerResizeStuck,
+		resizerFileSystemResizePending,
+		resizerConsecutiveFailures,
+		resizerResizeGaveUp,
+		resizerVolumeUsageRatio,
+		resizerResizeThresholdBytes,
+		resizerStorageLimitBytes,
+		resizerLimitHeadroomBytes,
+		resizerLimitUsedRatio,
+		resizerResizesRemaining,
+	}
+}
+
+func pvcCounterLabelNames() []string {
+	switch cardinality.Aggregation {
+	case AggregationNamespace:
+		return []string{"namespace"}
+	case AggregationStorageClass:
+		return []string{"storageclass"}
+	}
+	return []string{"persistentvolumeclaim", "namespace"}
+}
+
+func buildPVCCounters() {
+	labelNames := pvcCounterLabelNames()
+	for _, def := range pvcCounterDefs {
+		*def.vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      def.key,
+			Help:      def.help,
+		}, labelNames)
+		*def.metric = **def.vec
+	}
+}
+
+// pvcCounterCollector collects the current vector of a counter defined by pvcCounterDef. It is
+// registered as an unchecked collector, i.e. it describes no metrics, since the registry does
+// not allow changing the labels of a registered metric.
+type pvcCounterCollector struct {
+	vec **prometheus.CounterVec
+}
+
+func (c pvcCounterCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c pvcCounterCollector) Collect(ch chan<- prometheus.Metric) {
+	cardinalityMu.Lock()
+	vec := *c.vec
+	cardinalityMu.Unlock()
+	vec.Collect(ch)
+}
+
+// ConfigureCardinality changes the labels of the per-PVC metrics. It must be called before the
+// metrics are recorded.
+func ConfigureCardinality(opts CardinalityOptions) error {
+	switch opts.Aggregation {
+	case AggregationPVC, AggregationNamespace, AggregationStorageClass:
+	default:
+		return fmt.Errorf("unknown aggregation level %q", opts.Aggregation)
+	}
+	if opts.TopN < 0 {
+		return fmt.Errorf("top-N must not be negative: %d", opts.TopN)
+	}
+
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+	cardinality = opts
+	topPVCs = nil
+	buildPVCCounters()
+	return nil
+}
+
+func pvcCounterLabels(pvcname string, pvcns string) prometheus.Labels {
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+
+	switch cardinality.Aggregation {
+	case AggregationNamespace:
+		return prometheus.Labels{"namespace": pvcns}
+	case AggregationStorageClass:
+		return prometheus.Labels{"storageclass": pvcStorageClasses[PVCKey{Namespace: pvcns, Name: pvcname}]}
+	}
+	return prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}
+}
+
+// setPVCGauge sets the value of the per-PVC gauge if the gauges of the PVC are exported.
+func setPVCGauge(vec *prometheus.GaugeVec, pvcname string, pvcns string, value float64) {
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+
+	key := PVCKey{Namespace: pvcns, Name: pvcname}
+	if cardinality.TopN == 0 {
+		if cardinality.Aggregation != AggregationPVC {
+			return
+		}
+	} else if topPVCs != nil {
+		if _, ok := topPVCs[key]; !ok {
+			return
+		}
+	}
+	gaugePVCs[key] = struct{}{}
+	vec.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Set(value)
+}
+
+// deletePVCGauges deletes the per-PVC gauges of the PVC. cardinalityMu must be held.
+func deletePVCGauges(key PVCKey) {
+	labels := prometheus.Labels{"persistentvolumeclaim": key.Name, "namespace": key.Namespace}
+	for _, vec := range pvcGauges() {
+		vec.DeletePartialMatch(labels)
+	}
+	delete(gaugePVCs, key)
+}
+
+// TrackPVC records the StorageClass of the PVC to aggregate the counters by StorageClass.
+func TrackPVC(pvcname string, pvcns string, storageClass string) {
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+	if cardinality.Aggregation != AggregationStorageClass {
+		return
+	}
+	pvcStorageClasses[PVCKey{Namespace: pvcns, Name: pvcname}] = storageClass
+}
+
+// UpdateTopPVCs selects the PVCs whose gauges are exported from the volume usage ratios of the
+// PVCs, and deletes the gauges of the other PVCs. It does nothing unless TopN is set.
+func UpdateTopPVCs(usage map[PVCKey]float64) {
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+	if cardinality.TopN == 0 {
+		return
+	}
+
+	keys := make([]PVCKey, 0, len(usage))
+	for key := range usage {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if usage[keys[i]] != usage[keys[j]] {
+			return usage[keys[i]] > usage[keys[j]]
+		}
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	if len(keys) > cardinality.TopN {
+		keys = keys[:cardinality.TopN]
+	}
+
+	topPVCs = make(map[PVCKey]struct{}, len(keys))
+	for _, key := range keys {
+		topPVCs[key] = struct{}{}
+	}
+	for key := range gaugePVCs {
+		if _, ok := topPVCs[key]; !ok {
+			deletePVCGauges(key)
+		}
+	}
+}
+
+// DeletePVC deletes all the series of the PVC. It is called when the PVC is deleted.
+func DeletePVC(pvcname string, pvcns string) {
+	cardinalityMu.Lock()
+	defer cardinalityMu.Unlock()
+
+	key := PVCKey{Namespace: pvcns, Name: pvcname}
+	if cardinality.Aggregation == AggregationPVC {
+		labels := prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}
+		for _, def := range pvcCounterDefs {
+			(*def.vec).DeletePartialMatch(labels)
+		}
+	}
+	deletePVCGauges(key)
+	delete(pvcStorageClasses, key)
+	if topPVCs != nil {
+		delete(topPVCs, key)
+	}
+}
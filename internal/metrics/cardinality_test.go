@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func resetCardinality(t *testing.T) {
+	t.Helper()
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationPVC}); err != nil {
+		t.Fatalf("failed to reset cardinality: %v", err)
+	}
+	resetLabelHeavyMetrics()
+}
+
+func TestConfigureCardinalityInvalid(t *testing.T) {
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: "cluster"}); err == nil {
+		t.Fatalf("expected error for unknown aggregation level")
+	}
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationPVC, TopN: -1}); err == nil {
+		t.Fatalf("expected error for negative top-N")
+	}
+}
+
+func TestAggregationNamespace(t *testing.T) {
+	resetCardinality(t)
+	defer resetCardinality(t)
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationNamespace}); err != nil {
+		t.Fatalf("ConfigureCardinality returned error: %v", err)
+	}
+
+	ResizerSuccessResizeTotal.Increment("pvc-a", "ns-a")
+	ResizerSuccessResizeTotal.Increment("pvc-b", "ns-a")
+	if count := testutil.CollectAndCount(resizerSuccessResizeTotal); count != 1 {
+		t.Fatalf("series count is not %d: %d", 1, count)
+	}
+	if actual := testutil.ToFloat64(resizerSuccessResizeTotal); actual != float64(2) {
+		t.Fatalf("value is not %d", 2)
+	}
+
+	// The per-PVC gauges are not exported without top-N.
+	ResizerResizeStuck.Set("pvc-a", "ns-a", true)
+	if count := testutil.CollectAndCount(resizerResizeStuck); count != 0 {
+		t.Fatalf("series count is not %d: %d", 0, count)
+	}
+}
+
+func TestAggregationStorageClass(t *testing.T) {
+	resetCardinality(t)
+	defer resetCardinality(t)
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationStorageClass}); err != nil {
+		t.Fatalf("ConfigureCardinality returned error: %v", err)
+	}
+
+	TrackPVC("pvc-a", "ns-a", "sc-a")
+	TrackPVC("pvc-b", "ns-b", "sc-a")
+	TrackPVC("pvc-c", "ns-b", "sc-b")
+	ResizerFailedResizeTotal.Increment("pvc-a", "ns-a")
+	ResizerFailedResizeTotal.Increment("pvc-b", "ns-b")
+	ResizerFailedResizeTotal.Increment("pvc-c", "ns-b")
+	if count := testutil.CollectAndCount(resizerFailedResizeTotal); count != 2 {
+		t.Fatalf("series count is not %d: %d", 2, count)
+	}
+	if actual := testutil.ToFloat64(resizerFailedResizeTotal.WithLabelValues("sc-a")); actual != float64(2) {
+		t.Fatalf("value is not %d", 2)
+	}
+}
+
+func TestTopPVCs(t *testing.T) {
+	resetCardinality(t)
+	defer resetCardinality(t)
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationPVC, TopN: 1}); err != nil {
+		t.Fatalf("ConfigureCardinality returned error: %v", err)
+	}
+
+	// All PVCs are exported until the top-N PVCs are decided.
+	ResizerVolumeUsageRatio.Set("pvc-a", "ns-a", 0.9)
+	ResizerVolumeUsageRatio.Set("pvc-b", "ns-a", 0.1)
+	if count := testutil.CollectAndCount(resizerVolumeUsageRatio); count != 2 {
+		t.Fatalf("series count is not %d: %d", 2, count)
+	}
+
+	UpdateTopPVCs(map[PVCKey]float64{
+		{Namespace: "ns-a", Name: "pvc-a"}: 0.9,
+		{Namespace: "ns-a", Name: "pvc-b"}: 0.1,
+	})
+	if count := testutil.CollectAndCount(resizerVolumeUsageRatio); count != 1 {
+		t.Fatalf("series count is not %d: %d", 1, count)
+	}
+	ResizerVolumeUsageRatio.Set("pvc-b", "ns-a", 0.2)
+	if count := testutil.CollectAndCount(resizerVolumeUsageRatio); count != 1 {
+		t.Fatalf("series count is not %d: %d", 1, count)
+	}
+	if actual := testutil.ToFloat64(resizerVolumeUsageRatio); actual != 0.9 {
+		t.Fatalf("value is not %f", 0.9)
+	}
+}
+
+func TestDeletePVC(t *testing.T) {
+	resetCardinality(t)
+	defer resetCardinality(t)
+
+	ResizerSuccessResizeTotal.Increment("pvc-a", "ns-a")
+	ResizerSuccessResizeTotal.Increment("pvc-b", "ns-a")
+	ResizerResizeStuck.Set("pvc-a", "ns-a", true)
+
+	DeletePVC("pvc-a", "ns-a")
+	if count := testutil.CollectAndCount(resizerSuccessResizeTotal); count != 1 {
+		t.Fatalf("series count is not %d: %d", 1, count)
+	}
+	if count := testutil.CollectAndCount(resizerResizeStuck); count != 0 {
+		t.Fatalf("series count is not %d: %d", 0, count)
+	}
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Types of the metrics.
+const (
+	MetricTypeCounter   = "counter"
+	MetricTypeGauge     = "gauge"
+	MetricTypeHistogram = "histogram"
+)
+
+// maxDefinitionLabels is the upper bound of the number of the labels of a metric.
+const maxDefinitionLabels = 16
+
+// Definition describes a metric exported by pvc-autoresizer.
+type Definition struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// HasLabel returns true if the metric has the label.
+func (d Definition) HasLabel(label string) bool {
+	for _, l := range d.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+type typedCollector struct {
+	collector prometheus.Collector
+	typ       string
+}
+
+// definedCollectors returns the collectors of all the metrics with their types. The per-PVC
+// counters have the labels of the current aggregation level. cardinalityMu must be held.
+func definedCollectors() []typedCollector {
+	collectors := []typedCollector{
+		{kubernetesClientFailTotal, MetricTypeCounter},
+		{metricsClientFailTotal, MetricTypeCounter},
+		{resizerLoopSecondsTotal, MetricTypeCounter},
+	}
+	for _, def := range pvcCounterDefs {
+		collectors = append(collectors, typedCollector{*def.vec, MetricTypeCounter})
+	}
+	for _, vec := range pvcGauges() {
+		collectors = append(collectors, typedCollector{vec, MetricTypeGauge})
+	}
+	collectors = append(collectors,
+		typedCollector{resizerBudgetUsedBytes, MetricTypeGauge},
+		typedCollector{resizerCircuitBreakerOpen, MetricTypeGauge},
+		typedCollector{resizerTargetPVCs, MetricTypeGauge},
+		typedCollector{resizerExpansionDurationSeconds, MetricTypeHistogram},
+		typedCollector{resizerLoopDurationSeconds, MetricTypeHistogram},
+	)
+	return collectors
+}
+
+// constCollector collects the prepared metrics. It describes no metrics to be registered as an
+// unchecked collector.
+type constCollector []prometheus.Metric
+
+func (c constCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c constCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// sampleMetric returns a metric of the descriptor to find out its name and labels, since
+// prometheus.Desc does not expose them. The number of the labels is found by trial since the
+// constructors fail unless the number of the label values matches.
+func sampleMetric(desc *prometheus.Desc, typ string) (prometheus.Metric, error) {
+	var err error
+	for n := 0; n <= maxDefinitionLabels; n++ {
+		values := make([]string, n)
+		var m prometheus.Metric
+		switch typ {
+		case MetricTypeHistogram:
+			m, err = prometheus.NewConstHistogram(desc, 0, 0, nil, values...)
+		case MetricTypeCounter:
+			m, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, 0, values...)
+		default:
+			m, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, 0, values...)
+		}
+		if err == nil {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to sample metric %s: %w", desc, err)
+}
+
+// Definitions returns the definitions of all the metrics sorted by the name. The labels of the
+// per-PVC counters follow the aggregation level set by ConfigureCardinality.
+func Definitions() ([]Definition, error) {
+	cardinalityMu.Lock()
+	collectors := definedCollectors()
+	cardinalityMu.Unlock()
+
+	var samples constCollector
+	for _, c := range collectors {
+		ch := make(chan *prometheus.Desc, 1)
+		go func() {
+			c.collector.Describe(ch)
+			close(ch)
+		}()
+		for desc := range ch {
+			m, err := sampleMetric(desc, c.typ)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, m)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(samples); err != nil {
+		return nil, err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]Definition, 0, len(families))
+	for _, mf := range families {
+		def := Definition{
+			Name: mf.GetName(),
+			Help: mf.GetHelp(),
+			Type: definitionType(mf.GetType()),
+		}
+		for _, lp := range mf.GetMetric()[0].GetLabel() {
+			def.Labels = append(def.Labels, lp.GetName())
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+func definitionType(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return MetricTypeCounter
+	case dto.MetricType_HISTOGRAM:
+		return MetricTypeHistogram
+	}
+	return MetricTypeGauge
+}
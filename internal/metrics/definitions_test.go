@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func findDefinition(t *testing.T, defs []Definition, name string) Definition {
+	t.Helper()
+	for _, def := range defs {
+		if def.Name == name {
+			return def
+		}
+	}
+	t.Fatalf("definition of %s is not found", name)
+	return Definition{}
+}
+
+func TestDefinitions(t *testing.T) {
+	resetCardinality(t)
+	defs, err := Definitions()
+	if err != nil {
+		t.Fatalf("Definitions returned error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		typ    string
+		labels []string
+	}{
+		{"pvcautoresizer_kubernetes_client_fail_total", MetricTypeCounter, nil},
+		{"pvcautoresizer_success_resize_total", MetricTypeCounter, []string{"namespace", "persistentvolumeclaim"}},
+		{"pvcautoresizer_resize_stuck", MetricTypeGauge, []string{"namespace", "persistentvolumeclaim"}},
+		{"pvcautoresizer_circuit_breaker_open", MetricTypeGauge, []string{"name", "scope"}},
+		{"pvcautoresizer_expansion_duration_seconds", MetricTypeHistogram, []string{"storageclass"}},
+		{"pvcautoresizer_loop_duration_seconds", MetricTypeHistogram, nil},
+	} {
+		def := findDefinition(t, defs, tc.name)
+		if def.Type != tc.typ {
+			t.Errorf("type of %s is not %s: %s", tc.name, tc.typ, def.Type)
+		}
+		if !reflect.DeepEqual(def.Labels, tc.labels) {
+			t.Errorf("labels of %s are not %v: %v", tc.name, tc.labels, def.Labels)
+		}
+		if def.Help == "" {
+			t.Errorf("help of %s is empty", tc.name)
+		}
+	}
+	for i := 1; i < len(defs); i++ {
+		if defs[i-1].Name >= defs[i].Name {
+			t.Fatalf("definitions are not sorted: %s, %s", defs[i-1].Name, defs[i].Name)
+		}
+	}
+}
+
+func TestDefinitionsAggregation(t *testing.T) {
+	resetCardinality(t)
+	defer resetCardinality(t)
+	if err := ConfigureCardinality(CardinalityOptions{Aggregation: AggregationStorageClass}); err != nil {
+		t.Fatalf("ConfigureCardinality returned error: %v", err)
+	}
+
+	defs, err := Definitions()
+	if err != nil {
+		t.Fatalf("Definitions returned error: %v", err)
+	}
+	def := findDefinition(t, defs, "pvcautoresizer_failed_resize_total")
+	if !reflect.DeepEqual(def.Labels, []string{"storageclass"}) {
+		t.Fatalf("labels are not aggregated by storageclass: %v", def.Labels)
+	}
+	if !def.HasLabel("storageclass") || def.HasLabel("namespace") {
+		t.Fatalf("HasLabel returned unexpected results for %v", def.Labels)
+	}
+}
@@ -15,9 +15,31 @@ const (
 	ResizerFailedResizeTotalKey  = "failed_resize_total"
 	ResizerLoopSecondsTotalKey   = "loop_seconds_total"
 	ResizerLimitReachedTotalKey  = "limit_reached_total"
+	ResizerQuotaExceededTotalKey = "quota_exceeded_total"
+
+	ResizerInsufficientBackendCapacityTotalKey = "insufficient_backend_capacity_total"
+	ResizerResizeStuckKey                      = "resize_stuck"
+	ResizerFileSystemResizePendingKey          = "filesystem_resize_pending"
+	ResizerBudgetExceededTotalKey              = "budget_exceeded_total"
+	ResizerBudgetUsedBytesKey                  = "budget_used_bytes"
+	ResizerCircuitBreakerOpenKey               = "circuit_breaker_open"
+	ResizerConsecutiveFailuresKey              = "consecutive_failures"
+	ResizerResizeGaveUpKey                     = "resize_gave_up"
+	ResizerExternalReductionTotalKey           = "external_reduction_total"
+	ResizerExpansionUnsupportedTotalKey        = "expansion_unsupported_total"
+	ResizerVolumeUsageRatioKey                 = "volume_usage_ratio"
+	ResizerResizeThresholdBytesKey             = "resize_threshold_bytes"
+	ResizerStorageLimitBytesKey                = "storage_limit_bytes"
+	ResizerLimitHeadroomBytesKey               = "limit_headroom_bytes"
+	ResizerLimitUsedRatioKey                   = "limit_used_ratio"
+	ResizerResizesRemainingKey                 = "resizes_remaining"
+	ResizerExpansionDurationSecondsKey         = "expansion_duration_seconds"
+	ResizerLoopDurationSecondsKey              = "loop_duration_seconds"
+	ResizerTargetPVCsKey                       = "target_pvcs"
 )
 
 func init() {
+	buildPVCCounters()
 	registerResizerMetrics()
 }
 
@@ -26,13 +48,13 @@ type resizerSuccessResizeTotalAdapter struct {
 }
 
 func (a *resizerSuccessResizeTotalAdapter) Increment(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Inc()
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
 }
 
 // SpecifyLabels helps output metrics before the first resize event.
 // This method specifies the metric labels and add 0 to the metric value.
 func (a *resizerSuccessResizeTotalAdapter) SpecifyLabels(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Add(0)
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Add(0)
 }
 
 type resizerFailedResizeTotalAdapter struct {
@@ -40,13 +62,13 @@ type resizerFailedResizeTotalAdapter struct {
 }
 
 func (a *resizerFailedResizeTotalAdapter) Increment(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Inc()
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
 }
 
 // SpecifyLabels helps output metrics before the first fail event of resize.
 // This method specifies the metric labels and add 0 to the metric value.
 func (a *resizerFailedResizeTotalAdapter) SpecifyLabels(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Add(0)
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Add(0)
 }
 
 type resizerLoopSecondsTotalAdapter struct {
@@ -62,59 +84,336 @@ type resizerLimitReachedTotalAdapter struct {
 }
 
 func (a *resizerLimitReachedTotalAdapter) Increment(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Inc()
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
 }
 
 // SpecifyLabels helps output metrics before the first limit reached event of resize.
 // This method specifies the metric labels and add 0 to the metric value.
 func (a *resizerLimitReachedTotalAdapter) SpecifyLabels(pvcname string, pvcns string) {
-	a.metric.With(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns}).Add(0)
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Add(0)
+}
+
+type resizerQuotaExceededTotalAdapter struct {
+	metric prometheus.CounterVec
+}
+
+func (a *resizerQuotaExceededTotalAdapter) Increment(pvcname string, pvcns string) {
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
+}
+
+type resizerInsufficientBackendCapacityTotalAdapter struct {
+	metric prometheus.CounterVec
+}
+
+func (a *resizerInsufficientBackendCapacityTotalAdapter) Increment(pvcname string, pvcns string) {
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
+}
+
+// pvcBoolGauge is a per-PVC gauge which is 1 while the condition of the PVC holds, or 0 otherwise.
+type pvcBoolGauge struct {
+	metric prometheus.GaugeVec
+}
+
+func (g *pvcBoolGauge) Set(pvcname string, pvcns string, value bool) {
+	val := 0.0
+	if value {
+		val = 1.0
+	}
+	setPVCGauge(&g.metric, pvcname, pvcns, val)
+}
+
+func (g *pvcBoolGauge) Delete(pvcname string, pvcns string) {
+	g.metric.Delete(prometheus.Labels{"persistentvolumeclaim": pvcname, "namespace": pvcns})
+}
+
+type resizerBudgetExceededTotalAdapter struct {
+	metric prometheus.CounterVec
+}
+
+func (a *resizerBudgetExceededTotalAdapter) Increment(pvcname string, pvcns string) {
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
+}
+
+type resizerBudgetUsedBytesAdapter struct {
+	metric prometheus.GaugeVec
+}
+
+func (a *resizerBudgetUsedBytesAdapter) Set(scope string, name string, value float64) {
+	a.metric.With(prometheus.Labels{"scope": scope, "name": name}).Set(value)
+}
+
+func (a *resizerBudgetUsedBytesAdapter) Delete(scope string, name string) {
+	a.metric.Delete(prometheus.Labels{"scope": scope, "name": name})
+}
+
+type resizerCircuitBreakerOpenAdapter struct {
+	metric prometheus.GaugeVec
+}
+
+func (a *resizerCircuitBreakerOpenAdapter) Set(scope string, name string, open bool) {
+	val := 0.0
+	if open {
+		val = 1.0
+	}
+	a.metric.With(prometheus.Labels{"scope": scope, "name": name}).Set(val)
+}
+
+func (a *resizerCircuitBreakerOpenAdapter) Delete(scope string, name string) {
+	a.metric.Delete(prometheus.Labels{"scope": scope, "name": name})
+}
+
+type resizerConsecutiveFailuresAdapter struct {
+	metric prometheus.GaugeVec
+}
+
+func (a *resizerConsecutiveFailuresAdapter) Set(pvcname string, pvcns string, value float64) {
+	setPVCGauge(&a.metric, pvcname, pvcns, value)
+}
+
+type resizerExternalReductionTotalAdapter struct {
+	metric prometheus.CounterVec
+}
+
+func (a *resizerExternalReductionTotalAdapter) Increment(pvcname string, pvcns string) {
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
+}
+
+type resizerExpansionUnsupportedTotalAdapter struct {
+	metric prometheus.CounterVec
+}
+
+func (a *resizerExpansionUnsupportedTotalAdapter) Increment(pvcname string, pvcns string) {
+	a.metric.With(pvcCounterLabels(pvcname, pvcns)).Inc()
+}
+
+type resizerVolumeGaugeAdapter struct {
+	metric prometheus.GaugeVec
+}
+
+func (a *resizerVolumeGaugeAdapter) Set(pvcname string, pvcns string, value float64) {
+	setPVCGauge(&a.metric, pvcname, pvcns, value)
+}
+
+type resizerExpansionDurationSecondsAdapter struct {
+	metric prometheus.HistogramVec
+}
+
+func (a *resizerExpansionDurationSecondsAdapter) Observe(storageClass string, seconds float64) {
+	a.metric.With(prometheus.Labels{"storageclass": storageClass}).Observe(seconds)
+}
+
+type resizerLoopDurationSecondsAdapter struct {
+	metric prometheus.Histogram
+}
+
+func (a *resizerLoopDurationSecondsAdapter) Observe(seconds float64) {
+	a.metric.Observe(seconds)
+}
+
+type resizerTargetPVCsAdapter struct {
+	metric prometheus.GaugeVec
 }
 
+// Set sets the number of the target PVCs of each StorageClass. StorageClasses not in counts are
+// removed from the metric.
+func (a *resizerTargetPVCsAdapter) Set(counts map[string]int) {
+	a.metric.Reset()
+	for sc, count := range counts {
+		a.metric.With(prometheus.Labels{"storageclass": sc}).Set(float64(count))
+	}
+}
+
+// The counters which have the labels identifying a PVC are built by buildPVCCounters since their
+// labels depend on the aggregation level.
 var (
-	resizerSuccessResizeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: MetricsNamespace,
-		Name:      ResizerSuccessResizeTotalKey,
-		Help:      "counter that indicates how many volume expansion processing resized succeed.",
-	}, []string{"persistentvolumeclaim", "namespace"})
+	resizerSuccessResizeTotal               *prometheus.CounterVec
+	resizerFailedResizeTotal                *prometheus.CounterVec
+	resizerLimitReachedTotal                *prometheus.CounterVec
+	resizerQuotaExceededTotal               *prometheus.CounterVec
+	resizerInsufficientBackendCapacityTotal *prometheus.CounterVec
+	resizerBudgetExceededTotal              *prometheus.CounterVec
+	resizerExternalReductionTotal           *prometheus.CounterVec
+	resizerExpansionUnsupportedTotal        *prometheus.CounterVec
 
-	resizerFailedResizeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: MetricsNamespace,
-		Name:      ResizerFailedResizeTotalKey,
-		Help:      "counter that indicates how many volume expansion processing resizes fail.",
-	}, []string{"persistentvolumeclaim", "namespace"})
+	ResizerSuccessResizeTotal               *resizerSuccessResizeTotalAdapter               = &resizerSuccessResizeTotalAdapter{}
+	ResizerFailedResizeTotal                *resizerFailedResizeTotalAdapter                = &resizerFailedResizeTotalAdapter{}
+	ResizerLimitReachedTotal                *resizerLimitReachedTotalAdapter                = &resizerLimitReachedTotalAdapter{}
+	ResizerQuotaExceededTotal               *resizerQuotaExceededTotalAdapter               = &resizerQuotaExceededTotalAdapter{}
+	ResizerInsufficientBackendCapacityTotal *resizerInsufficientBackendCapacityTotalAdapter = &resizerInsufficientBackendCapacityTotalAdapter{}
+	ResizerBudgetExceededTotal              *resizerBudgetExceededTotalAdapter              = &resizerBudgetExceededTotalAdapter{}
+	ResizerExternalReductionTotal           *resizerExternalReductionTotalAdapter           = &resizerExternalReductionTotalAdapter{}
+	ResizerExpansionUnsupportedTotal        *resizerExpansionUnsupportedTotalAdapter        = &resizerExpansionUnsupportedTotalAdapter{}
+)
 
+var (
 	resizerLoopSecondsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: MetricsNamespace,
 		Name:      ResizerLoopSecondsTotalKey,
 		Help:      "counter that indicates the sum of seconds spent on volume expansion processing loops.",
 	})
 
-	resizerLimitReachedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	resizerResizeStuck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: MetricsNamespace,
-		Name:      ResizerLimitReachedTotalKey,
-		Help:      "counter that indicates how many storage limits were reached.",
+		Name:      ResizerResizeStuckKey,
+		Help:      "gauge that indicates whether the volume expansion has failed or not completed within the timeout.",
 	}, []string{"persistentvolumeclaim", "namespace"})
 
-	ResizerSuccessResizeTotal *resizerSuccessResizeTotalAdapter = &resizerSuccessResizeTotalAdapter{
-		metric: *resizerSuccessResizeTotal,
-	}
-	ResizerFailedResizeTotal *resizerFailedResizeTotalAdapter = &resizerFailedResizeTotalAdapter{
-		metric: *resizerFailedResizeTotal,
-	}
+	resizerFileSystemResizePending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerFileSystemResizePendingKey,
+		Help:      "gauge that indicates whether the filesystem expansion is pending until the volume is mounted.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerBudgetUsedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerBudgetUsedBytesKey,
+		Help:      "gauge that indicates the bytes added to PVCs in the scope of the growth budget within the last hour.",
+	}, []string{"scope", "name"})
+
+	resizerCircuitBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerCircuitBreakerOpenKey,
+		Help:      "gauge that indicates whether resizing in the scope is paused because the growth budget is exceeded.",
+	}, []string{"scope", "name"})
+
+	resizerConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerConsecutiveFailuresKey,
+		Help:      "gauge that indicates the number of consecutive resize failures of the PVC.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerResizeGaveUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerResizeGaveUpKey,
+		Help:      "gauge that indicates whether the resizer gave up resizing the PVC after consecutive failures.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerVolumeUsageRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerVolumeUsageRatioKey,
+		Help:      "gauge that indicates the ratio of the used bytes to the capacity of the volume.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerResizeThresholdBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerResizeThresholdBytesKey,
+		Help:      "gauge that indicates the available bytes of the volume below which the volume is resized.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerStorageLimitBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerStorageLimitBytesKey,
+		Help:      "gauge that indicates the storage limit of the PVC.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerLimitHeadroomBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerLimitHeadroomBytesKey,
+		Help:      "gauge that indicates the bytes by which the volume can still be expanded before reaching the storage limit.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerLimitUsedRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerLimitUsedRatioKey,
+		Help:      "gauge that indicates the ratio of the capacity of the volume to the storage limit.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerResizesRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerResizesRemainingKey,
+		Help:      "gauge that indicates the estimated number of the resizes remaining until the storage limit.",
+	}, []string{"persistentvolumeclaim", "namespace"})
+
+	resizerExpansionDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerExpansionDurationSecondsKey,
+		Help:      "histogram of the seconds from requesting the volume expansion to the change of the filesystem capacity.",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 12),
+	}, []string{"storageclass"})
+
+	resizerLoopDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerLoopDurationSecondsKey,
+		Help:      "histogram of the seconds spent on a volume expansion processing loop.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+
+	resizerTargetPVCs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      ResizerTargetPVCsKey,
+		Help:      "gauge that indicates the number of PVCs targeted by the resizer.",
+	}, []string{"storageclass"})
+
 	ResizerLoopSecondsTotal *resizerLoopSecondsTotalAdapter = &resizerLoopSecondsTotalAdapter{
 		metric: resizerLoopSecondsTotal,
 	}
-	ResizerLimitReachedTotal *resizerLimitReachedTotalAdapter = &resizerLimitReachedTotalAdapter{
-		metric: *resizerLimitReachedTotal,
+	ResizerResizeStuck *pvcBoolGauge = &pvcBoolGauge{
+		metric: *resizerResizeStuck,
+	}
+	ResizerFileSystemResizePending *pvcBoolGauge = &pvcBoolGauge{
+		metric: *resizerFileSystemResizePending,
+	}
+	ResizerBudgetUsedBytes *resizerBudgetUsedBytesAdapter = &resizerBudgetUsedBytesAdapter{
+		metric: *resizerBudgetUsedBytes,
+	}
+	ResizerCircuitBreakerOpen *resizerCircuitBreakerOpenAdapter = &resizerCircuitBreakerOpenAdapter{
+		metric: *resizerCircuitBreakerOpen,
+	}
+	ResizerConsecutiveFailures *resizerConsecutiveFailuresAdapter = &resizerConsecutiveFailuresAdapter{
+		metric: *resizerConsecutiveFailures,
+	}
+	ResizerResizeGaveUp *pvcBoolGauge = &pvcBoolGauge{
+		metric: *resizerResizeGaveUp,
+	}
+	ResizerVolumeUsageRatio *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerVolumeUsageRatio,
+	}
+	ResizerResizeThresholdBytes *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerResizeThresholdBytes,
+	}
+	ResizerStorageLimitBytes *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerStorageLimitBytes,
+	}
+	ResizerLimitHeadroomBytes *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerLimitHeadroomBytes,
+	}
+	ResizerLimitUsedRatio *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerLimitUsedRatio,
+	}
+	ResizerResizesRemaining *resizerVolumeGaugeAdapter = &resizerVolumeGaugeAdapter{
+		metric: *resizerResizesRemaining,
+	}
+	ResizerExpansionDurationSeconds *resizerExpansionDurationSecondsAdapter = &resizerExpansionDurationSecondsAdapter{
+		metric: *resizerExpansionDurationSeconds,
+	}
+	ResizerLoopDurationSeconds *resizerLoopDurationSecondsAdapter = &resizerLoopDurationSecondsAdapter{
+		metric: resizerLoopDurationSeconds,
+	}
+	ResizerTargetPVCs *resizerTargetPVCsAdapter = &resizerTargetPVCsAdapter{
+		metric: *resizerTargetPVCs,
 	}
 )
 
 func registerResizerMetrics() {
-	runtimemetrics.Registry.MustRegister(resizerSuccessResizeTotal)
-	runtimemetrics.Registry.MustRegister(resizerFailedResizeTotal)
+	for _, def := range pvcCounterDefs {
+		runtimemetrics.Registry.MustRegister(pvcCounterCollector{vec: def.vec})
+	}
 	runtimemetrics.Registry.MustRegister(resizerLoopSecondsTotal)
-	runtimemetrics.Registry.MustRegister(resizerLimitReachedTotal)
+	runtimemetrics.Registry.MustRegister(resizerResizeStuck)
+	runtimemetrics.Registry.MustRegister(resizerFileSystemResizePending)
+	runtimemetrics.Registry.MustRegister(resizerBudgetUsedBytes)
+	runtimemetrics.Registry.MustRegister(resizerCircuitBreakerOpen)
+	runtimemetrics.Registry.MustRegister(resizerConsecutiveFailures)
+	runtimemetrics.Registry.MustRegister(resizerResizeGaveUp)
+	runtimemetrics.Registry.MustRegister(resizerVolumeUsageRatio)
+	runtimemetrics.Registry.MustRegister(resizerResizeThresholdBytes)
+	runtimemetrics.Registry.MustRegister(resizerStorageLimitBytes)
+	runtimemetrics.Registry.MustRegister(resizerLimitHeadroomBytes)
+	runtimemetrics.Registry.MustRegister(resizerLimitUsedRatio)
+	runtimemetrics.Registry.MustRegister(resizerResizesRemaining)
+	runtimemetrics.Registry.MustRegister(resizerExpansionDurationSeconds)
+	runtimemetrics.Registry.MustRegister(resizerLoopDurationSeconds)
+	runtimemetrics.Registry.MustRegister(resizerTargetPVCs)
 }
 
 // currentMetricsSizeBytes returns the byte size of all metrics encoded in the
@@ -139,6 +438,21 @@ func resetLabelHeavyMetrics() {
 	resizerSuccessResizeTotal.Reset()
 	resizerFailedResizeTotal.Reset()
 	resizerLimitReachedTotal.Reset()
+	resizerQuotaExceededTotal.Reset()
+	resizerInsufficientBackendCapacityTotal.Reset()
+	resizerResizeStuck.Reset()
+	resizerFileSystemResizePending.Reset()
+	resizerBudgetExceededTotal.Reset()
+	resizerConsecutiveFailures.Reset()
+	resizerResizeGaveUp.Reset()
+	resizerExternalReductionTotal.Reset()
+	resizerExpansionUnsupportedTotal.Reset()
+	resizerVolumeUsageRatio.Reset()
+	resizerResizeThresholdBytes.Reset()
+	resizerStorageLimitBytes.Reset()
+	resizerLimitHeadroomBytes.Reset()
+	resizerLimitUsedRatio.Reset()
+	resizerResizesRemaining.Reset()
 }
 
 // ResetMetricsIfExceedsThreshold checks the total size of all registered metrics and
@@ -104,3 +104,150 @@ func TestResizerLimitReachedTotal(t *testing.T) {
 		t.Fatalf("value is not %d", 1)
 	}
 }
+
+func TestResizerQuotaExceededTotal(t *testing.T) {
+	ResizerQuotaExceededTotal.Increment("my-test-pvc", "my-test-namespace")
+	actual := testutil.ToFloat64(resizerQuotaExceededTotal)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerInsufficientBackendCapacityTotal(t *testing.T) {
+	ResizerInsufficientBackendCapacityTotal.Increment("my-test-pvc", "my-test-namespace")
+	actual := testutil.ToFloat64(resizerInsufficientBackendCapacityTotal)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerResizeStuck(t *testing.T) {
+	ResizerResizeStuck.Set("my-test-pvc", "my-test-namespace", true)
+	actual := testutil.ToFloat64(resizerResizeStuck)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+
+	ResizerResizeStuck.Set("my-test-pvc", "my-test-namespace", false)
+	actual = testutil.ToFloat64(resizerResizeStuck)
+	if actual != float64(0) {
+		t.Fatalf("value is not %d", 0)
+	}
+	ResizerResizeStuck.Delete("my-test-pvc", "my-test-namespace")
+	if count := testutil.CollectAndCount(resizerResizeStuck); count != 0 {
+		t.Fatalf("gauge is not deleted: %d", count)
+	}
+}
+
+func TestResizerFileSystemResizePending(t *testing.T) {
+	ResizerFileSystemResizePending.Set("my-test-pvc", "my-test-namespace", true)
+	actual := testutil.ToFloat64(resizerFileSystemResizePending)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerBudgetExceededTotal(t *testing.T) {
+	ResizerBudgetExceededTotal.Increment("my-test-pvc", "my-test-namespace")
+	actual := testutil.ToFloat64(resizerBudgetExceededTotal)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerBudgetUsedBytes(t *testing.T) {
+	ResizerBudgetUsedBytes.Set("namespace", "my-test-namespace", 1<<30)
+	actual := testutil.ToFloat64(resizerBudgetUsedBytes)
+	if actual != float64(1<<30) {
+		t.Fatalf("value is not %d", 1<<30)
+	}
+}
+
+func TestResizerCircuitBreakerOpen(t *testing.T) {
+	ResizerCircuitBreakerOpen.Set("cluster", "", true)
+	actual := testutil.ToFloat64(resizerCircuitBreakerOpen)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerConsecutiveFailures(t *testing.T) {
+	ResizerConsecutiveFailures.Set("my-test-pvc", "my-test-namespace", 3)
+	actual := testutil.ToFloat64(resizerConsecutiveFailures)
+	if actual != float64(3) {
+		t.Fatalf("value is not %d", 3)
+	}
+}
+
+func TestResizerResizeGaveUp(t *testing.T) {
+	ResizerResizeGaveUp.Set("my-test-pvc", "my-test-namespace", true)
+	actual := testutil.ToFloat64(resizerResizeGaveUp)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerExternalReductionTotal(t *testing.T) {
+	ResizerExternalReductionTotal.Increment("my-test-pvc", "my-test-namespace")
+	actual := testutil.ToFloat64(resizerExternalReductionTotal)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerExpansionUnsupportedTotal(t *testing.T) {
+	ResizerExpansionUnsupportedTotal.Increment("my-test-pvc", "my-test-namespace")
+	actual := testutil.ToFloat64(resizerExpansionUnsupportedTotal)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
+
+func TestResizerVolumeGauges(t *testing.T) {
+	for _, tc := range []struct {
+		adapter *resizerVolumeGaugeAdapter
+		vec     *prometheus.GaugeVec
+	}{
+		{ResizerVolumeUsageRatio, resizerVolumeUsageRatio},
+		{ResizerResizeThresholdBytes, resizerResizeThresholdBytes},
+		{ResizerStorageLimitBytes, resizerStorageLimitBytes},
+		{ResizerLimitHeadroomBytes, resizerLimitHeadroomBytes},
+		{ResizerLimitUsedRatio, resizerLimitUsedRatio},
+		{ResizerResizesRemaining, resizerResizesRemaining},
+	} {
+		tc.adapter.Set("my-test-pvc", "my-test-namespace", 0.5)
+		actual := testutil.ToFloat64(tc.vec)
+		if actual != 0.5 {
+			t.Fatalf("value is not %f", 0.5)
+		}
+	}
+}
+
+func TestResizerExpansionDurationSeconds(t *testing.T) {
+	ResizerExpansionDurationSeconds.Observe("my-test-sc", 30)
+	if count := testutil.CollectAndCount(resizerExpansionDurationSeconds); count != 1 {
+		t.Fatalf("count is not %d", 1)
+	}
+}
+
+func TestResizerLoopDurationSeconds(t *testing.T) {
+	ResizerLoopDurationSeconds.Observe(0.5)
+	if count := testutil.CollectAndCount(resizerLoopDurationSeconds); count != 1 {
+		t.Fatalf("count is not %d", 1)
+	}
+}
+
+func TestResizerTargetPVCs(t *testing.T) {
+	ResizerTargetPVCs.Set(map[string]int{"sc-a": 2, "sc-b": 3})
+	if count := testutil.CollectAndCount(resizerTargetPVCs); count != 2 {
+		t.Fatalf("count is not %d", 2)
+	}
+	ResizerTargetPVCs.Set(map[string]int{"sc-a": 1})
+	if count := testutil.CollectAndCount(resizerTargetPVCs); count != 1 {
+		t.Fatalf("count is not %d", 1)
+	}
+	actual := testutil.ToFloat64(resizerTargetPVCs)
+	if actual != float64(1) {
+		t.Fatalf("value is not %d", 1)
+	}
+}
@@ -0,0 +1,150 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+)
+
+const (
+	// DashboardUID is the UID of the generated Grafana dashboard.
+	DashboardUID = "pvc-autoresizer"
+
+	dashboardSchemaVersion = 39
+	panelWidth             = 12
+	panelHeight            = 8
+)
+
+type dashboardTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+// panelUnit returns the unit of the panel of the metric from the suffix of the name.
+func panelUnit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_bytes"):
+		return "bytes"
+	case strings.HasSuffix(name, "_seconds"), strings.HasSuffix(name, "_seconds_total"):
+		return "s"
+	case strings.HasSuffix(name, "_ratio"):
+		return "percentunit"
+	}
+	return "short"
+}
+
+// selector returns the label selector of the dashboard variables applicable to the metric.
+func selector(def metrics.Definition) string {
+	if def.HasLabel("namespace") {
+		return `{namespace=~"$namespace"}`
+	}
+	return ""
+}
+
+func legend(labels []string) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, "{{"+l+"}}")
+	}
+	return strings.Join(parts, "/")
+}
+
+func panelTargets(def metrics.Definition) []dashboardTarget {
+	sel := selector(def)
+	switch def.Type {
+	case metrics.MetricTypeCounter:
+		return []dashboardTarget{{
+			Expr:         fmt.Sprintf("sum%s (rate(%s%s[$__rate_interval]))", byClause(def.Labels), def.Name, sel),
+			LegendFormat: legend(def.Labels),
+			RefID:        "A",
+		}}
+	case metrics.MetricTypeHistogram:
+		targets := make([]dashboardTarget, 0, len(histogramQuantiles))
+		for i, q := range histogramQuantiles {
+			lf := fmt.Sprintf("p%g", q*100)
+			if len(def.Labels) > 0 {
+				lf += " " + legend(def.Labels)
+			}
+			targets = append(targets, dashboardTarget{
+				Expr: fmt.Sprintf("histogram_quantile(%g, sum%s (rate(%s_bucket%s[$__rate_interval])))",
+					q, byClause(append([]string{"le"}, def.Labels...)), def.Name, sel),
+				LegendFormat: lf,
+				RefID:        string(rune('A' + i)),
+			})
+		}
+		return targets
+	}
+	return []dashboardTarget{{
+		Expr:         def.Name + sel,
+		LegendFormat: legend(def.Labels),
+		RefID:        "A",
+	}}
+}
+
+// Dashboard returns the JSON of the Grafana dashboard with a panel for each metric.
+func Dashboard(defs []metrics.Definition) ([]byte, error) {
+	datasource := map[string]any{"type": "prometheus", "uid": "${datasource}"}
+
+	panels := make([]map[string]any, 0, len(defs))
+	namespaceSource := ""
+	for i, def := range defs {
+		if namespaceSource == "" && def.HasLabel("namespace") && def.Type == metrics.MetricTypeGauge {
+			namespaceSource = def.Name
+		}
+		panels = append(panels, map[string]any{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       strings.TrimPrefix(def.Name, metrics.MetricsNamespace+"_"),
+			"description": def.Help,
+			"datasource":  datasource,
+			"gridPos": map[string]int{
+				"x": (i % 2) * panelWidth,
+				"y": (i / 2) * panelHeight,
+				"w": panelWidth,
+				"h": panelHeight,
+			},
+			"fieldConfig": map[string]any{
+				"defaults":  map[string]any{"unit": panelUnit(def.Name)},
+				"overrides": []any{},
+			},
+			"targets": panelTargets(def),
+		})
+	}
+
+	variables := []map[string]any{{
+		"name":  "datasource",
+		"label": "Data source",
+		"type":  "datasource",
+		"query": "prometheus",
+	}}
+	if namespaceSource != "" {
+		variables = append(variables, map[string]any{
+			"name":       "namespace",
+			"label":      "Namespace",
+			"type":       "query",
+			"datasource": datasource,
+			"query":      fmt.Sprintf("label_values(%s, namespace)", namespaceSource),
+			"refresh":    2,
+			"multi":      true,
+			"includeAll": true,
+			"allValue":   ".*",
+			"current":    map[string]any{"text": "All", "value": "$__all"},
+		})
+	}
+
+	dashboard := map[string]any{
+		"uid":           DashboardUID,
+		"title":         "pvc-autoresizer",
+		"tags":          []string{"pvc-autoresizer"},
+		"editable":      true,
+		"schemaVersion": dashboardSchemaVersion,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating":    map[string]any{"list": variables},
+		"panels":        panels,
+	}
+	return json.MarshalIndent(dashboard, "", "  ")
+}
@@ -0,0 +1,160 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+var testDefinitions = []metrics.Definition{
+	{
+		Name:   "pvcautoresizer_failed_resize_total",
+		Help:   "counter that indicates how many volume expansion processing resizes fail.",
+		Type:   metrics.MetricTypeCounter,
+		Labels: []string{"namespace", "persistentvolumeclaim"},
+	},
+	{
+		Name:   "pvcautoresizer_loop_duration_seconds",
+		Help:   "histogram of the seconds spent on a volume expansion processing loop.",
+		Type:   metrics.MetricTypeHistogram,
+		Labels: nil,
+	},
+	{
+		Name:   "pvcautoresizer_resize_stuck",
+		Help:   "gauge that indicates whether the volume expansion of the PVC is stuck.",
+		Type:   metrics.MetricTypeGauge,
+		Labels: []string{"namespace", "persistentvolumeclaim"},
+	},
+}
+
+func TestAlertMetricsExist(t *testing.T) {
+	defs, err := metrics.Definitions()
+	if err != nil {
+		t.Fatalf("Definitions returned error: %v", err)
+	}
+	names := make(map[string]struct{}, len(defs))
+	for _, def := range defs {
+		names[def.Name] = struct{}{}
+	}
+	for _, a := range alertDefs {
+		if _, ok := names[a.metric]; !ok {
+			t.Errorf("metric %s of alert %s is not defined", a.metric, a.name)
+		}
+	}
+}
+
+func TestPrometheusRule(t *testing.T) {
+	out, err := PrometheusRule(testDefinitions, Options{
+		Name:      "pvc-autoresizer",
+		Namespace: "monitoring",
+		Labels:    map[string]string{"release": "prometheus"},
+	})
+	if err != nil {
+		t.Fatalf("PrometheusRule returned error: %v", err)
+	}
+	var pr prometheusRule
+	if err := yaml.Unmarshal(out, &pr); err != nil {
+		t.Fatalf("failed to unmarshal PrometheusRule: %v", err)
+	}
+	if pr.Kind != "PrometheusRule" || pr.Metadata.Namespace != "monitoring" || pr.Metadata.Labels["release"] != "prometheus" {
+		t.Fatalf("unexpected metadata: %+v %+v", pr.Kind, pr.Metadata)
+	}
+
+	records := pr.Spec.Groups[0].Rules
+	expected := []rule{
+		{
+			Record: "namespace_persistentvolumeclaim:pvcautoresizer_failed_resize_total:rate5m",
+			Expr:   "sum by (namespace, persistentvolumeclaim) (rate(pvcautoresizer_failed_resize_total[5m]))",
+		},
+		{
+			Record: "job:pvcautoresizer_loop_duration_seconds:p50",
+			Expr:   "histogram_quantile(0.5, sum by (le) (rate(pvcautoresizer_loop_duration_seconds_bucket[5m])))",
+		},
+		{
+			Record: "job:pvcautoresizer_loop_duration_seconds:p90",
+			Expr:   "histogram_quantile(0.9, sum by (le) (rate(pvcautoresizer_loop_duration_seconds_bucket[5m])))",
+		},
+		{
+			Record: "job:pvcautoresizer_loop_duration_seconds:p99",
+			Expr:   "histogram_quantile(0.99, sum by (le) (rate(pvcautoresizer_loop_duration_seconds_bucket[5m])))",
+		},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("number of recording rules is not %d: %+v", len(expected), records)
+	}
+	for i := range expected {
+		if records[i].Record != expected[i].Record || records[i].Expr != expected[i].Expr {
+			t.Errorf("recording rule is not %+v: %+v", expected[i], records[i])
+		}
+	}
+
+	alerts := pr.Spec.Groups[1].Rules
+	if len(alerts) != 2 {
+		t.Fatalf("number of alerting rules is not 2: %+v", alerts)
+	}
+	if alerts[0].Alert != "PVCAutoresizerResizeFailing" ||
+		alerts[0].Expr != "sum by (namespace, persistentvolumeclaim) (increase(pvcautoresizer_failed_resize_total[15m])) > 0" {
+		t.Errorf("unexpected alerting rule: %+v", alerts[0])
+	}
+	if alerts[1].Alert != "PVCAutoresizerExpansionStuck" || alerts[1].Expr != "pvcautoresizer_resize_stuck == 1" ||
+		alerts[1].For != "15m" || alerts[1].Labels["severity"] != "warning" ||
+		alerts[1].Annotations["summary"] != "Volume expansion of PVC failed or has not completed: "+
+			"{{ $labels.namespace }}/{{ $labels.persistentvolumeclaim }}" {
+		t.Errorf("unexpected alerting rule: %+v", alerts[1])
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	out, err := Dashboard(testDefinitions)
+	if err != nil {
+		t.Fatalf("Dashboard returned error: %v", err)
+	}
+	var dashboard struct {
+		UID        string `json:"uid"`
+		Templating struct {
+			List []struct {
+				Name  string `json:"name"`
+				Query string `json:"query"`
+			} `json:"list"`
+		} `json:"templating"`
+		Panels []struct {
+			Title       string `json:"title"`
+			FieldConfig struct {
+				Defaults struct {
+					Unit string `json:"unit"`
+				} `json:"defaults"`
+			} `json:"fieldConfig"`
+			Targets []dashboardTarget `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(out, &dashboard); err != nil {
+		t.Fatalf("failed to unmarshal dashboard: %v", err)
+	}
+	if dashboard.UID != DashboardUID {
+		t.Errorf("uid is not %s: %s", DashboardUID, dashboard.UID)
+	}
+	if len(dashboard.Templating.List) != 2 || dashboard.Templating.List[1].Query != "label_values(pvcautoresizer_resize_stuck, namespace)" {
+		t.Errorf("unexpected variables: %+v", dashboard.Templating.List)
+	}
+	if len(dashboard.Panels) != len(testDefinitions) {
+		t.Fatalf("number of panels is not %d: %d", len(testDefinitions), len(dashboard.Panels))
+	}
+
+	counter := dashboard.Panels[0]
+	if counter.Title != "failed_resize_total" || counter.Targets[0].Expr !=
+		`sum by (namespace, persistentvolumeclaim) (rate(pvcautoresizer_failed_resize_total{namespace=~"$namespace"}[$__rate_interval]))` ||
+		counter.Targets[0].LegendFormat != "{{namespace}}/{{persistentvolumeclaim}}" {
+		t.Errorf("unexpected counter panel: %+v", counter)
+	}
+	histogram := dashboard.Panels[1]
+	if histogram.FieldConfig.Defaults.Unit != "s" || len(histogram.Targets) != 3 || histogram.Targets[2].Expr !=
+		"histogram_quantile(0.99, sum by (le) (rate(pvcautoresizer_loop_duration_seconds_bucket[$__rate_interval])))" {
+		t.Errorf("unexpected histogram panel: %+v", histogram)
+	}
+	gauge := dashboard.Panels[2]
+	if gauge.Targets[0].Expr != `pvcautoresizer_resize_stuck{namespace=~"$namespace"}` {
+		t.Errorf("unexpected gauge panel: %+v", gauge)
+	}
+}
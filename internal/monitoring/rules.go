@@ -0,0 +1,243 @@
+package monitoring
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+// Options holds the settings of the generated PrometheusRule.
+type Options struct {
+	// Name is the name of the PrometheusRule.
+	Name string
+
+	// Namespace is the namespace of the PrometheusRule. Empty omits it.
+	Namespace string
+
+	// Labels are the labels of the PrometheusRule, e.g. to be selected by the Prometheus.
+	Labels map[string]string
+}
+
+type prometheusRule struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Metadata   prometheusRuleMeta `json:"metadata"`
+	Spec       prometheusRuleSpec `json:"spec"`
+}
+
+type prometheusRuleMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type prometheusRuleSpec struct {
+	Groups []ruleGroup `json:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `json:"name"`
+	Rules []rule `json:"rules"`
+}
+
+type rule struct {
+	Record      string            `json:"record,omitempty"`
+	Alert       string            `json:"alert,omitempty"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// histogramQuantiles are the quantiles of the histograms recorded and shown in the dashboard.
+var histogramQuantiles = []float64{0.5, 0.9, 0.99}
+
+// metricName returns the full name of the metric of the key.
+func metricName(key string) string {
+	return metrics.MetricsNamespace + "_" + key
+}
+
+// byClause returns the "by" clause of the aggregation keeping the labels of the metric.
+func byClause(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return " by (" + strings.Join(labels, ", ") + ")"
+}
+
+// level returns the level of the recording rules aggregated by the labels.
+func level(labels []string) string {
+	if len(labels) == 0 {
+		return "job"
+	}
+	return strings.Join(labels, "_")
+}
+
+// seriesTemplate returns the template identifying the series of the metric in the alert annotations.
+func seriesTemplate(def metrics.Definition) string {
+	parts := make([]string, 0, len(def.Labels))
+	for _, l := range def.Labels {
+		parts = append(parts, "{{ $labels."+l+" }}")
+	}
+	return strings.Join(parts, "/")
+}
+
+func recordingRules(defs []metrics.Definition) []rule {
+	var rules []rule
+	for _, def := range defs {
+		switch def.Type {
+		case metrics.MetricTypeCounter:
+			rules = append(rules, rule{
+				Record: fmt.Sprintf("%s:%s:rate5m", level(def.Labels), def.Name),
+				Expr:   fmt.Sprintf("sum%s (rate(%s[5m]))", byClause(def.Labels), def.Name),
+			})
+		case metrics.MetricTypeHistogram:
+			for _, q := range histogramQuantiles {
+				rules = append(rules, rule{
+					Record: fmt.Sprintf("%s:%s:p%g", level(def.Labels), def.Name, q*100),
+					Expr: fmt.Sprintf("histogram_quantile(%g, sum%s (rate(%s_bucket[5m])))",
+						q, byClause(append([]string{"le"}, def.Labels...)), def.Name),
+				})
+			}
+		}
+	}
+	return rules
+}
+
+// alertDef defines an alerting rule on a metric. The rule is generated only if the metric exists.
+type alertDef struct {
+	name     string
+	metric   string
+	expr     func(def metrics.Definition) string
+	duration string
+	severity string
+	summary  string
+}
+
+func increaseExpr(window string) func(def metrics.Definition) string {
+	return func(def metrics.Definition) string {
+		return fmt.Sprintf("sum%s (increase(%s[%s])) > 0", byClause(def.Labels), def.Name, window)
+	}
+}
+
+func compareExpr(op string, value string) func(def metrics.Definition) string {
+	return func(def metrics.Definition) string {
+		return fmt.Sprintf("%s %s %s", def.Name, op, value)
+	}
+}
+
+var alertDefs = []alertDef{
+	{
+		name:     "PVCAutoresizerResizeFailing",
+		metric:   metricName(metrics.ResizerFailedResizeTotalKey),
+		expr:     increaseExpr("15m"),
+		duration: "15m",
+		severity: "warning",
+		summary:  "Resizing PVCs keeps failing",
+	},
+	{
+		name:     "PVCAutoresizerStorageLimitReached",
+		metric:   metricName(metrics.ResizerLimitReachedTotalKey),
+		expr:     increaseExpr("1h"),
+		severity: "warning",
+		summary:  "PVC needs to be resized but has reached the storage limit",
+	},
+	{
+		name:     "PVCAutoresizerApproachingStorageLimit",
+		metric:   metricName(metrics.ResizerLimitUsedRatioKey),
+		expr:     compareExpr(">=", "0.9"),
+		duration: "15m",
+		severity: "info",
+		summary:  "PVC has used 90% of the storage limit",
+	},
+	{
+		name:     "PVCAutoresizerExpansionStuck",
+		metric:   metricName(metrics.ResizerResizeStuckKey),
+		expr:     compareExpr("==", "1"),
+		duration: "15m",
+		severity: "warning",
+		summary:  "Volume expansion of PVC failed or has not completed",
+	},
+	{
+		name:     "PVCAutoresizerResizeGaveUp",
+		metric:   metricName(metrics.ResizerResizeGaveUpKey),
+		expr:     compareExpr("==", "1"),
+		severity: "warning",
+		summary:  "pvc-autoresizer gave up resizing PVC after consecutive failures",
+	},
+	{
+		name:     "PVCAutoresizerCircuitBreakerOpen",
+		metric:   metricName(metrics.ResizerCircuitBreakerOpenKey),
+		expr:     compareExpr("==", "1"),
+		severity: "warning",
+		summary:  "Resizing is paused because the growth budget is exceeded",
+	},
+	{
+		name:     "PVCAutoresizerMetricsClientErrors",
+		metric:   metricName(metrics.MetricsClientSubsystem + "_" + metrics.MetricsClientFailTotalKey),
+		expr:     increaseExpr("15m"),
+		duration: "15m",
+		severity: "warning",
+		summary:  "pvc-autoresizer fails to get the volume stats",
+	},
+	{
+		name:     "PVCAutoresizerKubernetesClientErrors",
+		metric:   metricName(metrics.KubernetesClientSubsystem + "_" + metrics.KubernetesClientFailTotalKey),
+		expr:     increaseExpr("15m"),
+		duration: "15m",
+		severity: "warning",
+		summary:  "pvc-autoresizer fails to access the Kubernetes API",
+	},
+}
+
+func alertingRules(defs []metrics.Definition) []rule {
+	byName := make(map[string]metrics.Definition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+	var rules []rule
+	for _, a := range alertDefs {
+		def, ok := byName[a.metric]
+		if !ok {
+			continue
+		}
+		summary := a.summary
+		if series := seriesTemplate(def); series != "" {
+			summary += ": " + series
+		}
+		rules = append(rules, rule{
+			Alert:  a.name,
+			Expr:   a.expr(def),
+			For:    a.duration,
+			Labels: map[string]string{"severity": a.severity},
+			Annotations: map[string]string{
+				"summary":     summary,
+				"description": fmt.Sprintf("%s. %s is a %s", a.summary, def.Name, def.Help),
+			},
+		})
+	}
+	return rules
+}
+
+// PrometheusRule returns the YAML of the PrometheusRule of the Prometheus Operator with the
+// recording and alerting rules on the metrics.
+func PrometheusRule(defs []metrics.Definition, opts Options) ([]byte, error) {
+	pr := prometheusRule{
+		APIVersion: "monitoring.coreos.com/v1",
+		Kind:       "PrometheusRule",
+		Metadata: prometheusRuleMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    opts.Labels,
+		},
+		Spec: prometheusRuleSpec{
+			Groups: []ruleGroup{
+				{Name: "pvc-autoresizer.rules", Rules: recordingRules(defs)},
+				{Name: "pvc-autoresizer.alerts", Rules: alertingRules(defs)},
+			},
+		},
+	}
+	return yaml.Marshal(pr)
+}
@@ -0,0 +1,244 @@
+package runners
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Names of the alerts pushed to Alertmanager.
+const (
+	AlertExpansionStuck      = "PVCExpansionStuck"
+	AlertResizeFailing       = "PVCResizeFailing"
+	AlertStorageLimitReached = "PVCStorageLimitReached"
+)
+
+// alertResendFactor is the factor of the resize interval to the lifetime of the pushed alerts.
+// Alertmanager resolves the alerts which are not pushed again within their lifetime, e.g. when the
+// controller stops.
+const alertResendFactor = 4
+
+// AlertOptions holds the settings of the alerts pushed to Alertmanager.
+type AlertOptions struct {
+	// AlertmanagerURL is the base URL of the Alertmanager API, e.g. "http://alertmanager:9093".
+	// Empty disables the alerts.
+	AlertmanagerURL string
+
+	// FailureThreshold is the number of consecutive resize failures to raise PVCResizeFailing.
+	// The alert is also raised when the resizer gives up resizing the PVC.
+	FailureThreshold int
+
+	// Labels are added to all the alerts, e.g. to identify the cluster.
+	Labels map[string]string
+}
+
+// postableAlert is an alert in the request body of the Alertmanager v2 API.
+type postableAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+type alertKey struct {
+	name string
+	pvc  types.NamespacedName
+}
+
+type alertState struct {
+	labels      map[string]string
+	annotations map[string]string
+	startsAt    time.Time
+	// resolvedAt is set when the condition of the alert has cleared. The alert is dropped after
+	// the resolution is pushed.
+	resolvedAt *time.Time
+}
+
+// alertPusher keeps the alerts of PVCs and pushes them to Alertmanager.
+type alertPusher struct {
+	opts     AlertOptions
+	lifetime time.Duration
+	client   *http.Client
+	now      func() time.Time
+
+	mu     sync.Mutex
+	alerts map[alertKey]*alertState
+}
+
+// newAlertPusher returns an alertPusher. It returns nil if the alerts are disabled, and all the
+// methods of alertPusher are no-op for nil.
+func newAlertPusher(opts AlertOptions, interval time.Duration) *alertPusher {
+	if opts.AlertmanagerURL == "" {
+		return nil
+	}
+	return &alertPusher{
+		opts:     opts,
+		lifetime: alertResendFactor * interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+		alerts:   make(map[alertKey]*alertState),
+	}
+}
+
+// pvcOwner returns "<kind>/<name>" of the controller of the PVC, or of its first owner if it has
+// no controller. It returns an empty string if the PVC has no owner.
+func pvcOwner(pvc *corev1.PersistentVolumeClaim) string {
+	owner := metav1.GetControllerOf(pvc)
+	if owner == nil {
+		if len(pvc.OwnerReferences) == 0 {
+			return ""
+		}
+		owner = &pvc.OwnerReferences[0]
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// set raises the alert of the PVC if firing is true, and resolves it otherwise.
+func (p *alertPusher) set(name string, pvc *corev1.PersistentVolumeClaim, firing bool, summary string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := alertKey{name: name, pvc: types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}}
+	a, ok := p.alerts[key]
+	if !firing {
+		if ok && a.resolvedAt == nil {
+			now := p.now()
+			a.resolvedAt = &now
+		}
+		return
+	}
+	if !ok || a.resolvedAt != nil {
+		a = &alertState{startsAt: p.now()}
+		p.alerts[key] = a
+	}
+
+	a.labels = map[string]string{}
+	for k, v := range p.opts.Labels {
+		a.labels[k] = v
+	}
+	a.labels["alertname"] = name
+	a.labels["severity"] = "warning"
+	a.labels["namespace"] = pvc.Namespace
+	a.labels["persistentvolumeclaim"] = pvc.Name
+	if pvc.Spec.StorageClassName != nil {
+		a.labels["storageclass"] = *pvc.Spec.StorageClassName
+	}
+	if owner := pvcOwner(pvc); owner != "" {
+		a.labels["owner"] = owner
+	}
+	a.annotations = map[string]string{"summary": summary}
+}
+
+// setFailures raises PVCResizeFailing if the number of the consecutive failures reaches the threshold.
+func (p *alertPusher) setFailures(pvc *corev1.PersistentVolumeClaim, count int, terminal bool, err error) {
+	if p == nil {
+		return
+	}
+	firing := terminal || (p.opts.FailureThreshold > 0 && count >= p.opts.FailureThreshold)
+	summary := ""
+	if err != nil {
+		summary = fmt.Sprintf("Resizing PVC %s/%s failed %d times in a row: %s", pvc.Namespace, pvc.Name, count, err.Error())
+	}
+	p.set(AlertResizeFailing, pvc, firing, summary)
+}
+
+// prune resolves the alerts of the PVCs not in targets.
+func (p *alertPusher) prune(targets map[types.NamespacedName]struct{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for key, a := range p.alerts {
+		if _, ok := targets[key.pvc]; !ok && a.resolvedAt == nil {
+			a.resolvedAt = &now
+		}
+	}
+}
+
+// postableAlerts returns the alerts to push sorted by the labels.
+func (p *alertPusher) postableAlerts() []postableAlert {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	alerts := make([]postableAlert, 0, len(p.alerts))
+	for _, a := range p.alerts {
+		endsAt := now.Add(p.lifetime)
+		if a.resolvedAt != nil {
+			endsAt = *a.resolvedAt
+		}
+		alerts = append(alerts, postableAlert{
+			Labels:      a.labels,
+			Annotations: a.annotations,
+			StartsAt:    a.startsAt,
+			EndsAt:      endsAt,
+		})
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return labelsString(alerts[i].Labels) < labelsString(alerts[j].Labels)
+	})
+	return alerts
+}
+
+func labelsString(labels map[string]string) string {
+	// fmt prints maps sorted by key.
+	return fmt.Sprintf("%v", labels)
+}
+
+// dropResolved drops the resolved alerts which have been pushed.
+func (p *alertPusher) dropResolved(pushed time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, a := range p.alerts {
+		if a.resolvedAt != nil && !a.resolvedAt.After(pushed) {
+			delete(p.alerts, key)
+		}
+	}
+}
+
+// push pushes the firing alerts with their lifetime and the resolved alerts to Alertmanager. The
+// firing alerts are pushed on every call to keep them active in Alertmanager.
+func (p *alertPusher) push(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	pushed := p.now()
+	alerts := p.postableAlerts()
+	if len(alerts) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(p.opts.AlertmanagerURL, "/") + "/api/v2/alerts"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alertmanager returned %s", resp.Status)
+	}
+	p.dropResolved(pushed)
+	return nil
+}
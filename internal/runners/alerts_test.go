@@ -0,0 +1,106 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("test alerts", func() {
+	It("should not push the alerts if Alertmanager is not configured", func() {
+		p := newAlertPusher(AlertOptions{}, time.Minute)
+		Expect(p).To(BeNil())
+		p.set(AlertExpansionStuck, decisionTestPVC("10Gi", "100Gi"), true, "stuck")
+		Expect(p.push(context.Background())).To(Succeed())
+	})
+
+	It("should push the firing and resolved alerts", func() {
+		var received [][]postableAlert
+		status := http.StatusOK
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/api/v2/alerts"))
+			var alerts []postableAlert
+			Expect(json.NewDecoder(r.Body).Decode(&alerts)).To(Succeed())
+			received = append(received, alerts)
+			w.WriteHeader(status)
+		}))
+		defer ts.Close()
+
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		p := newAlertPusher(AlertOptions{
+			AlertmanagerURL:  ts.URL + "/",
+			FailureThreshold: 3,
+			Labels:           map[string]string{"cluster": "test"},
+		}, time.Minute)
+		p.now = func() time.Time { return now }
+		ctx := context.Background()
+
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		controller := true
+		pvc.OwnerReferences = []metav1.OwnerReference{
+			{APIVersion: "example.com/v1", Kind: "Database", Name: "db", Controller: &controller},
+		}
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received).To(BeEmpty())
+
+		p.set(AlertExpansionStuck, pvc, true, "stuck")
+		p.setFailures(pvc, 2, false, errors.New("denied"))
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received).To(HaveLen(1))
+		Expect(received[0]).To(Equal([]postableAlert{{
+			Labels: map[string]string{
+				"alertname":             AlertExpansionStuck,
+				"severity":              "warning",
+				"namespace":             "default",
+				"persistentvolumeclaim": "test-pvc",
+				"storageclass":          "test-sc",
+				"owner":                 "Database/db",
+				"cluster":               "test",
+			},
+			Annotations: map[string]string{"summary": "stuck"},
+			StartsAt:    now,
+			EndsAt:      now.Add(4 * time.Minute),
+		}}))
+
+		now = now.Add(time.Minute)
+		p.setFailures(pvc, 3, false, errors.New("denied"))
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received[1]).To(HaveLen(2))
+		Expect(received[1][0].Labels["alertname"]).To(Equal(AlertExpansionStuck))
+		Expect(received[1][0].StartsAt).To(Equal(now.Add(-time.Minute)))
+		Expect(received[1][0].EndsAt).To(Equal(now.Add(4 * time.Minute)))
+		Expect(received[1][1].Labels["alertname"]).To(Equal(AlertResizeFailing))
+		Expect(received[1][1].Annotations["summary"]).To(Equal("Resizing PVC default/test-pvc failed 3 times in a row: denied"))
+
+		// The resolution is pushed again if the push fails.
+		now = now.Add(time.Minute)
+		p.set(AlertExpansionStuck, pvc, false, "")
+		status = http.StatusInternalServerError
+		Expect(p.push(ctx)).NotTo(Succeed())
+		status = http.StatusOK
+		now = now.Add(time.Minute)
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received[3]).To(HaveLen(2))
+		Expect(received[3][0].Labels["alertname"]).To(Equal(AlertExpansionStuck))
+		Expect(received[3][0].EndsAt).To(Equal(now.Add(-time.Minute)))
+
+		p.prune(map[types.NamespacedName]struct{}{})
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received[4]).To(HaveLen(1))
+		Expect(received[4][0].Labels["alertname"]).To(Equal(AlertResizeFailing))
+		Expect(received[4][0].EndsAt).To(Equal(now))
+
+		Expect(p.push(ctx)).To(Succeed())
+		Expect(received).To(HaveLen(5))
+	})
+})
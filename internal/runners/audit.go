@@ -0,0 +1,308 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AuditSeverity is the severity of an audit finding.
+type AuditSeverity string
+
+// Severities of the audit findings. Errors are misconfigurations which prevent resizing.
+const (
+	AuditSeverityError   AuditSeverity = "Error"
+	AuditSeverityWarning AuditSeverity = "Warning"
+)
+
+// Reasons of the audit findings.
+const (
+	AuditReasonInvalidAnnotation         = "InvalidAnnotation"
+	AuditReasonVolumeExpansionNotAllowed = "VolumeExpansionNotAllowed"
+	AuditReasonStorageClassNotFound      = "StorageClassNotFound"
+	AuditReasonStorageClassNotEnabled    = "StorageClassNotEnabled"
+	AuditReasonStorageLimitMissing       = "StorageLimitMissing"
+	AuditReasonNotFilesystem             = "NotFilesystem"
+	AuditReasonLimitReached              = "LimitReached"
+	AuditReasonApproachingLimit          = "ApproachingLimit"
+)
+
+// AuditFinding is a problem found in the autoresize configuration.
+type AuditFinding struct {
+	Severity AuditSeverity `json:"severity"`
+	Reason   string        `json:"reason"`
+	Message  string        `json:"message"`
+}
+
+// AuditStorageClass is the audit result of a StorageClass.
+type AuditStorageClass struct {
+	Name                 string         `json:"name"`
+	Enabled              bool           `json:"enabled"`
+	AllowVolumeExpansion bool           `json:"allowVolumeExpansion"`
+	Findings             []AuditFinding `json:"findings,omitempty"`
+}
+
+// AuditPVC is the audit result of a PVC.
+type AuditPVC struct {
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	StorageClass string            `json:"storageClass,omitempty"`
+	Enabled      bool              `json:"enabled"`
+	Capacity     resource.Quantity `json:"capacity"`
+	Limit        resource.Quantity `json:"limit"`
+
+	// VolumeUsedRatio is the used ratio of the volume. It is omitted if the volume stats are not found.
+	VolumeUsedRatio *float64 `json:"volumeUsedRatio,omitempty"`
+
+	// LimitUsedRatio is the ratio of the capacity to the storage limit.
+	LimitUsedRatio float64 `json:"limitUsedRatio,omitempty"`
+
+	Findings []AuditFinding `json:"findings,omitempty"`
+}
+
+// AuditReport is the result of an audit.
+type AuditReport struct {
+	StorageClasses []AuditStorageClass `json:"storageClasses"`
+	PVCs           []AuditPVC          `json:"pvcs"`
+}
+
+// Count returns the number of the findings of the severity.
+func (r *AuditReport) Count(severity AuditSeverity) int {
+	count := 0
+	for _, sc := range r.StorageClasses {
+		count += countFindings(sc.Findings, severity)
+	}
+	for _, pvc := range r.PVCs {
+		count += countFindings(pvc.Findings, severity)
+	}
+	return count
+}
+
+func countFindings(findings []AuditFinding, severity AuditSeverity) int {
+	count := 0
+	for _, f := range findings {
+		if f.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// AuditOptions holds the settings of an audit, which should be the same as the controller.
+type AuditOptions struct {
+	// Namespaces are the namespaces of the PVCs to audit. Empty for all namespaces.
+	Namespaces []string
+
+	// NamespaceFilter selects the namespaces of the PVCs to audit within Namespaces.
+	NamespaceFilter NamespaceFilter
+
+	// SkipAnnotationCheck regards all StorageClasses as enabled.
+	SkipAnnotationCheck bool
+
+	// LimitWarning is the warning levels of the PVCs approaching their storage limits.
+	LimitWarning LimitWarningOptions
+
+	// Defaults are the defaults of the annotations, which should be the same as the controller.
+	Defaults ResizeDefaults
+}
+
+// Audit checks the autoresize configurations of the StorageClasses and the PVCs. The PVCs are
+// reported if they are enabled, have any annotation of pvc-autoresizer or have findings. The volume
+// usage is checked only if the metrics client is given.
+func Audit(ctx context.Context, c client.Reader, mc MetricsClient, opts AuditOptions) (*AuditReport, error) {
+	var scs storagev1.StorageClassList
+	if err := c.List(ctx, &scs); err != nil {
+		return nil, err
+	}
+	report := &AuditReport{StorageClasses: []AuditStorageClass{}, PVCs: []AuditPVC{}}
+	scMap := make(map[string]*AuditStorageClass, len(scs.Items))
+	for i := range scs.Items {
+		report.StorageClasses = append(report.StorageClasses, auditStorageClass(&scs.Items[i], opts))
+	}
+	for i := range report.StorageClasses {
+		scMap[report.StorageClasses[i].Name] = &report.StorageClasses[i]
+	}
+
+	nss, err := selectNamespaces(ctx, c, opts.NamespaceFilter)
+	if err != nil {
+		return nil, err
+	}
+	var pvcs []corev1.PersistentVolumeClaim
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{corev1.NamespaceAll}
+	}
+	for _, ns := range namespaces {
+		var list corev1.PersistentVolumeClaimList
+		if err := c.List(ctx, &list, client.InNamespace(ns)); err != nil {
+			return nil, err
+		}
+		for _, pvc := range list.Items {
+			if nss.contains(pvc.Namespace) {
+				pvcs = append(pvcs, pvc)
+			}
+		}
+	}
+
+	var vsMap map[types.NamespacedName]*VolumeStats
+	if mc != nil {
+		vsMap, err = mc.GetMetrics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get volume stats: %w", err)
+		}
+	}
+
+	for i := range pvcs {
+		pvc := &pvcs[i]
+		var sc *AuditStorageClass
+		if pvc.Spec.StorageClassName != nil {
+			sc = scMap[*pvc.Spec.StorageClassName]
+		}
+		vs := vsMap[types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}]
+		result := auditPVC(pvc, sc, vs, opts)
+		if result.Enabled || len(result.Findings) > 0 || hasResizeAnnotation(pvc) {
+			report.PVCs = append(report.PVCs, result)
+		}
+	}
+	sort.Slice(report.PVCs, func(i, j int) bool {
+		if report.PVCs[i].Namespace != report.PVCs[j].Namespace {
+			return report.PVCs[i].Namespace < report.PVCs[j].Namespace
+		}
+		return report.PVCs[i].Name < report.PVCs[j].Name
+	})
+	return report, nil
+}
+
+func auditStorageClass(sc *storagev1.StorageClass, opts AuditOptions) AuditStorageClass {
+	result := AuditStorageClass{
+		Name:                 sc.Name,
+		AllowVolumeExpansion: sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion,
+	}
+	value, annotated := sc.Annotations[pvcautoresizer.AutoResizeEnabledKey]
+	result.Enabled = opts.SkipAnnotationCheck || value == "true"
+	if annotated && value != "true" && value != "false" {
+		result.Findings = append(result.Findings, AuditFinding{
+			Severity: AuditSeverityWarning,
+			Reason:   AuditReasonInvalidAnnotation,
+			Message: fmt.Sprintf("%s is %q, which is ignored since only \"true\" enables autoresize",
+				pvcautoresizer.AutoResizeEnabledKey, value),
+		})
+	}
+	if result.Enabled && annotated && !result.AllowVolumeExpansion {
+		result.Findings = append(result.Findings, AuditFinding{
+			Severity: AuditSeverityError,
+			Reason:   AuditReasonVolumeExpansionNotAllowed,
+			Message:  "StorageClass enables autoresize but does not allow volume expansion",
+		})
+	}
+	return result
+}
+
+// hasResizeAnnotation returns true if the PVC has any annotation of pvc-autoresizer.
+func hasResizeAnnotation(pvc *corev1.PersistentVolumeClaim) bool {
+	for k := range pvc.Annotations {
+		if strings.HasPrefix(k, "resize.topolvm.io/") {
+			return true
+		}
+	}
+	return false
+}
+
+func auditPVC(pvc *corev1.PersistentVolumeClaim, sc *AuditStorageClass, vs *VolumeStats,
+	opts AuditOptions) AuditPVC {
+	result := AuditPVC{
+		Namespace: pvc.Namespace,
+		Name:      pvc.Name,
+		Capacity:  pvc.Status.Capacity[corev1.ResourceStorage],
+	}
+	if pvc.Spec.StorageClassName != nil {
+		result.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if vs != nil && vs.CapacityBytes > 0 {
+		ratio := 1 - float64(vs.AvailableBytes)/float64(vs.CapacityBytes)
+		result.VolumeUsedRatio = &ratio
+	}
+	addFinding := func(severity AuditSeverity, reason, format string, args ...any) {
+		result.Findings = append(result.Findings, AuditFinding{
+			Severity: severity,
+			Reason:   reason,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	target, err := IsTargetPVC(pvc)
+	if err != nil {
+		addFinding(AuditSeverityError, AuditReasonInvalidAnnotation, "%s is invalid: %v",
+			pvcautoresizer.StorageLimitAnnotation, err)
+		return result
+	}
+	result.Limit, _ = PvcStorageLimit(pvc)
+	if result.Limit.IsZero() {
+		if hasResizeAnnotation(pvc) {
+			addFinding(AuditSeverityWarning, AuditReasonStorageLimitMissing,
+				"PVC has annotations of autoresize but no storage limit, so it is not resized")
+		}
+		return result
+	}
+
+	enabled := IsAutoresizeEnabled(pvc, sc != nil && sc.Enabled)
+	value, annotated := pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey]
+	if annotated && value != "true" && value != "false" {
+		addFinding(AuditSeverityWarning, AuditReasonInvalidAnnotation,
+			"%s is %q, which is ignored since only \"true\" or \"false\" overrides the StorageClass",
+			pvcautoresizer.AutoResizeEnabledKey, value)
+	}
+	switch {
+	case value == "false":
+		// Opted out by the PVC itself.
+	case sc == nil:
+		addFinding(AuditSeverityWarning, AuditReasonStorageClassNotFound,
+			"PVC has the storage limit but its StorageClass %q is not found", result.StorageClass)
+	case !enabled:
+		addFinding(AuditSeverityWarning, AuditReasonStorageClassNotEnabled,
+			"PVC has the storage limit but its StorageClass %q does not enable autoresize", sc.Name)
+	}
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode != corev1.PersistentVolumeFilesystem {
+		addFinding(AuditSeverityWarning, AuditReasonNotFilesystem,
+			"PVC has the storage limit but is a %s volume, which is not resized", *pvc.Spec.VolumeMode)
+	}
+	result.Enabled = enabled && target
+	if !target {
+		return result
+	}
+	if result.Enabled && sc != nil && !sc.AllowVolumeExpansion {
+		addFinding(AuditSeverityError, AuditReasonVolumeExpansionNotAllowed,
+			"PVC is enabled but its StorageClass %q does not allow volume expansion", sc.Name)
+	}
+	if !result.Capacity.IsZero() {
+		result.LimitUsedRatio = float64(result.Capacity.Value()) / float64(result.Limit.Value())
+	}
+
+	stats := vs
+	if stats == nil {
+		// Evaluate the annotations with the capacity of the PVC as the volume size.
+		stats = &VolumeStats{CapacityBytes: result.Capacity.Value(), AvailableBytes: result.Capacity.Value()}
+	}
+	d := EvaluateResizeWithDefaults(pvc, stats, opts.Defaults)
+	switch d.Reason {
+	case ReasonInvalidThreshold, ReasonInvalidInodesThreshold, ReasonInvalidIncrease:
+		addFinding(AuditSeverityError, AuditReasonInvalidAnnotation, "%s: %s", d.Reason, d.Message)
+		return result
+	case ReasonLimitReached:
+		addFinding(AuditSeverityWarning, AuditReasonLimitReached,
+			"PVC capacity %s has reached the storage limit %s", d.Capacity.String(), d.Limit.String())
+		return result
+	}
+	if lw := opts.LimitWarning.Evaluate(d); lw != nil && lw.Firing() {
+		addFinding(AuditSeverityWarning, AuditReasonApproachingLimit, "%s", lw.Summary())
+	}
+	return result
+}
@@ -0,0 +1,144 @@
+package runners
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func auditTestStorageClass(enabled string, allowVolumeExpansion bool) *storagev1.StorageClass {
+	sc := &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: "test-sc"},
+		AllowVolumeExpansion: &allowVolumeExpansion,
+	}
+	if enabled != "" {
+		sc.Annotations = map[string]string{pvcautoresizer.AutoResizeEnabledKey: enabled}
+	}
+	return sc
+}
+
+func auditReasons(findings []AuditFinding) []string {
+	reasons := []string{}
+	for _, f := range findings {
+		reasons = append(reasons, f.Reason)
+	}
+	return reasons
+}
+
+var _ = Describe("test audit", func() {
+	It("should report StorageClasses which cannot resize volumes", func() {
+		sc := auditStorageClass(auditTestStorageClass("true", false), AuditOptions{})
+		Expect(sc.Enabled).To(BeTrue())
+		Expect(auditReasons(sc.Findings)).To(Equal([]string{AuditReasonVolumeExpansionNotAllowed}))
+
+		sc = auditStorageClass(auditTestStorageClass("yes", true), AuditOptions{})
+		Expect(sc.Enabled).To(BeFalse())
+		Expect(auditReasons(sc.Findings)).To(Equal([]string{AuditReasonInvalidAnnotation}))
+
+		sc = auditStorageClass(auditTestStorageClass("", false), AuditOptions{SkipAnnotationCheck: true})
+		Expect(sc.Enabled).To(BeTrue())
+		Expect(sc.Findings).To(BeEmpty())
+	})
+
+	It("should not report a healthy PVC", func() {
+		sc := auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+		pvc := auditPVC(decisionTestPVC("10Gi", "100Gi"), &sc, decisionTestStats(10<<30, 5<<30), AuditOptions{})
+		Expect(pvc.Enabled).To(BeTrue())
+		Expect(pvc.Findings).To(BeEmpty())
+		Expect(*pvc.VolumeUsedRatio).To(Equal(0.5))
+		Expect(pvc.LimitUsedRatio).To(Equal(0.1))
+	})
+
+	It("should report PVCs which are not resized", func() {
+		enabled := auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+		disabled := auditStorageClass(auditTestStorageClass("", true), AuditOptions{})
+
+		pvc := decisionTestPVC("10Gi", "")
+		result := auditPVC(pvc, &enabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeFalse())
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonStorageLimitMissing}))
+
+		result = auditPVC(decisionTestPVC("10Gi", "100Gi"), &disabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeFalse())
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonStorageClassNotEnabled}))
+
+		result = auditPVC(decisionTestPVC("10Gi", "100Gi"), nil, nil, AuditOptions{})
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonStorageClassNotFound}))
+
+		pvc = decisionTestPVC("10Gi", "100Gi")
+		block := corev1.PersistentVolumeBlock
+		pvc.Spec.VolumeMode = &block
+		result = auditPVC(pvc, &enabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeFalse())
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonNotFilesystem}))
+	})
+
+	It("should let the annotation of PVCs override their StorageClasses", func() {
+		enabled := auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+		disabled := auditStorageClass(auditTestStorageClass("", true), AuditOptions{})
+
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] = "true"
+		result := auditPVC(pvc, &disabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeTrue())
+		Expect(result.Findings).To(BeEmpty())
+
+		pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] = "false"
+		result = auditPVC(pvc, &enabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeFalse())
+		Expect(result.Findings).To(BeEmpty())
+
+		pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] = "yes"
+		result = auditPVC(pvc, &enabled, nil, AuditOptions{})
+		Expect(result.Enabled).To(BeTrue())
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonInvalidAnnotation}))
+	})
+
+	It("should report invalid annotations of PVCs", func() {
+		sc := auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+
+		result := auditPVC(decisionTestPVC("10Gi", "invalid"), &sc, nil, AuditOptions{})
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonInvalidAnnotation}))
+
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.ResizeThresholdAnnotation] = "200%"
+		result = auditPVC(pvc, &sc, nil, AuditOptions{})
+		Expect(result.Findings).To(HaveLen(1))
+		Expect(result.Findings[0].Severity).To(Equal(AuditSeverityError))
+		Expect(result.Findings[0].Reason).To(Equal(AuditReasonInvalidAnnotation))
+	})
+
+	It("should report PVCs which cannot be expanded or approach their storage limits", func() {
+		sc := auditStorageClass(auditTestStorageClass("", false), AuditOptions{SkipAnnotationCheck: true})
+		result := auditPVC(decisionTestPVC("10Gi", "100Gi"), &sc, nil, AuditOptions{SkipAnnotationCheck: true})
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonVolumeExpansionNotAllowed}))
+
+		sc = auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+		result = auditPVC(decisionTestPVC("100Gi", "100Gi"), &sc, nil, AuditOptions{})
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonLimitReached}))
+
+		opts := AuditOptions{LimitWarning: LimitWarningOptions{UsedPercentages: []float64{80}}}
+		result = auditPVC(decisionTestPVC("90Gi", "100Gi"), &sc, nil, opts)
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonApproachingLimit}))
+		Expect(result.Findings[0].Severity).To(Equal(AuditSeverityWarning))
+	})
+
+	It("should evaluate PVCs with the defaults of the controller", func() {
+		sc := auditStorageClass(auditTestStorageClass("true", true), AuditOptions{})
+		opts := AuditOptions{LimitWarning: LimitWarningOptions{ResizesRemaining: 3}}
+
+		pvc := decisionTestPVC("50Gi", "100Gi")
+		delete(pvc.Annotations, pvcautoresizer.ResizeIncreaseAnnotation)
+
+		// 10 resizes of 5Gi remain with the built-in default increase of 10%.
+		result := auditPVC(pvc, &sc, nil, opts)
+		Expect(result.Findings).To(BeEmpty())
+
+		opts.Defaults = ResizeDefaults{Increase: "25Gi"}
+		result = auditPVC(pvc, &sc, nil, opts)
+		Expect(auditReasons(result.Findings)).To(Equal([]string{AuditReasonApproachingLimit}))
+	})
+})
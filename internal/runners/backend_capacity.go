@@ -0,0 +1,165 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	topolvmProvisioner              = "topolvm.io"
+	topolvmNodeTopologyKey          = "topology.topolvm.io/node"
+	topolvmCapacityAnnotationPrefix = "capacity.topolvm.io/"
+	topolvmDeviceClassParameter     = "topolvm.io/device-class"
+	topolvmDefaultDeviceClass       = "00default"
+)
+
+// backendCapacity is the free capacity of the storage backend which the volume belongs to.
+type backendCapacity struct {
+	available resource.Quantity
+	source    string
+}
+
+// volumeTopology returns the topology labels of the PV, which are taken from the single-valued
+// "In" expressions of its required node affinity.
+func volumeTopology(pv *corev1.PersistentVolume) labels.Set {
+	topology := labels.Set{}
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return topology
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if expr.Operator == corev1.NodeSelectorOpIn && len(expr.Values) == 1 {
+				topology[expr.Key] = expr.Values[0]
+			}
+		}
+	}
+	return topology
+}
+
+// getBackendCapacity returns the free capacity of the storage backend of the PVC, or nil if it
+// is unknown. For TopoLVM, the capacity annotation of the node is used. For other CSI drivers,
+// CSIStorageCapacity objects which match the topology of the PV are used. They are read with
+// the API reader since they are needed only when PVCs are resized and not worth caching.
+func (w *pvcAutoresizer) getBackendCapacity(ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim) (*backendCapacity, error) {
+	if pvc.Spec.VolumeName == "" || pvc.Spec.StorageClassName == nil {
+		return nil, nil
+	}
+
+	var sc storagev1.StorageClass
+	if err := w.client.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, &sc); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return nil, err
+	}
+	var pv corev1.PersistentVolume
+	if err := w.apiReader.Get(ctx, client.ObjectKey{Name: pvc.Spec.VolumeName}, &pv); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return nil, err
+	}
+	topology := volumeTopology(&pv)
+	if len(topology) == 0 {
+		return nil, nil
+	}
+
+	if nodeName, ok := topology[topolvmNodeTopologyKey]; ok && sc.Provisioner == topolvmProvisioner {
+		return w.getTopoLVMCapacity(ctx, &sc, nodeName)
+	}
+
+	var capacities storagev1.CSIStorageCapacityList
+	if err := w.apiReader.List(ctx, &capacities); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return nil, err
+	}
+	var res *backendCapacity
+	for _, c := range capacities.Items {
+		if c.StorageClassName != sc.Name || c.Capacity == nil || c.NodeTopology == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(c.NodeTopology)
+		if err != nil || !selector.Matches(topology) {
+			continue
+		}
+		if res == nil || c.Capacity.Cmp(res.available) < 0 {
+			res = &backendCapacity{
+				available: *c.Capacity,
+				source:    fmt.Sprintf("CSIStorageCapacity %s/%s", c.Namespace, c.Name),
+			}
+		}
+	}
+	return res, nil
+}
+
+func (w *pvcAutoresizer) getTopoLVMCapacity(ctx context.Context, sc *storagev1.StorageClass,
+	nodeName string) (*backendCapacity, error) {
+	var node corev1.Node
+	if err := w.apiReader.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return nil, err
+	}
+	deviceClass := sc.Parameters[topolvmDeviceClassParameter]
+	if deviceClass == "" {
+		deviceClass = topolvmDefaultDeviceClass
+	}
+	val, ok := node.Annotations[topolvmCapacityAnnotationPrefix+deviceClass]
+	if !ok {
+		return nil, nil
+	}
+	available, err := resource.ParseQuantity(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capacity annotation of node %s: %w", nodeName, err)
+	}
+	return &backendCapacity{
+		available: available,
+		source:    fmt.Sprintf("node %s (device-class %s)", nodeName, deviceClass),
+	}, nil
+}
+
+// capByBackendCapacity caps newReq so that the increase of the storage request fits in the free
+// capacity of the storage backend. It returns nil if the backend has no room to expand the volume.
+func (w *pvcAutoresizer) capByBackendCapacity(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	newReq resource.Quantity) (*resource.Quantity, error) {
+	if !w.opts.CheckBackendCapacity {
+		return &newReq, nil
+	}
+	backend, err := w.getBackendCapacity(ctx, pvc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backend capacity: %w", err)
+	}
+	if backend == nil {
+		return &newReq, nil
+	}
+
+	// The same base as the ResourceQuota check, so that both cap the same increase.
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	increase := newReq.DeepCopy()
+	increase.Sub(curReq)
+	if increase.Cmp(backend.available) <= 0 {
+		return &newReq, nil
+	}
+
+	metrics.ResizerInsufficientBackendCapacityTotal.Increment(pvc.Name, pvc.Namespace)
+	w.log.V(logLevelWarn).Info("insufficient backend capacity", "namespace", pvc.Namespace, "name", pvc.Name,
+		"available", backend.available.String(), "source", backend.source)
+	// The available bytes change in every check, so they are not included in the events to let
+	// them be aggregated.
+	cappedBytes := (curReq.Value() + backend.available.Value()) >> 30 << 30
+	if cappedBytes <= curReq.Value() {
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonInsufficientBackendCapacity, "Resize",
+			"PVC volume cannot be resized to %s because of insufficient capacity in %s",
+			newReq.String(), backend.source)
+		return nil, nil
+	}
+	capped := resource.NewQuantity(cappedBytes, resource.BinarySI)
+	w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonInsufficientBackendCapacity, "Resize",
+		"PVC volume resize is capped from %s to %s by insufficient capacity in %s",
+		newReq.String(), capped.String(), backend.source)
+	return capped, nil
+}
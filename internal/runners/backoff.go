@@ -0,0 +1,164 @@
+package runners
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// backoffJitter is the maximum factor of the jitter added to the backoff delay.
+const backoffJitter = 0.2
+
+// BackoffOptions holds the settings of the backoff for PVCs whose resize fails repeatedly.
+type BackoffOptions struct {
+	// BaseDelay is the delay before retrying the resize after the first failure. The delay doubles
+	// on every consecutive failure. 0 disables the backoff.
+	BaseDelay time.Duration
+
+	// MaxDelay is the upper bound of the delay.
+	MaxDelay time.Duration
+
+	// MaxConsecutiveFailures is the number of consecutive failures after which the resizer gives
+	// up resizing the PVC until the PVC is modified. 0 disables giving up.
+	MaxConsecutiveFailures int
+}
+
+type failureState struct {
+	count     int
+	nextRetry time.Time
+	// fingerprint identifies the PVC settings which caused the failures. The state is discarded
+	// when the PVC is modified.
+	fingerprint string
+}
+
+// failureTracker tracks consecutive resize failures of PVCs.
+type failureTracker struct {
+	opts BackoffOptions
+
+	mu     sync.Mutex
+	states map[types.NamespacedName]*failureState
+}
+
+func newFailureTracker(opts BackoffOptions) *failureTracker {
+	return &failureTracker{
+		opts:   opts,
+		states: make(map[types.NamespacedName]*failureState),
+	}
+}
+
+// pvcFingerprint returns a string which changes when the spec or the annotations of the PVC
+// are modified.
+func pvcFingerprint(pvc *corev1.PersistentVolumeClaim) string {
+	// fmt prints maps sorted by key.
+	return fmt.Sprintf("%d/%v", pvc.Generation, pvc.Annotations)
+}
+
+// setOptions changes the settings of the backoff. The failures recorded so far are kept.
+func (t *failureTracker) setOptions(opts BackoffOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.opts = opts
+}
+
+func (t *failureTracker) isTerminal(s *failureState) bool {
+	return t.opts.MaxConsecutiveFailures > 0 && s.count >= t.opts.MaxConsecutiveFailures
+}
+
+// shouldSkip returns true if the resize of the PVC should not be tried now, and whether the
+// PVC is in the terminal state.
+func (t *failureTracker) shouldSkip(pvc *corev1.PersistentVolumeClaim, now time.Time) (bool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}
+	s, ok := t.states[key]
+	if !ok {
+		return false, false
+	}
+	if s.fingerprint != pvcFingerprint(pvc) {
+		delete(t.states, key)
+		return false, false
+	}
+	if t.isTerminal(s) {
+		return true, true
+	}
+	return now.Before(s.nextRetry), false
+}
+
+// failure records a failure of the resize and returns the number of consecutive failures, the
+// delay before the next retry, and whether the PVC has entered the terminal state.
+func (t *failureTracker) failure(pvc *corev1.PersistentVolumeClaim, fingerprint string,
+	now time.Time) (int, time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}
+	s, ok := t.states[key]
+	if !ok || s.fingerprint != fingerprint {
+		s = &failureState{fingerprint: fingerprint}
+		t.states[key] = s
+	}
+	s.count++
+
+	var delay time.Duration
+	if t.opts.BaseDelay > 0 {
+		delay = t.opts.BaseDelay * time.Duration(math.Pow(2, math.Min(float64(s.count-1), 30)))
+		if t.opts.MaxDelay > 0 && delay > t.opts.MaxDelay {
+			delay = t.opts.MaxDelay
+		}
+		delay = wait.Jitter(delay, backoffJitter)
+	}
+	s.nextRetry = now.Add(delay)
+	return s.count, delay, t.isTerminal(s)
+}
+
+// success clears the failures of the PVC.
+func (t *failureTracker) success(pvc *corev1.PersistentVolumeClaim) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name})
+}
+
+// prune drops the states of the PVCs not in seen.
+func (t *failureTracker) prune(seen map[types.NamespacedName]struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.states {
+		if _, ok := seen[key]; !ok {
+			delete(t.states, key)
+		}
+	}
+}
+
+// handleResizeFailure records the failure of the resize of the PVC and reports it. The error is
+// logged as an error only on the first failure and when the PVC enters the terminal state.
+func (w *pvcAutoresizer) handleResizeFailure(pvc *corev1.PersistentVolumeClaim, fingerprint string, err error) {
+	log := w.log.WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+
+	count, delay, terminal := w.failures.failure(pvc, fingerprint, time.Now())
+	w.opts.State.recordFailure(pvc, err, count)
+	w.alerts.setFailures(pvc, count, terminal, err)
+	metrics.ResizerConsecutiveFailures.Set(pvc.Name, pvc.Namespace, float64(count))
+	metrics.ResizerResizeGaveUp.Set(pvc.Name, pvc.Namespace, terminal)
+	switch {
+	case terminal:
+		log.Error(err, "failed to resize PVC; giving up until the PVC is modified", "failures", count)
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonResizeGaveUp, "Resize",
+			"PVC volume resize failed %d times in a row and will not be retried until the PVC is modified: %s",
+			count, err.Error())
+	case count == 1:
+		log.Error(err, "failed to resize PVC", "retryAfter", delay)
+	default:
+		log.V(logLevelWarn).Info("failed to resize PVC", "error", err.Error(), "failures", count, "retryAfter", delay)
+	}
+	if !terminal {
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonResizeFailed, "Resize",
+			"PVC volume resize failed: %s", err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package runners
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("test failureTracker", func() {
+	newPVC := func() *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns1",
+				Name:        "pvc1",
+				Generation:  1,
+				Annotations: map[string]string{"resize.topolvm.io/storage_limit": "100Gi"},
+			},
+		}
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	It("should back off exponentially", func() {
+		t := newFailureTracker(BackoffOptions{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute})
+		pvc := newPVC()
+		fp := pvcFingerprint(pvc)
+
+		expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute}
+		for i, base := range expected {
+			count, delay, terminal := t.failure(pvc, fp, now)
+			Expect(count).To(Equal(i + 1))
+			Expect(terminal).To(BeFalse())
+			Expect(delay).To(BeNumerically(">=", base))
+			Expect(delay).To(BeNumerically("<=", time.Duration(float64(base)*(1+backoffJitter))))
+
+			skip, _ := t.shouldSkip(pvc, now.Add(base-time.Second))
+			Expect(skip).To(BeTrue())
+			skip, _ = t.shouldSkip(pvc, now.Add(delay))
+			Expect(skip).To(BeFalse())
+		}
+
+		t.success(pvc)
+		skip, _ := t.shouldSkip(pvc, now)
+		Expect(skip).To(BeFalse())
+	})
+
+	It("should give up after consecutive failures until the PVC is modified", func() {
+		t := newFailureTracker(BackoffOptions{MaxConsecutiveFailures: 3})
+		pvc := newPVC()
+		fp := pvcFingerprint(pvc)
+
+		for i := 0; i < 2; i++ {
+			_, _, terminal := t.failure(pvc, fp, now)
+			Expect(terminal).To(BeFalse())
+		}
+		_, _, terminal := t.failure(pvc, fp, now)
+		Expect(terminal).To(BeTrue())
+
+		skip, terminal := t.shouldSkip(pvc, now.Add(24*time.Hour))
+		Expect(skip).To(BeTrue())
+		Expect(terminal).To(BeTrue())
+
+		pvc.Annotations["resize.topolvm.io/storage_limit"] = "200Gi"
+		skip, terminal = t.shouldSkip(pvc, now)
+		Expect(skip).To(BeFalse())
+		Expect(terminal).To(BeFalse())
+	})
+
+	It("should drop the states of removed PVCs", func() {
+		t := newFailureTracker(BackoffOptions{BaseDelay: time.Hour})
+		pvc := newPVC()
+		t.failure(pvc, pvcFingerprint(pvc), now)
+
+		t.prune(map[types.NamespacedName]struct{}{{Namespace: "ns1", Name: "pvc1"}: {}})
+		skip, _ := t.shouldSkip(pvc, now)
+		Expect(skip).To(BeTrue())
+
+		t.prune(map[types.NamespacedName]struct{}{})
+		skip, _ = t.shouldSkip(pvc, now)
+		Expect(skip).To(BeFalse())
+	})
+})
@@ -0,0 +1,327 @@
+package runners
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Scopes of the growth budgets.
+const (
+	budgetScopeCluster      = "cluster"
+	budgetScopeNamespace    = "namespace"
+	budgetScopeStorageClass = "storageclass"
+)
+
+const (
+	budgetBytesWindow   = time.Hour
+	budgetResizesWindow = 24 * time.Hour
+)
+
+// BudgetOptions holds the limits of the growth of PVCs by the resizer.
+// 0 disables the corresponding limit.
+type BudgetOptions struct {
+	// MaxBytesPerHour is the maximum total bytes added to PVCs in the cluster per hour.
+	MaxBytesPerHour int64
+
+	// MaxBytesPerHourPerNamespace is the maximum total bytes added to PVCs in a namespace per hour.
+	MaxBytesPerHourPerNamespace int64
+
+	// MaxBytesPerHourPerStorageClass is the maximum total bytes added to PVCs of a StorageClass
+	// per hour.
+	MaxBytesPerHourPerStorageClass int64
+
+	// MaxResizesPerPVCPerDay is the maximum number of resizes of a PVC per day.
+	MaxResizesPerPVCPerDay int
+
+	// CircuitBreakerCooldown is the duration to pause resizing in the scope whose budget is
+	// exceeded.
+	CircuitBreakerCooldown time.Duration
+}
+
+type budgetKey struct {
+	scope string
+	name  string
+}
+
+func (k budgetKey) String() string {
+	if k.scope == budgetScopeCluster {
+		return k.scope
+	}
+	return fmt.Sprintf("%s %s", k.scope, k.name)
+}
+
+// growthRecord is a resize done by the resizer.
+type growthRecord struct {
+	time         time.Time
+	pvc          types.NamespacedName
+	storageClass string
+	bytes        int64
+}
+
+// budgetViolation describes why a resize is not allowed by the growth budgets.
+type budgetViolation struct {
+	// tripped is true if the violation opened the circuit breaker.
+	tripped bool
+	message string
+}
+
+// growthBudget tracks the growth of PVCs to enforce the growth budgets. The records are kept in
+// memory, so they are lost when the leader changes.
+type growthBudget struct {
+	opts BudgetOptions
+
+	mu        sync.Mutex
+	records   []growthRecord
+	openUntil map[budgetKey]time.Time
+	// observed are the scopes of the PVCs checked by the budgets, whose states are exported.
+	observed map[types.NamespacedName][]budgetKey
+	exported map[budgetKey]struct{}
+}
+
+func newGrowthBudget(opts BudgetOptions) *growthBudget {
+	return &growthBudget{
+		opts:      opts,
+		openUntil: make(map[budgetKey]time.Time),
+		observed:  make(map[types.NamespacedName][]budgetKey),
+		exported:  make(map[budgetKey]struct{}),
+	}
+}
+
+func budgetKeys(pvc *corev1.PersistentVolumeClaim) []budgetKey {
+	keys := []budgetKey{
+		{scope: budgetScopeCluster},
+		{scope: budgetScopeNamespace, name: pvc.Namespace},
+	}
+	if pvc.Spec.StorageClassName != nil {
+		keys = append(keys, budgetKey{scope: budgetScopeStorageClass, name: *pvc.Spec.StorageClassName})
+	}
+	return keys
+}
+
+// setOptions changes the limits of the budget. The growth recorded so far is kept.
+func (b *growthBudget) setOptions(opts BudgetOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opts = opts
+}
+
+func (b *growthBudget) limit(key budgetKey) int64 {
+	switch key.scope {
+	case budgetScopeCluster:
+		return b.opts.MaxBytesPerHour
+	case budgetScopeNamespace:
+		return b.opts.MaxBytesPerHourPerNamespace
+	case budgetScopeStorageClass:
+		return b.opts.MaxBytesPerHourPerStorageClass
+	}
+	return 0
+}
+
+func (r *growthRecord) matches(key budgetKey) bool {
+	switch key.scope {
+	case budgetScopeCluster:
+		return true
+	case budgetScopeNamespace:
+		return r.pvc.Namespace == key.name
+	case budgetScopeStorageClass:
+		return r.storageClass == key.name
+	}
+	return false
+}
+
+// pruneRecords drops the records which no longer affect any budget. b.mu must be held.
+func (b *growthBudget) pruneRecords(now time.Time) {
+	i := 0
+	for i < len(b.records) && now.Sub(b.records[i].time) >= budgetResizesWindow {
+		i++
+	}
+	b.records = b.records[i:]
+}
+
+// usedBytes returns the bytes added in the scope within the last hour. b.mu must be held.
+func (b *growthBudget) usedBytes(key budgetKey, now time.Time) int64 {
+	var used int64
+	for i := range b.records {
+		r := &b.records[i]
+		if now.Sub(r.time) < budgetBytesWindow && r.matches(key) {
+			used += r.bytes
+		}
+	}
+	return used
+}
+
+// check returns the increase allowed to add to the PVC by the growth budgets, or a violation if
+// no increase is allowed. If the increase exceeds the bytes budget of a scope, the circuit breaker
+// of the scope is opened and resizing in the scope is paused for CircuitBreakerCooldown. An
+// increase larger than the budget itself never fits in it, so it is capped to the remaining budget
+// instead of opening the circuit breaker.
+func (b *growthBudget) check(pvc *corev1.PersistentVolumeClaim, increase int64,
+	now time.Time) (int64, *budgetViolation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pruneRecords(now)
+
+	keys := budgetKeys(pvc)
+	b.observed[types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}] = keys
+	for _, key := range keys {
+		if until, ok := b.openUntil[key]; ok && now.Before(until) {
+			return 0, &budgetViolation{
+				message: fmt.Sprintf("circuit breaker of %s is open until %s", key, until.UTC().Format(time.RFC3339)),
+			}
+		}
+	}
+
+	if b.opts.MaxResizesPerPVCPerDay > 0 {
+		count := 0
+		for _, r := range b.records {
+			if r.pvc.Namespace == pvc.Namespace && r.pvc.Name == pvc.Name {
+				count++
+			}
+		}
+		if count >= b.opts.MaxResizesPerPVCPerDay {
+			return 0, &budgetViolation{
+				message: fmt.Sprintf("PVC has been resized %d times in the last 24 hours", count),
+			}
+		}
+	}
+
+	for _, key := range keys {
+		limit := b.limit(key)
+		if limit == 0 || increase <= limit {
+			continue
+		}
+		used := b.usedBytes(key, now)
+		if used >= limit {
+			return 0, &budgetViolation{
+				message: fmt.Sprintf("the budget of %s is used up (%s per hour)", key, bytesString(limit)),
+			}
+		}
+		increase = min(increase, limit-used)
+	}
+
+	for _, key := range keys {
+		limit := b.limit(key)
+		if limit == 0 {
+			continue
+		}
+		used := b.usedBytes(key, now)
+		if used+increase <= limit {
+			continue
+		}
+		b.openUntil[key] = now.Add(b.opts.CircuitBreakerCooldown)
+		return 0, &budgetViolation{
+			tripped: true,
+			message: fmt.Sprintf("adding %s exceeds the budget of %s (%s used of %s per hour)", bytesString(increase),
+				key, bytesString(used), bytesString(limit)),
+		}
+	}
+	return increase, nil
+}
+
+// record records a resize of the PVC.
+func (b *growthBudget) record(pvc *corev1.PersistentVolumeClaim, increase int64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := growthRecord{
+		time:  now,
+		pvc:   types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name},
+		bytes: increase,
+	}
+	if pvc.Spec.StorageClassName != nil {
+		r.storageClass = *pvc.Spec.StorageClassName
+	}
+	b.records = append(b.records, r)
+}
+
+// exportMetrics exports the state of the budgets of the observed scopes.
+func (b *growthBudget) exportMetrics(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pruneRecords(now)
+
+	for key, until := range b.openUntil {
+		if !now.Before(until) {
+			delete(b.openUntil, key)
+		}
+	}
+	observed := make(map[budgetKey]struct{})
+	for _, keys := range b.observed {
+		for _, key := range keys {
+			observed[key] = struct{}{}
+		}
+	}
+	for key := range observed {
+		metrics.ResizerBudgetUsedBytes.Set(key.scope, key.name, float64(b.usedBytes(key, now)))
+		_, open := b.openUntil[key]
+		metrics.ResizerCircuitBreakerOpen.Set(key.scope, key.name, open)
+	}
+	for key := range b.exported {
+		if _, ok := observed[key]; !ok {
+			metrics.ResizerBudgetUsedBytes.Delete(key.scope, key.name)
+			metrics.ResizerCircuitBreakerOpen.Delete(key.scope, key.name)
+		}
+	}
+	b.exported = observed
+}
+
+// prune forgets the PVCs which are no longer targeted, so that the states of the scopes without
+// targeted PVCs are no longer exported.
+func (b *growthBudget) prune(targets map[types.NamespacedName]struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.observed {
+		if _, ok := targets[key]; !ok {
+			delete(b.observed, key)
+		}
+	}
+}
+
+func bytesString(b int64) string {
+	return resource.NewQuantity(b, resource.BinarySI).String()
+}
+
+// capByGrowthBudget returns the new request capped by the growth budgets, or nil if the growth
+// budgets do not allow resizing the PVC.
+func (w *pvcAutoresizer) capByGrowthBudget(pvc *corev1.PersistentVolumeClaim,
+	newReq resource.Quantity) *resource.Quantity {
+	log := w.log.WithName("resize").WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	growth := newReq.DeepCopy()
+	growth.Sub(curReq)
+	allowed, violation := w.budget.check(pvc, growth.Value(), time.Now())
+	if violation == nil {
+		if allowed == growth.Value() {
+			return &newReq
+		}
+		// The capped request is rounded down to GiB like the size computed by NextSize.
+		cappedBytes := (curReq.Value() + allowed) >> 30 << 30
+		if cappedBytes > curReq.Value() {
+			capped := resource.NewQuantity(cappedBytes, resource.BinarySI)
+			log.Info("cap the resize by the growth budget", "from", newReq.Value(), "to", capped.Value())
+			w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonBudgetExceeded, "Resize",
+				"PVC volume resize is capped from %s to %s by the growth budget", newReq.String(), capped.String())
+			return capped
+		}
+		violation = &budgetViolation{
+			message: fmt.Sprintf("the remaining growth budget %s is less than 1Gi", bytesString(allowed)),
+		}
+	}
+	metrics.ResizerBudgetExceededTotal.Increment(pvc.Name, pvc.Namespace)
+	log.Info("skip resizing because the growth budget is exceeded", "reason", violation.message)
+	if violation.tripped {
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonCircuitBreakerOpen, "Resize",
+			"PVC volume resize is paused for %s because %s", w.opts.Budget.CircuitBreakerCooldown, violation.message)
+	} else {
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonBudgetExceeded, "Resize",
+			"PVC volume resize is skipped because %s", violation.message)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package runners
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+)
+
+var _ = Describe("test growthBudget", func() {
+	newPVC := func(ns, name, scName string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &scName},
+		}
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	It("should allow resizes when no budget is configured", func() {
+		b := newGrowthBudget(BudgetOptions{})
+		pvc := newPVC("ns1", "pvc1", "sc1")
+		for i := 0; i < 10; i++ {
+			Expect(b.check(pvc, 100<<30, now)).To(Equal(int64(100 << 30)))
+			b.record(pvc, 100<<30, now)
+		}
+	})
+
+	It("should open the circuit breaker of the namespace when its budget is exceeded", func() {
+		b := newGrowthBudget(BudgetOptions{
+			MaxBytesPerHourPerNamespace: 10 << 30,
+			CircuitBreakerCooldown:      2 * time.Hour,
+		})
+		pvc1 := newPVC("ns1", "pvc1", "sc1")
+		pvc2 := newPVC("ns1", "pvc2", "sc1")
+		other := newPVC("ns2", "pvc1", "sc1")
+
+		Expect(b.check(pvc1, 8<<30, now)).To(Equal(int64(8 << 30)))
+		b.record(pvc1, 8<<30, now)
+
+		_, v := b.check(pvc2, 4<<30, now.Add(time.Minute))
+		Expect(v).NotTo(BeNil())
+		Expect(v.tripped).To(BeTrue())
+
+		// The breaker pauses resizing in the namespace even after the hourly window passes.
+		_, v = b.check(pvc2, 1<<30, now.Add(90*time.Minute))
+		Expect(v).NotTo(BeNil())
+		Expect(v.tripped).To(BeFalse())
+
+		Expect(b.check(other, 4<<30, now.Add(time.Minute))).To(Equal(int64(4 << 30)))
+		Expect(b.check(pvc2, 4<<30, now.Add(3*time.Hour))).To(Equal(int64(4 << 30)))
+	})
+
+	It("should apply the cluster and StorageClass budgets", func() {
+		b := newGrowthBudget(BudgetOptions{
+			MaxBytesPerHour:                20 << 30,
+			MaxBytesPerHourPerStorageClass: 10 << 30,
+		})
+		Expect(b.check(newPVC("ns1", "pvc1", "sc1"), 10<<30, now)).To(Equal(int64(10 << 30)))
+		b.record(newPVC("ns1", "pvc1", "sc1"), 10<<30, now)
+		_, v := b.check(newPVC("ns2", "pvc1", "sc1"), 1<<30, now)
+		Expect(v).NotTo(BeNil())
+
+		Expect(b.check(newPVC("ns2", "pvc1", "sc2"), 10<<30, now)).To(Equal(int64(10 << 30)))
+		b.record(newPVC("ns2", "pvc1", "sc2"), 10<<30, now)
+		_, v = b.check(newPVC("ns3", "pvc1", "sc3"), 1<<30, now)
+		Expect(v).NotTo(BeNil())
+	})
+
+	It("should cap an increase larger than the budget without opening the circuit breaker", func() {
+		b := newGrowthBudget(BudgetOptions{
+			MaxBytesPerHourPerNamespace: 10 << 30,
+			CircuitBreakerCooldown:      2 * time.Hour,
+		})
+		pvc := newPVC("ns1", "pvc1", "sc1")
+
+		Expect(b.check(pvc, 30<<30, now)).To(Equal(int64(10 << 30)))
+		Expect(b.check(pvc, 4<<30, now)).To(Equal(int64(4 << 30)))
+		b.record(pvc, 4<<30, now)
+		Expect(b.check(pvc, 30<<30, now.Add(time.Minute))).To(Equal(int64(6 << 30)))
+		b.record(pvc, 6<<30, now.Add(time.Minute))
+
+		_, v := b.check(pvc, 30<<30, now.Add(2*time.Minute))
+		Expect(v).NotTo(BeNil())
+		Expect(v.tripped).To(BeFalse())
+		Expect(b.check(pvc, 30<<30, now.Add(time.Hour+time.Minute))).To(Equal(int64(10 << 30)))
+	})
+
+	It("should limit the number of resizes of a PVC per day", func() {
+		b := newGrowthBudget(BudgetOptions{MaxResizesPerPVCPerDay: 2})
+		pvc := newPVC("ns1", "pvc1", "sc1")
+		for i := 0; i < 2; i++ {
+			t := now.Add(time.Duration(i) * time.Hour)
+			Expect(b.check(pvc, 1<<30, t)).To(Equal(int64(1 << 30)))
+			b.record(pvc, 1<<30, t)
+		}
+		_, v := b.check(pvc, 1<<30, now.Add(2*time.Hour))
+		Expect(v).NotTo(BeNil())
+		Expect(v.tripped).To(BeFalse())
+		Expect(b.check(newPVC("ns1", "pvc2", "sc1"), 1<<30, now.Add(2*time.Hour))).To(Equal(int64(1 << 30)))
+		Expect(b.check(pvc, 1<<30, now.Add(24*time.Hour))).To(Equal(int64(1 << 30)))
+	})
+
+	It("should round the capped request down to GiB", func() {
+		w := &pvcAutoresizer{
+			log:      logr.Discard(),
+			recorder: events.NewFakeRecorder(10),
+			budget:   newGrowthBudget(BudgetOptions{MaxBytesPerHourPerNamespace: 1536 << 20}),
+		}
+		pvc := newPVC("ns1", "pvc1", "sc1")
+		pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+
+		newReq := w.capByGrowthBudget(pvc, resource.MustParse("15Gi"))
+		Expect(newReq).NotTo(BeNil())
+		Expect(newReq.Value()).To(Equal(int64(11 << 30)))
+		w.budget.record(pvc, 1<<30, time.Now())
+
+		// The remaining 512Mi is rounded down to the current request.
+		Expect(w.capByGrowthBudget(pvc, resource.MustParse("15Gi"))).To(BeNil())
+	})
+
+	It("should forget the PVCs no longer targeted", func() {
+		b := newGrowthBudget(BudgetOptions{})
+		b.check(newPVC("ns1", "pvc1", "sc1"), 1<<30, now)
+		b.check(newPVC("ns2", "pvc1", "sc1"), 1<<30, now)
+		Expect(b.observed).To(HaveLen(2))
+
+		b.prune(map[types.NamespacedName]struct{}{{Namespace: "ns1", Name: "pvc1"}: {}})
+		Expect(b.observed).To(HaveKey(types.NamespacedName{Namespace: "ns1", Name: "pvc1"}))
+		Expect(b.observed).To(HaveLen(1))
+	})
+})
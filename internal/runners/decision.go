@@ -0,0 +1,420 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DecisionAction is the action decided in an evaluation of a PVC.
+type DecisionAction string
+
+// Actions of the decisions.
+const (
+	DecisionActionResize DecisionAction = "Resize"
+	DecisionActionSkip   DecisionAction = "Skip"
+	DecisionActionError  DecisionAction = "Error"
+)
+
+// DecisionReason is the reason code of a decision.
+type DecisionReason string
+
+// Reasons of the decisions.
+const (
+	ReasonThresholdExceeded           DecisionReason = "ThresholdExceeded"
+	ReasonBelowThreshold              DecisionReason = "BelowThreshold"
+	ReasonInvalidThreshold            DecisionReason = "InvalidThreshold"
+	ReasonInvalidInodesThreshold      DecisionReason = "InvalidInodesThreshold"
+	ReasonInvalidIncrease             DecisionReason = "InvalidIncrease"
+	ReasonInvalidStorageLimit         DecisionReason = "InvalidStorageLimit"
+	ReasonCapacityUnknown             DecisionReason = "CapacityUnknown"
+	ReasonLimitReached                DecisionReason = "LimitReached"
+	ReasonNoVolumeStats               DecisionReason = "NoVolumeStats"
+	ReasonBackoff                     DecisionReason = "Backoff"
+	ReasonExternalReduction           DecisionReason = "ExternalReduction"
+	ReasonResizeInProgress            DecisionReason = "ResizeInProgress"
+	ReasonQuotaExceeded               DecisionReason = "QuotaExceeded"
+	ReasonInsufficientBackendCapacity DecisionReason = "InsufficientBackendCapacity"
+	ReasonBudgetExceeded              DecisionReason = "BudgetExceeded"
+	ReasonExpansionUnsupported        DecisionReason = "ExpansionUnsupported"
+	ReasonAlreadyUpdated              DecisionReason = "AlreadyUpdated"
+	ReasonUpdateFailed                DecisionReason = "UpdateFailed"
+)
+
+// Decision is the record of an evaluation of a PVC. It holds the inputs of the evaluation and
+// the resulting action with the reason.
+type Decision struct {
+	Time         time.Time `json:"time"`
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	StorageClass string    `json:"storageClass,omitempty"`
+
+	Request  resource.Quantity `json:"request"`
+	Capacity resource.Quantity `json:"capacity"`
+	Limit    resource.Quantity `json:"limit"`
+
+	VolumeCapacityBytes int64 `json:"volumeCapacityBytes"`
+	AvailableBytes      int64 `json:"availableBytes"`
+	ThresholdBytes      int64 `json:"thresholdBytes"`
+	AvailableInodes     int64 `json:"availableInodes"`
+	InodesThreshold     int64 `json:"inodesThreshold"`
+	IncreaseBytes       int64 `json:"increaseBytes"`
+
+	Action  DecisionAction     `json:"action"`
+	Reason  DecisionReason     `json:"reason"`
+	NewSize *resource.Quantity `json:"newSize,omitempty"`
+	Message string             `json:"message,omitempty"`
+
+	err error
+}
+
+func newDecision(pvc *corev1.PersistentVolumeClaim) *Decision {
+	d := &Decision{
+		Time:      time.Now().UTC(),
+		Namespace: pvc.Namespace,
+		Name:      pvc.Name,
+		Request:   pvc.Spec.Resources.Requests[corev1.ResourceStorage],
+		Capacity:  pvc.Status.Capacity[corev1.ResourceStorage],
+	}
+	if pvc.Spec.StorageClassName != nil {
+		d.StorageClass = *pvc.Spec.StorageClassName
+	}
+	return d
+}
+
+func (d *Decision) skip(reason DecisionReason, message string) *Decision {
+	d.Action = DecisionActionSkip
+	d.Reason = reason
+	d.Message = message
+	return d
+}
+
+func (d *Decision) fail(reason DecisionReason, err error) error {
+	d.Action = DecisionActionError
+	d.Reason = reason
+	d.Message = err.Error()
+	d.err = err
+	return err
+}
+
+// Err returns the error of the decision if the action is DecisionActionError.
+func (d *Decision) Err() error {
+	return d.err
+}
+
+// ResizeDefaults are the values used for the annotations which are not given to PVCs. Empty
+// fields mean the built-in defaults.
+type ResizeDefaults struct {
+	Threshold       string
+	InodesThreshold string
+	Increase        string
+}
+
+func (r ResizeDefaults) threshold() string {
+	if r.Threshold == "" {
+		return pvcautoresizer.DefaultThreshold
+	}
+	return r.Threshold
+}
+
+func (r ResizeDefaults) inodesThreshold() string {
+	if r.InodesThreshold == "" {
+		return pvcautoresizer.DefaultInodesThreshold
+	}
+	return r.InodesThreshold
+}
+
+func (r ResizeDefaults) increase() string {
+	if r.Increase == "" {
+		return pvcautoresizer.DefaultIncrease
+	}
+	return r.Increase
+}
+
+// Validate returns an error if any of the defaults is not a valid value of its annotation.
+func (r ResizeDefaults) Validate() error {
+	if _, err := convertSizeInBytes(r.threshold(), 1<<30, ""); err != nil {
+		return fmt.Errorf("invalid default threshold: %w", err)
+	}
+	if _, err := convertSize(r.inodesThreshold(), 1<<20, ""); err != nil {
+		return fmt.Errorf("invalid default inodes threshold: %w", err)
+	}
+	if _, err := convertSizeInBytes(r.increase(), 1<<30, ""); err != nil {
+		return fmt.Errorf("invalid default increase: %w", err)
+	}
+	return nil
+}
+
+// EvaluateResize decides whether the PVC should be resized from its annotations and the volume
+// stats. It does not access the cluster, so checks depending on the state of the cluster, such as
+// ResourceQuotas and growth budgets, are not included.
+func EvaluateResize(pvc *corev1.PersistentVolumeClaim, vs *VolumeStats) *Decision {
+	return EvaluateResizeWithDefaults(pvc, vs, ResizeDefaults{})
+}
+
+// EvaluateResizeWithDefaults is EvaluateResize with the defaults of the annotations.
+func EvaluateResizeWithDefaults(pvc *corev1.PersistentVolumeClaim, vs *VolumeStats, defaults ResizeDefaults) *Decision {
+	d := newDecision(pvc)
+	d.VolumeCapacityBytes = vs.CapacityBytes
+	d.AvailableBytes = vs.AvailableBytes
+	d.AvailableInodes = vs.AvailableInodeSize
+
+	threshold, err := convertSizeInBytes(pvc.Annotations[pvcautoresizer.ResizeThresholdAnnotation], vs.CapacityBytes, defaults.threshold())
+	if err != nil {
+		return d.skip(ReasonInvalidThreshold, err.Error())
+	}
+	d.ThresholdBytes = threshold
+
+	annotation := pvc.Annotations[pvcautoresizer.ResizeInodesThresholdAnnotation]
+	inodesThreshold, err := convertSize(annotation, vs.CapacityInodeSize, defaults.inodesThreshold())
+	if err != nil {
+		return d.skip(ReasonInvalidInodesThreshold, err.Error())
+	}
+	d.InodesThreshold = inodesThreshold
+
+	cap, exists := pvc.Status.Capacity[corev1.ResourceStorage]
+	if !exists {
+		return d.skip(ReasonCapacityUnknown, "pvc capacity is not set yet")
+	}
+	if cap.Value() == 0 {
+		return d.skip(ReasonCapacityUnknown, "pvc capacity size is zero")
+	}
+
+	increase, err := convertSizeInBytes(pvc.Annotations[pvcautoresizer.ResizeIncreaseAnnotation], cap.Value(), defaults.increase())
+	if err != nil {
+		return d.skip(ReasonInvalidIncrease, err.Error())
+	}
+	d.IncreaseBytes = increase
+
+	limit, err := PvcStorageLimit(pvc)
+	if err != nil {
+		_ = d.fail(ReasonInvalidStorageLimit, fmt.Errorf("fetching storage limit failed: %w", err))
+		return d
+	}
+	d.Limit = limit
+	if cap.Cmp(limit) >= 0 {
+		return d.skip(ReasonLimitReached, "volume storage limit reached")
+	}
+
+	if threshold <= vs.AvailableBytes && inodesThreshold <= vs.AvailableInodeSize {
+		return d.skip(ReasonBelowThreshold, "")
+	}
+
+	d.Action = DecisionActionResize
+	d.Reason = ReasonThresholdExceeded
+	d.NewSize = NextSize(cap, increase, limit)
+	return d
+}
+
+// NextSize returns the size which the PVC of the capacity is resized to. It is the capacity
+// increased by the bytes, rounded up to GiB and capped at the limit.
+func NextSize(capacity resource.Quantity, increase int64, limit resource.Quantity) *resource.Quantity {
+	newReqBytes := int64(math.Ceil(float64(capacity.Value()+increase)/(1<<30))) << 30
+	newReq := resource.NewQuantity(newReqBytes, resource.BinarySI)
+	if newReq.Cmp(limit) > 0 {
+		return &limit
+	}
+	return newReq
+}
+
+// DecisionSink receives the decision records of the evaluations.
+type DecisionSink interface {
+	// Record records the decision.
+	Record(ctx context.Context, d *Decision) error
+}
+
+// DecisionBuffer is a DecisionSink keeping the latest decisions in a ring buffer. It serves them
+// in JSON over HTTP, optionally filtered by the "namespace" and "name" query parameters.
+type DecisionBuffer struct {
+	mu      sync.Mutex
+	records []Decision
+	next    int
+	full    bool
+}
+
+// NewDecisionBuffer returns a DecisionBuffer keeping the latest size decisions.
+func NewDecisionBuffer(size int) *DecisionBuffer {
+	return &DecisionBuffer{records: make([]Decision, size)}
+}
+
+// Record implements DecisionSink.Record
+func (b *DecisionBuffer) Record(ctx context.Context, d *Decision) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.records) == 0 {
+		return nil
+	}
+	b.records[b.next] = *d
+	b.next = (b.next + 1) % len(b.records)
+	if b.next == 0 {
+		b.full = true
+	}
+	return nil
+}
+
+// List returns the decisions in the buffer from the oldest.
+func (b *DecisionBuffer) List() []Decision {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]Decision{}, b.records[:b.next]...)
+	}
+	return append(append([]Decision{}, b.records[b.next:]...), b.records[:b.next]...)
+}
+
+func (b *DecisionBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ns := r.URL.Query().Get("namespace")
+	name := r.URL.Query().Get("name")
+	decisions := make([]Decision, 0)
+	for _, d := range b.List() {
+		if (ns != "" && d.Namespace != ns) || (name != "" && d.Name != name) {
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(decisions)
+}
+
+type decisionFileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewDecisionFileSink returns a DecisionSink which appends the decisions as JSON lines to the file.
+// The file is rotated to "<path>.1", "<path>.2", ... when its size exceeds maxSize bytes, and
+// at most maxBackups rotated files are kept.
+func NewDecisionFileSink(path string, maxSize int64, maxBackups int) (DecisionSink, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("the max size of the decision log file must be positive")
+	}
+	s := &decisionFileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *decisionFileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *decisionFileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+	for i := s.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Record implements DecisionSink.Record
+func (s *decisionFileSink) Record(ctx context.Context, d *Decision) error {
+	line, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the decision log file.
+func (s *decisionFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// recordDecision logs the decision, sends it to the sinks and emits the events for it if any.
+// Routine decisions and invalid settings are logged with a higher verbosity.
+func (w *pvcAutoresizer) recordDecision(ctx context.Context, pvc *corev1.PersistentVolumeClaim, d *Decision) {
+	level := 0
+	switch d.Reason {
+	case ReasonInvalidThreshold, ReasonInvalidInodesThreshold, ReasonInvalidIncrease, ReasonBackoff:
+		level = logLevelWarn
+	case ReasonBelowThreshold, ReasonResizeInProgress:
+		level = logLevelDebug
+	}
+	w.log.V(level).Info("resize decision", "namespace", d.Namespace, "name", d.Name,
+		"action", d.Action, "reason", d.Reason, "decision", d)
+	w.opts.State.recordDecision(d)
+	w.emitDecisionEvent(pvc, d)
+	w.checkLimitWarning(ctx, pvc, d)
+	if !d.Limit.IsZero() {
+		w.alerts.set(AlertStorageLimitReached, pvc, d.Reason == ReasonLimitReached,
+			fmt.Sprintf("PVC %s/%s has reached the storage limit %s", d.Namespace, d.Name, d.Limit.String()))
+	}
+	for _, sink := range w.opts.DecisionSinks {
+		if err := sink.Record(ctx, d); err != nil {
+			w.log.Error(err, "failed to record decision", "namespace", d.Namespace, "name", d.Name,
+				"sink", fmt.Sprintf("%T", sink))
+		}
+	}
+}
+
+// emitDecisionEvent emits the event for the decision which needs the attention of the users.
+func (w *pvcAutoresizer) emitDecisionEvent(pvc *corev1.PersistentVolumeClaim, d *Decision) {
+	switch d.Reason {
+	case ReasonLimitReached:
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonLimitReached, "Resize",
+			"PVC volume has reached the storage limit %s and will not be resized", d.Limit.String())
+	case ReasonInvalidThreshold, ReasonInvalidInodesThreshold, ReasonInvalidIncrease, ReasonInvalidStorageLimit:
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonInvalidConfig, "Resize",
+			"PVC volume is not resized because of the invalid configuration (%s): %s", d.Reason, d.Message)
+	case ReasonNoVolumeStats:
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeNormal, eventReasonStatsUnavailable, "Resize",
+			"PVC volume stats are not found in the metrics source; the volume may not be mounted by any pod")
+	}
+}
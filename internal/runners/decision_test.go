@@ -0,0 +1,192 @@
+package runners
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func decisionTestPVC(capacity, limit string) *corev1.PersistentVolumeClaim {
+	sc := "test-sc"
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-pvc",
+			Annotations: map[string]string{
+				pvcautoresizer.StorageLimitAnnotation:    limit,
+				pvcautoresizer.ResizeThresholdAnnotation: "20%",
+				pvcautoresizer.ResizeIncreaseAnnotation:  "10Gi",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &sc,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+		},
+	}
+}
+
+func decisionTestStats(capacity, available int64) *VolumeStats {
+	return &VolumeStats{
+		AvailableBytes:     available,
+		CapacityBytes:      capacity,
+		AvailableInodeSize: 1000,
+		CapacityInodeSize:  1000,
+	}
+}
+
+var _ = Describe("test resize decisions", func() {
+	It("should skip the PVC below the threshold", func() {
+		d := EvaluateResize(decisionTestPVC("10Gi", "100Gi"), decisionTestStats(10<<30, 5<<30))
+		Expect(d.Action).To(Equal(DecisionActionSkip))
+		Expect(d.Reason).To(Equal(ReasonBelowThreshold))
+		Expect(d.ThresholdBytes).To(Equal(int64(2 << 30)))
+		Expect(d.StorageClass).To(Equal("test-sc"))
+	})
+
+	It("should decide to resize the PVC exceeding the threshold", func() {
+		d := EvaluateResize(decisionTestPVC("10Gi", "100Gi"), decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionResize))
+		Expect(d.Reason).To(Equal(ReasonThresholdExceeded))
+		Expect(d.NewSize.String()).To(Equal("20Gi"))
+		Expect(d.IncreaseBytes).To(Equal(int64(10 << 30)))
+	})
+
+	It("should cap the new size by the storage limit", func() {
+		d := EvaluateResize(decisionTestPVC("10Gi", "15Gi"), decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionResize))
+		Expect(d.NewSize.String()).To(Equal("15Gi"))
+	})
+
+	It("should skip the PVC reaching the storage limit", func() {
+		d := EvaluateResize(decisionTestPVC("10Gi", "10Gi"), decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionSkip))
+		Expect(d.Reason).To(Equal(ReasonLimitReached))
+	})
+
+	It("should skip the PVC with an invalid threshold", func() {
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.ResizeThresholdAnnotation] = "-1%"
+		d := EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionSkip))
+		Expect(d.Reason).To(Equal(ReasonInvalidThreshold))
+		Expect(d.Message).NotTo(BeEmpty())
+	})
+
+	It("should skip the PVC whose capacity is not set", func() {
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Status.Capacity = nil
+		d := EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionSkip))
+		Expect(d.Reason).To(Equal(ReasonCapacityUnknown))
+	})
+
+	It("should fail for an invalid storage limit", func() {
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] = "invalid"
+		d := EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30))
+		Expect(d.Action).To(Equal(DecisionActionError))
+		Expect(d.Reason).To(Equal(ReasonInvalidStorageLimit))
+		Expect(d.Err()).To(HaveOccurred())
+	})
+
+	It("should use the defaults for the annotations not given", func() {
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		delete(pvc.Annotations, pvcautoresizer.ResizeThresholdAnnotation)
+		delete(pvc.Annotations, pvcautoresizer.ResizeIncreaseAnnotation)
+		defaults := ResizeDefaults{Threshold: "30%", Increase: "5Gi"}
+		d := EvaluateResizeWithDefaults(pvc, decisionTestStats(10<<30, 2<<30), defaults)
+		Expect(d.Action).To(Equal(DecisionActionResize))
+		Expect(d.ThresholdBytes).To(Equal(int64(3 << 30)))
+		Expect(d.NewSize.String()).To(Equal("15Gi"))
+
+		d = EvaluateResize(pvc, decisionTestStats(10<<30, 2<<30))
+		Expect(d.Action).To(Equal(DecisionActionSkip))
+		Expect(d.Reason).To(Equal(ReasonBelowThreshold))
+
+		Expect(defaults.Validate()).To(Succeed())
+		Expect(ResizeDefaults{Threshold: "200%"}.Validate()).To(HaveOccurred())
+		Expect(ResizeDefaults{InodesThreshold: "1Gi"}.Validate()).To(HaveOccurred())
+		Expect(ResizeDefaults{Increase: "-1Gi"}.Validate()).To(HaveOccurred())
+	})
+
+	It("should round the next size up to GiB and cap it by the storage limit", func() {
+		Expect(NextSize(resource.MustParse("10Gi"), 1<<29, resource.MustParse("100Gi")).String()).To(Equal("11Gi"))
+		Expect(NextSize(resource.MustParse("10Gi"), 10<<30, resource.MustParse("100Gi")).String()).To(Equal("20Gi"))
+		Expect(NextSize(resource.MustParse("95Gi"), 10<<30, resource.MustParse("100Gi")).String()).To(Equal("100Gi"))
+	})
+})
+
+var _ = Describe("test decision sinks", func() {
+	ctx := context.Background()
+
+	It("should keep the latest decisions in the buffer", func() {
+		buf := NewDecisionBuffer(2)
+		for i := 0; i < 3; i++ {
+			d := &Decision{Namespace: "default", Name: fmt.Sprintf("pvc-%d", i), Action: DecisionActionSkip}
+			Expect(buf.Record(ctx, d)).To(Succeed())
+		}
+		list := buf.List()
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].Name).To(Equal("pvc-1"))
+		Expect(list[1].Name).To(Equal("pvc-2"))
+
+		rec := httptest.NewRecorder()
+		buf.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/decisions?name=pvc-2", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var served []Decision
+		Expect(json.Unmarshal(rec.Body.Bytes(), &served)).To(Succeed())
+		Expect(served).To(HaveLen(1))
+		Expect(served[0].Name).To(Equal("pvc-2"))
+	})
+
+	It("should rotate the decision log file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "decisions.log")
+		sink, err := NewDecisionFileSink(path, 300, 1)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 3; i++ {
+			d := &Decision{Namespace: "default", Name: fmt.Sprintf("pvc-%d", i), Action: DecisionActionSkip}
+			Expect(sink.Record(ctx, d)).To(Succeed())
+		}
+
+		countLines := func(path string) int {
+			f, err := os.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+			n := 0
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var d Decision
+				Expect(json.Unmarshal(scanner.Bytes(), &d)).To(Succeed())
+				n++
+			}
+			return n
+		}
+		Expect(countLines(path)).To(Equal(1))
+		Expect(countLines(path + ".1")).To(Equal(1))
+		_, err = os.Stat(path + ".2")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		closer, ok := sink.(io.Closer)
+		Expect(ok).To(BeTrue())
+		Expect(closer.Close()).To(Succeed())
+	})
+})
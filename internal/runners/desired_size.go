@@ -0,0 +1,218 @@
+package runners
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// DesiredSize is the storage request of a PVC decided by the resizer.
+type DesiredSize struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Size      string    `json:"size"`
+	Previous  string    `json:"previous"`
+	Time      time.Time `json:"time"`
+}
+
+// DesiredSizeSink receives the desired sizes of PVCs so that they can be written back to the
+// source of the manifests, e.g. a Git repository managed by GitOps tools.
+type DesiredSizeSink interface {
+	// Record records the desired size of a PVC.
+	Record(ctx context.Context, ds DesiredSize) error
+}
+
+type configMapSink struct {
+	client client.Client
+	key    types.NamespacedName
+}
+
+// NewConfigMapSink returns a DesiredSizeSink which stores the desired sizes in a ConfigMap. The
+// data key is "<namespace>.<name>" of the PVC.
+func NewConfigMapSink(c client.Client, key types.NamespacedName) DesiredSizeSink {
+	return &configMapSink{client: c, key: key}
+}
+
+func (s *configMapSink) Record(ctx context.Context, ds DesiredSize) error {
+	dataKey := ds.Namespace + "." + ds.Name
+
+	var cm corev1.ConfigMap
+	err := s.client.Get(ctx, s.key, &cm)
+	if apierrors.IsNotFound(err) {
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.key.Namespace, Name: s.key.Name},
+			Data:       map[string]string{dataKey: ds.Size},
+		}
+		if err := s.client.Create(ctx, &cm); err != nil {
+			metrics.KubernetesClientFailTotal.Increment()
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return err
+	}
+
+	patch := client.MergeFrom(cm.DeepCopy())
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[dataKey] = ds.Size
+	if err := s.client.Patch(ctx, &cm, patch); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return err
+	}
+	return nil
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a DesiredSizeSink which POSTs the desired sizes in JSON to the URL.
+func NewWebhookSink(url string) DesiredSizeSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *webhookSink) Record(ctx context.Context, ds DesiredSize) error {
+	body, err := json.Marshal(ds)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("desired size webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type patchFileSink struct {
+	dir string
+}
+
+// NewPatchFileSink returns a DesiredSizeSink which writes the desired sizes as patch files of
+// PVCs into the directory. The file name is "<namespace>_<name>.yaml".
+func NewPatchFileSink(dir string) DesiredSizeSink {
+	return &patchFileSink{dir: dir}
+}
+
+func (s *patchFileSink) Record(ctx context.Context, ds DesiredSize) error {
+	patch := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata": map[string]any{
+			"namespace": ds.Namespace,
+			"name":      ds.Name,
+		},
+		"spec": map[string]any{
+			"resources": map[string]any{
+				"requests": map[string]any{
+					"storage": ds.Size,
+				},
+			},
+		},
+	}
+	data, err := yaml.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so that readers never see a partial file.
+	path := filepath.Join(s.dir, fmt.Sprintf("%s_%s.yaml", ds.Namespace, ds.Name))
+	tmp, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// recordDesiredSize sends the desired size of the PVC to the sinks. Failures are logged and do
+// not fail the resize since the PVC has already been updated.
+func (w *pvcAutoresizer) recordDesiredSize(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	size, previous resource.Quantity) {
+	ds := DesiredSize{
+		Namespace: pvc.Namespace,
+		Name:      pvc.Name,
+		Size:      size.String(),
+		Previous:  previous.String(),
+		Time:      time.Now().UTC(),
+	}
+	for _, sink := range w.opts.DesiredSizeSinks {
+		if err := sink.Record(ctx, ds); err != nil {
+			w.log.Error(err, "failed to record desired size", "namespace", pvc.Namespace, "name", pvc.Name,
+				"sink", fmt.Sprintf("%T", sink))
+		}
+	}
+}
+
+// detectExternalReduction reports the reduction of the storage request of the PVC below the
+// desired size recorded by the resizer, which is typically done by GitOps tools reverting the PVC
+// to the size in Git. It returns true if the reduction is detected. The desired size annotation is
+// then updated to the current request so that the reduction is reported only once.
+func (w *pvcAutoresizer) detectExternalReduction(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	val, ok := pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation]
+	if !ok {
+		return false, nil
+	}
+	desired, err := resource.ParseQuantity(val)
+	if err != nil {
+		w.log.V(logLevelWarn).Info("failed to parse desired size annotation", "namespace", pvc.Namespace,
+			"name", pvc.Name, "error", err.Error())
+		return false, nil
+	}
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if curReq.Cmp(desired) >= 0 {
+		return false, nil
+	}
+
+	w.log.Info("storage request was reduced externally", "namespace", pvc.Namespace, "name", pvc.Name,
+		"desired", desired.String(), "request", curReq.String())
+	metrics.ResizerExternalReductionTotal.Increment(pvc.Name, pvc.Namespace)
+	w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonExternalReduction, "Resize",
+		"PVC storage request was reduced from %s to %s by others after the resize; "+
+			"write the desired size back to the source of the manifest to avoid resize loops",
+		desired.String(), curReq.String())
+
+	_, err = w.patchPVC(ctx, pvc, func(pvc *corev1.PersistentVolumeClaim) bool {
+		if _, ok := pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation]; !ok {
+			return false
+		}
+		pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation] = curReq.String()
+		return true
+	})
+	return true, err
+}
@@ -0,0 +1,90 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("test desired size sinks", func() {
+	ds := DesiredSize{
+		Namespace: "default",
+		Name:      "test-pvc",
+		Size:      "20Gi",
+		Previous:  "10Gi",
+		Time:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	It("should record the desired size in a ConfigMap", func() {
+		ctx := context.Background()
+		c := fake.NewClientBuilder().Build()
+		key := types.NamespacedName{Namespace: "kube-system", Name: "desired-sizes"}
+		sink := NewConfigMapSink(c, key)
+
+		Expect(sink.Record(ctx, ds)).To(Succeed())
+		other := ds
+		other.Name = "other-pvc"
+		other.Size = "5Gi"
+		Expect(sink.Record(ctx, other)).To(Succeed())
+
+		var cm corev1.ConfigMap
+		Expect(c.Get(ctx, key, &cm)).To(Succeed())
+		Expect(cm.Data).To(Equal(map[string]string{
+			"default.test-pvc":  "20Gi",
+			"default.other-pvc": "5Gi",
+		}))
+	})
+
+	It("should post the desired size to the webhook", func() {
+		var received DesiredSize
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+		}))
+		defer ts.Close()
+
+		Expect(NewWebhookSink(ts.URL).Record(context.Background(), ds)).To(Succeed())
+		Expect(received).To(Equal(ds))
+	})
+
+	It("should fail if the webhook returns an error status", func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		Expect(NewWebhookSink(ts.URL).Record(context.Background(), ds)).NotTo(Succeed())
+	})
+
+	It("should write the patch file", func() {
+		dir := GinkgoT().TempDir()
+		Expect(NewPatchFileSink(dir).Record(context.Background(), ds)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(dir, "default_test-pvc.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(`apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: test-pvc
+  namespace: default
+spec:
+  resources:
+    requests:
+      storage: 20Gi
+`))
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,108 @@
+package runners
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+)
+
+// EventReasonResized is the reason of the events emitted when PVCs are resized.
+const EventReasonResized = "Resized"
+
+// Reasons of the events emitted by pvcAutoresizer.
+const (
+	eventReasonLimitReached                = "ResizeLimitReached"
+	eventReasonApproachingLimit            = "ApproachingLimit"
+	eventReasonInvalidConfig               = "InvalidAutoresizeConfig"
+	eventReasonResizeFailed                = "ResizeFailed"
+	eventReasonStatsUnavailable            = "VolumeStatsUnavailable"
+	eventReasonQuotaExceeded               = "QuotaExceeded"
+	eventReasonInsufficientBackendCapacity = "InsufficientBackendCapacity"
+	eventReasonExpansionFailed             = "VolumeExpansionFailed"
+	eventReasonExpansionStuck              = "VolumeExpansionStuck"
+	eventReasonBudgetExceeded              = "GrowthBudgetExceeded"
+	eventReasonCircuitBreakerOpen          = "CircuitBreakerOpen"
+	eventReasonResizeGaveUp                = "ResizeRetriesExhausted"
+	eventReasonExternalReduction           = "RequestReducedExternally"
+	eventReasonExpansionUnsupported        = "VolumeExpansionUnsupported"
+)
+
+// dedupKey identifies the events of the same condition. The note is not included since it may
+// hold the values changing in every evaluation, e.g. the current usage.
+type dedupKey struct {
+	uid       string
+	eventtype string
+	reason    string
+	action    string
+}
+
+// changeEventReasons are the reasons of the events emitted only when the PVCs change, which are
+// never dropped by dedupRecorder.
+var changeEventReasons = map[string]bool{
+	EventReasonResized:          true,
+	eventReasonApproachingLimit: true,
+}
+
+// dedupRecorder is an events.EventRecorder which drops the events of the same condition as the
+// ones emitted to the same object within the interval, so that repeated conditions do not spam
+// the API server.
+type dedupRecorder struct {
+	recorder events.EventRecorder
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	emitted   map[dedupKey]time.Time
+	lastPrune time.Time
+}
+
+func newDedupRecorder(recorder events.EventRecorder, interval time.Duration) events.EventRecorder {
+	if interval <= 0 {
+		return recorder
+	}
+	return &dedupRecorder{
+		recorder: recorder,
+		interval: interval,
+		now:      time.Now,
+		emitted:  make(map[dedupKey]time.Time),
+	}
+}
+
+// Eventf implements events.EventRecorder.Eventf
+func (r *dedupRecorder) Eventf(regarding runtime.Object, related runtime.Object, eventtype, reason, action,
+	note string, args ...interface{}) {
+	obj, err := meta.Accessor(regarding)
+	if err != nil || changeEventReasons[reason] {
+		r.recorder.Eventf(regarding, related, eventtype, reason, action, note, args...)
+		return
+	}
+	key := dedupKey{
+		uid:       fmt.Sprintf("%s/%s/%s", obj.GetNamespace(), obj.GetName(), obj.GetUID()),
+		eventtype: eventtype,
+		reason:    reason,
+		action:    action,
+	}
+
+	now := r.now()
+	r.mu.Lock()
+	if now.Sub(r.lastPrune) >= r.interval {
+		for k, t := range r.emitted {
+			if now.Sub(t) >= r.interval {
+				delete(r.emitted, k)
+			}
+		}
+		r.lastPrune = now
+	}
+	if t, ok := r.emitted[key]; ok && now.Sub(t) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.emitted[key] = now
+	r.mu.Unlock()
+
+	r.recorder.Eventf(regarding, related, eventtype, reason, action, note, args...)
+}
@@ -0,0 +1,76 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/events"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("test events", func() {
+	It("should drop the events of the same condition within the interval", func() {
+		fake := events.NewFakeRecorder(10)
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		recorder := newDedupRecorder(fake, time.Hour).(*dedupRecorder)
+		recorder.now = func() time.Time { return now }
+		pvc := decisionTestPVC("10Gi", "100Gi")
+
+		recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonResizeFailed, "Resize", "failed: %s", "a")
+		recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonResizeFailed, "Resize", "failed: %s", "a")
+		Expect(fake.Events).To(HaveLen(1))
+
+		// The notes holding the current values do not make the events unique.
+		for _, used := range []string{"9Gi", "10Gi", "11Gi"} {
+			recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonQuotaExceeded, "Resize",
+				"PVC volume cannot be resized because %s of 10Gi is used", used)
+		}
+		Expect(fake.Events).To(HaveLen(2))
+
+		recorder.Eventf(pvc, nil, corev1.EventTypeNormal, EventReasonResized, "Resized", "resized to %s", "20Gi")
+		recorder.Eventf(pvc, nil, corev1.EventTypeNormal, EventReasonResized, "Resized", "resized to %s", "30Gi")
+		Expect(fake.Events).To(HaveLen(4))
+
+		now = now.Add(time.Hour)
+		recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonResizeFailed, "Resize", "failed: %s", "b")
+		Expect(fake.Events).To(HaveLen(5))
+	})
+
+	It("should not wrap the recorder if the interval is 0", func() {
+		fake := events.NewFakeRecorder(10)
+		Expect(newDedupRecorder(fake, 0)).To(BeIdenticalTo(fake))
+	})
+
+	It("should emit the events for the decisions", func() {
+		fake := events.NewFakeRecorder(10)
+		w := &pvcAutoresizer{log: logf.Log, recorder: fake,
+			opts:          Options{LimitWarning: LimitWarningOptions{ResizesRemaining: 1}},
+			limitWarnings: newLimitWarningTracker(nil)}
+		ctx := context.Background()
+
+		pvc := decisionTestPVC("10Gi", "10Gi")
+		w.recordDecision(ctx, pvc, EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30)))
+		Expect(<-fake.Events).To(HavePrefix("Warning " + eventReasonLimitReached))
+
+		pvc = decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.ResizeIncreaseAnnotation] = "invalid"
+		w.recordDecision(ctx, pvc, EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30)))
+		Expect(<-fake.Events).To(HavePrefix("Warning " + eventReasonInvalidConfig))
+
+		pvc = decisionTestPVC("10Gi", "20Gi")
+		pvc.Name = "approaching-pvc"
+		w.recordDecision(ctx, pvc, EvaluateResize(pvc, decisionTestStats(10<<30, 5<<30)))
+		Expect(<-fake.Events).To(HavePrefix("Warning " + eventReasonApproachingLimit))
+
+		w.recordDecision(ctx, pvc, newDecision(pvc).skip(ReasonNoVolumeStats, ""))
+		Expect(<-fake.Events).To(HavePrefix("Normal " + eventReasonStatsUnavailable))
+
+		pvc = decisionTestPVC("10Gi", "100Gi")
+		w.recordDecision(ctx, pvc, EvaluateResize(pvc, decisionTestStats(10<<30, 5<<30)))
+		Expect(fake.Events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,260 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// expansionFailure describes why the expansion of a volume has failed.
+type expansionFailure struct {
+	// infeasible is true if the CSI driver reported that the requested size cannot be satisfied.
+	// Such expansions never succeed unless the request is lowered.
+	infeasible bool
+	message    string
+}
+
+// getExpansionFailure returns the failure of the ongoing expansion reported in the PVC status,
+// or nil if the expansion has not failed.
+func getExpansionFailure(pvc *corev1.PersistentVolumeClaim) *expansionFailure {
+	switch status := pvc.Status.AllocatedResourceStatuses[corev1.ResourceStorage]; status {
+	case corev1.PersistentVolumeClaimControllerResizeInfeasible, corev1.PersistentVolumeClaimNodeResizeInfeasible:
+		failure := &expansionFailure{infeasible: true, message: string(status)}
+		for _, cond := range pvc.Status.Conditions {
+			if isResizeErrorCondition(cond) {
+				failure.message = fmt.Sprintf("%s: %s", status, cond.Message)
+			}
+		}
+		return failure
+	}
+
+	for _, cond := range pvc.Status.Conditions {
+		if isResizeErrorCondition(cond) {
+			return &expansionFailure{message: fmt.Sprintf("%s: %s", cond.Type, cond.Message)}
+		}
+	}
+	return nil
+}
+
+func isResizeErrorCondition(cond corev1.PersistentVolumeClaimCondition) bool {
+	return cond.Status == corev1.ConditionTrue &&
+		(cond.Type == corev1.PersistentVolumeClaimControllerResizeError ||
+			cond.Type == corev1.PersistentVolumeClaimNodeResizeError)
+}
+
+// resizeStartedAt returns the time when the resizer requested the ongoing expansion.
+func resizeStartedAt(pvc *corev1.PersistentVolumeClaim) (time.Time, bool) {
+	val, ok := pvc.Annotations[pvcautoresizer.ResizeStartedAtAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// checkResizeInProgress returns true if the expansion requested by the previous resize has not
+// completed yet. While waiting, it also detects failed or stuck expansions and reports them.
+func (w *pvcAutoresizer) checkResizeInProgress(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	vs *VolumeStats, online bool) (bool, error) {
+	log := w.log.WithName("resize").WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+
+	pending, err := IsExpansionPending(pvc, vs, online)
+	if err != nil {
+		log.V(logLevelWarn).Info("failed to parse pre_cap_bytes annotation", "error", err.Error())
+		// lint:ignore nilerr ignores this because invalid annotations should be allowed.
+		return true, nil
+	}
+	if !pending {
+		w.setResizeStuck(pvc, false, "")
+		w.observeExpansionDuration(ctx, pvc)
+		return false, nil
+	}
+
+	if failure := getExpansionFailure(pvc); failure != nil {
+		w.setResizeStuck(pvc, true, fmt.Sprintf("Volume expansion of PVC %s/%s failed: %s",
+			pvc.Namespace, pvc.Name, failure.message))
+		log.Info("volume expansion failed", "reason", failure.message)
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonExpansionFailed, "Resize",
+			"PVC volume expansion failed: %s", failure.message)
+		if failure.infeasible && w.opts.RecoverExpansionFailure {
+			return true, w.recoverExpansionFailure(ctx, pvc)
+		}
+		return true, nil
+	}
+
+	if !online && isCapacityExpanded(pvc) {
+		// The expansion has completed, but the last-known stats are still the ones before it. It
+		// is not stuck since the stats are updated when the volume is mounted next time.
+		w.setResizeStuck(pvc, false, "")
+		w.observeExpansionDuration(ctx, pvc)
+		log.Info("waiting for the stats of the expanded volume...", "capacity", vs.CapacityBytes)
+		return true, nil
+	}
+
+	if isFileSystemResizePending(pvc) {
+		// The expansion completes when the volume is mounted next time, which is expected for
+		// offline volumes. So, it is not regarded as stuck.
+		w.setResizeStuck(pvc, false, "")
+		log.Info("waiting for the volume to be mounted to complete resizing...", "capacity", vs.CapacityBytes)
+		return true, nil
+	}
+
+	startedAt, ok := resizeStartedAt(pvc)
+	if ok && w.opts.ResizeTimeout > 0 && time.Since(startedAt) > w.opts.ResizeTimeout {
+		// The message includes only the start time and the timeout so that the identical events are
+		// deduplicated while the expansion is stuck.
+		startedAtStr := startedAt.UTC().Format(time.RFC3339)
+		w.setResizeStuck(pvc, true, fmt.Sprintf("Volume expansion of PVC %s/%s started at %s has not completed within %s",
+			pvc.Namespace, pvc.Name, startedAtStr, w.opts.ResizeTimeout))
+		log.Info("volume expansion is stuck", "startedAt", startedAt, "timeout", w.opts.ResizeTimeout)
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonExpansionStuck, "Resize",
+			"PVC volume expansion started at %s has not completed within %s", startedAtStr, w.opts.ResizeTimeout)
+		return true, nil
+	}
+
+	w.setResizeStuck(pvc, false, "")
+	log.Info("waiting for resizing...", "capacity", vs.CapacityBytes)
+	return true, nil
+}
+
+// setResizeStuck exports whether the expansion of the PVC is stuck and raises the alert for it.
+func (w *pvcAutoresizer) setResizeStuck(pvc *corev1.PersistentVolumeClaim, stuck bool, summary string) {
+	metrics.ResizerResizeStuck.Set(pvc.Name, pvc.Namespace, stuck)
+	w.alerts.set(AlertExpansionStuck, pvc, stuck, summary)
+}
+
+// observeExpansionDuration observes the duration of the completed expansion. The annotation of
+// the start time is removed so that the expansion is observed only once.
+func (w *pvcAutoresizer) observeExpansionDuration(ctx context.Context, pvc *corev1.PersistentVolumeClaim) {
+	startedAt, ok := resizeStartedAt(pvc)
+	if !ok {
+		return
+	}
+	var scName string
+	if pvc.Spec.StorageClassName != nil {
+		scName = *pvc.Spec.StorageClassName
+	}
+	metrics.ResizerExpansionDurationSeconds.Observe(scName, time.Since(startedAt).Seconds())
+
+	_, err := w.patchPVC(ctx, pvc, func(pvc *corev1.PersistentVolumeClaim) bool {
+		if _, ok := pvc.Annotations[pvcautoresizer.ResizeStartedAtAnnotation]; !ok {
+			return false
+		}
+		delete(pvc.Annotations, pvcautoresizer.ResizeStartedAtAnnotation)
+		return true
+	})
+	if err != nil {
+		w.log.Error(err, "failed to remove the resize start time", "namespace", pvc.Namespace, "name", pvc.Name)
+	}
+}
+
+// recoverExpansionFailure lowers the storage request of the PVC whose expansion is infeasible to
+// the middle of the current capacity and the request, which is allowed by the Kubernetes feature
+// to recover from volume expansion failure.
+func (w *pvcAutoresizer) recoverExpansionFailure(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	log := w.log.WithName("resize").WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if allocated, ok := pvc.Status.AllocatedResources[corev1.ResourceStorage]; ok && allocated.Cmp(curReq) != 0 {
+		// The request was already lowered and the CSI driver has not retried the expansion yet.
+		return nil
+	}
+	newReqBytes := (capacity.Value() + (curReq.Value()-capacity.Value())/2) >> 30 << 30
+	if newReqBytes <= capacity.Value() {
+		log.Info("cannot recover from volume expansion failure with a smaller size",
+			"capacity", capacity.Value(), "request", curReq.Value())
+		return nil
+	}
+	newReq := resource.NewQuantity(newReqBytes, resource.BinarySI)
+
+	updated, err := w.patchPVC(ctx, pvc, func(pvc *corev1.PersistentVolumeClaim) bool {
+		req := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if req.Cmp(curReq) != 0 {
+			// The request has been modified by others.
+			return false
+		}
+		if pvc.Annotations == nil {
+			pvc.Annotations = make(map[string]string)
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = *newReq
+		pvc.Annotations[pvcautoresizer.ResizeStartedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation] = newReq.String()
+		return true
+	})
+	if err != nil || !updated {
+		return err
+	}
+	log.Info("retry volume expansion with a smaller size", "from", curReq.Value(), "to", newReq.Value())
+	w.recordDesiredSize(ctx, pvc, *newReq, curReq)
+	w.recorder.Eventf(pvc, nil, corev1.EventTypeNormal, EventReasonResized, "Resized",
+		"PVC volume resize is retried with %s after the expansion to %s failed", newReq.String(), curReq.String())
+	return nil
+}
+
+// IsExpansionPending returns true if the expansion requested by the previous resize has not been
+// reflected to the volume yet. online tells whether vs is the current stats of a mounted volume.
+// The last-known stats of offline volumes do not change until they are mounted again, so the
+// expansion of an offline volume is regarded as completed when the PVC status reports the
+// requested capacity and the stats are taken after the previous resize. Otherwise, the stale
+// stats would resize the volume again on every loop. An invalid annotation is returned as an
+// error with true, since the expansion cannot be regarded as completed.
+func IsExpansionPending(pvc *corev1.PersistentVolumeClaim, vs *VolumeStats, online bool) (bool, error) {
+	preCap, exist := pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation]
+	if !exist {
+		return false, nil
+	}
+	preCapBytes, err := strconv.ParseInt(preCap, 10, 64)
+	if err != nil {
+		return true, err
+	}
+	if online {
+		return preCapBytes == vs.CapacityBytes, nil
+	}
+	return !isCapacityExpanded(pvc) || preCapBytes == vs.CapacityBytes, nil
+}
+
+// isCapacityExpanded returns true if the capacity in the PVC status has reached the request.
+func isCapacityExpanded(pvc *corev1.PersistentVolumeClaim) bool {
+	capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+	if !ok {
+		return false
+	}
+	return capacity.Cmp(pvc.Spec.Resources.Requests[corev1.ResourceStorage]) >= 0
+}
+
+// isFileSystemResizePending returns true if the controller-side expansion has finished and the
+// filesystem will be expanded when the volume is mounted next time.
+func isFileSystemResizePending(pvc *corev1.PersistentVolumeClaim) bool {
+	for _, cond := range pvc.Status.Conditions {
+		if cond.Type == corev1.PersistentVolumeClaimFileSystemResizePending && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// getLastKnownMetrics returns the last-known volume stats from the metrics client. It returns an
+// empty map on failure so that the caller does not retry in the same reconciliation.
+func (w *pvcAutoresizer) getLastKnownMetrics(ctx context.Context) map[types.NamespacedName]*VolumeStats {
+	hc, ok := w.metricsClient.(HistoricalMetricsClient)
+	if !ok {
+		return map[types.NamespacedName]*VolumeStats{}
+	}
+	vsMap, err := hc.GetLastKnownMetrics(ctx, w.opts.OfflineStatsLookback)
+	if err != nil {
+		w.log.Error(err, "metricsClient.GetLastKnownMetrics failed")
+		return map[types.NamespacedName]*VolumeStats{}
+	}
+	return vsMap
+}
@@ -20,3 +20,8 @@ func NewFakeClientWrapper(c client.Client) client.Client {
 func (c *fakeClientWrapper) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
 	return errors.New("occurred fake error")
 }
+
+func (c *fakeClientWrapper) Patch(ctx context.Context, obj client.Object, patch client.Patch,
+	opts ...client.PatchOption) error {
+	return errors.New("occurred fake error")
+}
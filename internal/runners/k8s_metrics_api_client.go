@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
 	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
 	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -22,15 +23,33 @@ func NewK8sMetricsApiClient() (MetricsClient, error) {
 	return &k8sMetricsApiClient{}, nil
 }
 
+// NewK8sMetricsApiClientForConfig returns a new k8sMetricsApiClient client accessing the cluster
+// with the config instead of the in-cluster configuration.
+func NewK8sMetricsApiClientForConfig(config *rest.Config) (MetricsClient, error) {
+	return &k8sMetricsApiClient{config: config}, nil
+}
+
 type k8sMetricsApiClient struct {
+	config *rest.Config
 }
 
 func (c *k8sMetricsApiClient) GetMetrics(ctx context.Context) (map[types.NamespacedName]*VolumeStats, error) {
-	// create a Kubernetes client using in-cluster configuration
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		metrics.MetricsClientFailTotal.Increment()
-		return nil, err
+	ctx, span := tracing.Start(ctx, "GetMetrics", tracing.MetricsSourceKey.String("kubelet"))
+	pvcUsage, err := c.getMetrics(ctx)
+	tracing.End(span, err)
+	return pvcUsage, err
+}
+
+func (c *k8sMetricsApiClient) getMetrics(ctx context.Context) (map[types.NamespacedName]*VolumeStats, error) {
+	// create a Kubernetes client using in-cluster configuration unless the config is given
+	config := c.config
+	if config == nil {
+		var err error
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			metrics.MetricsClientFailTotal.Increment()
+			return nil, err
+		}
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
@@ -79,6 +98,15 @@ func (c *k8sMetricsApiClient) GetMetrics(ctx context.Context) (map[types.Namespa
 
 func getPVCUsageFromK8sMetricsAPI(
 	ctx context.Context, clientset *kubernetes.Clientset, nodeName string,
+) (map[types.NamespacedName]*VolumeStats, error) {
+	ctx, span := tracing.Start(ctx, "GetNodeMetrics", tracing.NodeNameKey.String(nodeName))
+	pvcUsage, err := getPVCUsageFromNode(ctx, clientset, nodeName)
+	tracing.End(span, err)
+	return pvcUsage, err
+}
+
+func getPVCUsageFromNode(
+	ctx context.Context, clientset *kubernetes.Clientset, nodeName string,
 ) (map[types.NamespacedName]*VolumeStats, error) {
 	// make the request to the api /metrics endpoint and handle the response
 	req := clientset.
@@ -0,0 +1,367 @@
+package runners
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// LimitWarningOptions holds the warning levels of the PVCs approaching their storage limits.
+type LimitWarningOptions struct {
+	// UsedPercentages are the percentages of the storage limit used by the capacity of the volume
+	// at which the warnings are raised, e.g. 80 and 95.
+	UsedPercentages []float64
+
+	// ResizesRemaining raises the warning when the estimated number of the resizes remaining until
+	// the storage limit is this or less. 0 disables it.
+	ResizesRemaining int
+
+	// Notifiers are notified when a PVC enters, changes or leaves the warning level.
+	Notifiers []LimitNotifier
+}
+
+// LimitWarning is the warning level of a PVC approaching its storage limit.
+type LimitWarning struct {
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	StorageClass string            `json:"storageClass,omitempty"`
+	Capacity     resource.Quantity `json:"capacity"`
+	Limit        resource.Quantity `json:"limit"`
+
+	// UsedRatio is the ratio of the capacity to the storage limit.
+	UsedRatio float64 `json:"usedRatio"`
+
+	// ResizesRemaining is the number of the resizes remaining until the storage limit, estimated
+	// from the current increase.
+	ResizesRemaining int `json:"resizesRemaining"`
+
+	// UsedPercentageLevel is the highest level of UsedPercentages reached. 0 means none.
+	UsedPercentageLevel float64 `json:"usedPercentageLevel,omitempty"`
+
+	// ResizesRemainingLevel is true if ResizesRemaining is at or below the level.
+	ResizesRemainingLevel bool `json:"resizesRemainingLevel,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Firing returns true if the PVC is at any warning level.
+func (lw *LimitWarning) Firing() bool {
+	return lw.UsedPercentageLevel > 0 || lw.ResizesRemainingLevel
+}
+
+// level returns the string identifying the warning level. It is empty if the warning is not firing.
+func (lw *LimitWarning) level() string {
+	if !lw.Firing() {
+		return ""
+	}
+	return fmt.Sprintf("%g/%t", lw.UsedPercentageLevel, lw.ResizesRemainingLevel)
+}
+
+// Summary returns the human readable description of the warning.
+func (lw *LimitWarning) Summary() string {
+	if !lw.Firing() {
+		return fmt.Sprintf("PVC %s/%s is no longer approaching the storage limit %s",
+			lw.Namespace, lw.Name, lw.Limit.String())
+	}
+	return fmt.Sprintf("PVC %s/%s has used %.0f%% of the storage limit %s; %d resizes remain",
+		lw.Namespace, lw.Name, lw.UsedRatio*100, lw.Limit.String(), lw.ResizesRemaining)
+}
+
+// Evaluate returns the warning level of the PVC of the decision. It returns nil if the decision
+// does not have the capacity, the increase and the storage limit of the PVC.
+func (o *LimitWarningOptions) Evaluate(d *Decision) *LimitWarning {
+	if d.Action == DecisionActionError || d.Limit.IsZero() || d.Capacity.IsZero() || d.IncreaseBytes <= 0 {
+		return nil
+	}
+	lw := &LimitWarning{
+		Namespace:    d.Namespace,
+		Name:         d.Name,
+		StorageClass: d.StorageClass,
+		Capacity:     d.Capacity,
+		Limit:        d.Limit,
+		UsedRatio:    float64(d.Capacity.Value()) / float64(d.Limit.Value()),
+		Time:         d.Time,
+	}
+	if headroom := d.Limit.Value() - d.Capacity.Value(); headroom > 0 {
+		lw.ResizesRemaining = int(math.Ceil(float64(headroom) / float64(d.IncreaseBytes)))
+	}
+	for _, p := range o.UsedPercentages {
+		if p > 0 && lw.UsedRatio*100 >= p && p > lw.UsedPercentageLevel {
+			lw.UsedPercentageLevel = p
+		}
+	}
+	lw.ResizesRemainingLevel = o.ResizesRemaining > 0 && lw.ResizesRemaining <= o.ResizesRemaining
+	return lw
+}
+
+// limitNotifyRetryInterval is the interval to retry the notifications which have failed.
+const limitNotifyRetryInterval = time.Minute
+
+// limitWarningTracker tracks the warning levels of PVCs to notify only their changes. The
+// notifications are sent by run apart from the reconciliation, and a level is regarded as
+// notified only after all the notifiers have succeeded. The failed notifications are retried.
+type limitWarningTracker struct {
+	mu        sync.Mutex
+	notifiers []LimitNotifier
+	// notified holds the firing warnings notified last.
+	notified map[types.NamespacedName]LimitWarning
+	// pending holds the warnings whose levels differ from the notified ones.
+	pending map[types.NamespacedName]LimitWarning
+	wakeup  chan struct{}
+}
+
+func newLimitWarningTracker(notifiers []LimitNotifier) *limitWarningTracker {
+	return &limitWarningTracker{
+		notifiers: notifiers,
+		notified:  make(map[types.NamespacedName]LimitWarning),
+		pending:   make(map[types.NamespacedName]LimitWarning),
+		wakeup:    make(chan struct{}, 1),
+	}
+}
+
+// setNotifiers replaces the notifiers. The pending notifications are sent to the new ones.
+func (t *limitWarningTracker) setNotifiers(notifiers []LimitNotifier) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notifiers = notifiers
+}
+
+// update records the warning level of the PVC and returns true if it has changed from the last
+// recorded one. The change is notified asynchronously.
+func (t *limitWarningTracker) update(lw *LimitWarning) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := types.NamespacedName{Namespace: lw.Namespace, Name: lw.Name}
+	last, ok := t.pending[key]
+	if !ok {
+		last = t.notified[key]
+	}
+	changed := last.level() != lw.level()
+	t.setPending(key, *lw)
+	return changed
+}
+
+// setPending sets the warning to notify unless its level has already been notified. t.mu must be held.
+func (t *limitWarningTracker) setPending(key types.NamespacedName, lw LimitWarning) {
+	notified := t.notified[key]
+	if notified.level() == lw.level() {
+		delete(t.pending, key)
+		return
+	}
+	t.pending[key] = lw
+	select {
+	case t.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// prune resolves the warnings of the PVCs not in targets.
+func (t *limitWarningTracker) prune(targets map[types.NamespacedName]struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.pending {
+		if _, ok := targets[key]; !ok {
+			delete(t.pending, key)
+		}
+	}
+	now := time.Now()
+	for key, lw := range t.notified {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		lw.UsedPercentageLevel = 0
+		lw.ResizesRemainingLevel = false
+		lw.Time = now
+		t.setPending(key, lw)
+	}
+}
+
+// flush sends the pending notifications. The warnings failed to be notified are kept pending.
+func (t *limitWarningTracker) flush(ctx context.Context) error {
+	t.mu.Lock()
+	notifiers := t.notifiers
+	pending := make([]LimitWarning, 0, len(t.pending))
+	for _, lw := range t.pending {
+		pending = append(pending, lw)
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, lw := range pending {
+		failed := false
+		for _, n := range notifiers {
+			if err := n.Notify(ctx, lw); err != nil {
+				errs = append(errs, fmt.Errorf("failed to notify %s/%s to %T: %w", lw.Namespace, lw.Name, n, err))
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+
+		t.mu.Lock()
+		key := types.NamespacedName{Namespace: lw.Namespace, Name: lw.Name}
+		if lw.Firing() {
+			t.notified[key] = lw
+		} else {
+			delete(t.notified, key)
+		}
+		// The level may have changed again while notifying.
+		if latest, ok := t.pending[key]; ok {
+			t.setPending(key, latest)
+		}
+		t.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// run sends the notifications when the warning levels change, and retries the failed ones.
+func (t *limitWarningTracker) run(ctx context.Context, log logr.Logger) {
+	ticker := time.NewTicker(limitNotifyRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.wakeup:
+		case <-ticker.C:
+		}
+		if err := t.flush(ctx); err != nil {
+			log.Error(err, "failed to notify limit warnings")
+		}
+	}
+}
+
+// checkLimitWarning exports the usage of the storage limit of the PVC, and emits the event and
+// the notifications if the warning level of the PVC has changed.
+func (w *pvcAutoresizer) checkLimitWarning(ctx context.Context, pvc *corev1.PersistentVolumeClaim, d *Decision) {
+	lw := w.opts.LimitWarning.Evaluate(d)
+	if lw == nil {
+		return
+	}
+	metrics.ResizerLimitUsedRatio.Set(pvc.Name, pvc.Namespace, lw.UsedRatio)
+	metrics.ResizerResizesRemaining.Set(pvc.Name, pvc.Namespace, float64(lw.ResizesRemaining))
+
+	if !w.limitWarnings.update(lw) {
+		return
+	}
+	// The PVC at the limit is reported by the ResizeLimitReached event.
+	if lw.Firing() && lw.ResizesRemaining > 0 {
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonApproachingLimit, "Resize",
+			"PVC volume has used %.0f%% of the storage limit %s; %d resizes remain",
+			lw.UsedRatio*100, lw.Limit.String(), lw.ResizesRemaining)
+	}
+}
+
+// LimitNotifier receives the changes of the warning levels of PVCs approaching their storage limits.
+type LimitNotifier interface {
+	// Notify notifies the warning level of a PVC. The warning is resolved if it is not firing.
+	Notify(ctx context.Context, lw LimitWarning) error
+}
+
+// limitWebhookPayload is the body of the notifications. "text" is shown by Slack incoming
+// webhooks, and the rest follows the webhook payload of Alertmanager.
+type limitWebhookPayload struct {
+	Text    string              `json:"text"`
+	Version string              `json:"version"`
+	Status  string              `json:"status"`
+	Alerts  []limitWebhookAlert `json:"alerts"`
+}
+
+type limitWebhookAlert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// limitWarningAlertName is the alert name of the notifications.
+const limitWarningAlertName = "PVCApproachingStorageLimit"
+
+type limitWebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewLimitWebhookNotifier returns a LimitNotifier which POSTs the warnings in JSON to the URL.
+// The payload is accepted by Slack incoming webhooks and by receivers of the Alertmanager webhooks.
+func NewLimitWebhookNotifier(url string) LimitNotifier {
+	return &limitWebhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func limitWebhookPayloadOf(lw LimitWarning) limitWebhookPayload {
+	status := "firing"
+	severity := "warning"
+	var endsAt *time.Time
+	if !lw.Firing() {
+		status = "resolved"
+		severity = "none"
+		endsAt = &lw.Time
+	}
+	labels := map[string]string{
+		"alertname":             limitWarningAlertName,
+		"namespace":             lw.Namespace,
+		"persistentvolumeclaim": lw.Name,
+		"severity":              severity,
+	}
+	if lw.StorageClass != "" {
+		labels["storageclass"] = lw.StorageClass
+	}
+	annotations := map[string]string{
+		"summary":           lw.Summary(),
+		"capacity":          lw.Capacity.String(),
+		"storage_limit":     lw.Limit.String(),
+		"used_ratio":        strconv.FormatFloat(lw.UsedRatio, 'f', 4, 64),
+		"resizes_remaining": strconv.Itoa(lw.ResizesRemaining),
+	}
+	if lw.UsedPercentageLevel > 0 {
+		annotations["used_percentage_level"] = strconv.FormatFloat(lw.UsedPercentageLevel, 'g', -1, 64)
+	}
+	return limitWebhookPayload{
+		Text:    lw.Summary(),
+		Version: "4",
+		Status:  status,
+		Alerts: []limitWebhookAlert{{
+			Status:      status,
+			Labels:      labels,
+			Annotations: annotations,
+			StartsAt:    lw.Time,
+			EndsAt:      endsAt,
+		}},
+	}
+}
+
+func (n *limitWebhookNotifier) Notify(ctx context.Context, lw LimitWarning) error {
+	body, err := json.Marshal(limitWebhookPayloadOf(lw))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("limit warning webhook returned %s", resp.Status)
+	}
+	return nil
+}
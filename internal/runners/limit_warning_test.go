@@ -0,0 +1,155 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("test limit warnings", func() {
+	opts := LimitWarningOptions{UsedPercentages: []float64{80, 95}, ResizesRemaining: 1}
+
+	It("should evaluate the warning levels", func() {
+		lw := opts.Evaluate(EvaluateResize(decisionTestPVC("50Gi", "100Gi"), decisionTestStats(50<<30, 40<<30)))
+		Expect(lw.UsedRatio).To(Equal(0.5))
+		Expect(lw.ResizesRemaining).To(Equal(5))
+		Expect(lw.Firing()).To(BeFalse())
+
+		lw = opts.Evaluate(EvaluateResize(decisionTestPVC("80Gi", "100Gi"), decisionTestStats(80<<30, 70<<30)))
+		Expect(lw.UsedPercentageLevel).To(Equal(80.0))
+		Expect(lw.ResizesRemaining).To(Equal(2))
+		Expect(lw.ResizesRemainingLevel).To(BeFalse())
+
+		lw = opts.Evaluate(EvaluateResize(decisionTestPVC("95Gi", "100Gi"), decisionTestStats(95<<30, 90<<30)))
+		Expect(lw.UsedPercentageLevel).To(Equal(95.0))
+		Expect(lw.ResizesRemaining).To(Equal(1))
+		Expect(lw.ResizesRemainingLevel).To(BeTrue())
+
+		lw = opts.Evaluate(EvaluateResize(decisionTestPVC("100Gi", "100Gi"), decisionTestStats(100<<30, 1<<30)))
+		Expect(lw.UsedRatio).To(Equal(1.0))
+		Expect(lw.ResizesRemaining).To(Equal(0))
+		Expect(lw.Firing()).To(BeTrue())
+
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		pvc.Annotations[pvcautoresizer.ResizeIncreaseAnnotation] = "invalid"
+		Expect(opts.Evaluate(EvaluateResize(pvc, decisionTestStats(10<<30, 1<<30)))).To(BeNil())
+		Expect(opts.Evaluate(newDecision(pvc).skip(ReasonNoVolumeStats, ""))).To(BeNil())
+	})
+
+	It("should notify only the changes of the warning levels", func() {
+		var received []limitWebhookPayload
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			var payload limitWebhookPayload
+			Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+			received = append(received, payload)
+		}))
+		defer ts.Close()
+
+		o := opts
+		o.Notifiers = []LimitNotifier{NewLimitWebhookNotifier(ts.URL)}
+		fake := events.NewFakeRecorder(10)
+		w := &pvcAutoresizer{log: logf.Log, recorder: fake, opts: Options{LimitWarning: o},
+			limitWarnings: newLimitWarningTracker(o.Notifiers)}
+		ctx := context.Background()
+		evaluate := func(capacity string) {
+			pvc := decisionTestPVC(capacity, "100Gi")
+			w.checkLimitWarning(ctx, pvc, EvaluateResize(pvc, decisionTestStats(10<<30, 5<<30)))
+			Expect(w.limitWarnings.flush(ctx)).To(Succeed())
+		}
+
+		evaluate("50Gi")
+		Expect(received).To(BeEmpty())
+		Expect(fake.Events).To(BeEmpty())
+
+		evaluate("80Gi")
+		evaluate("80Gi")
+		Expect(received).To(HaveLen(1))
+		Expect(received[0].Status).To(Equal("firing"))
+		Expect(received[0].Text).To(Equal("PVC default/test-pvc has used 80% of the storage limit 100Gi; 2 resizes remain"))
+		Expect(received[0].Alerts).To(HaveLen(1))
+		Expect(received[0].Alerts[0].Labels).To(Equal(map[string]string{
+			"alertname":             limitWarningAlertName,
+			"namespace":             "default",
+			"persistentvolumeclaim": "test-pvc",
+			"storageclass":          "test-sc",
+			"severity":              "warning",
+		}))
+		Expect(received[0].Alerts[0].Annotations["used_percentage_level"]).To(Equal("80"))
+		Expect(received[0].Alerts[0].EndsAt).To(BeNil())
+		Expect(<-fake.Events).To(HavePrefix("Warning " + eventReasonApproachingLimit))
+		Expect(fake.Events).To(BeEmpty())
+
+		evaluate("95Gi")
+		Expect(received).To(HaveLen(2))
+		Expect(received[1].Alerts[0].Annotations["resizes_remaining"]).To(Equal("1"))
+		Expect(<-fake.Events).To(HavePrefix("Warning " + eventReasonApproachingLimit))
+
+		evaluate("50Gi")
+		Expect(received).To(HaveLen(3))
+		Expect(received[2].Status).To(Equal("resolved"))
+		Expect(received[2].Alerts[0].EndsAt).NotTo(BeNil())
+
+		By("resolving the warnings of the pruned PVCs")
+		evaluate("80Gi")
+		Expect(received).To(HaveLen(4))
+		w.limitWarnings.prune(map[types.NamespacedName]struct{}{})
+		Expect(w.limitWarnings.flush(ctx)).To(Succeed())
+		Expect(received).To(HaveLen(5))
+		Expect(received[4].Status).To(Equal("resolved"))
+		Expect(received[4].Alerts[0].Labels["persistentvolumeclaim"]).To(Equal("test-pvc"))
+
+		w.limitWarnings.prune(map[types.NamespacedName]struct{}{})
+		Expect(w.limitWarnings.flush(ctx)).To(Succeed())
+		Expect(received).To(HaveLen(5))
+	})
+
+	It("should retry the notifications which have failed", func() {
+		var status int
+		received := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received++
+			w.WriteHeader(status)
+		}))
+		defer ts.Close()
+
+		t := newLimitWarningTracker([]LimitNotifier{NewLimitWebhookNotifier(ts.URL)})
+		ctx := context.Background()
+		lw := opts.Evaluate(EvaluateResize(decisionTestPVC("95Gi", "100Gi"), decisionTestStats(95<<30, 90<<30)))
+		Expect(t.update(lw)).To(BeTrue())
+
+		status = http.StatusServiceUnavailable
+		Expect(t.flush(ctx)).NotTo(Succeed())
+		Expect(t.flush(ctx)).NotTo(Succeed())
+		Expect(received).To(Equal(2))
+		Expect(t.update(lw)).To(BeFalse())
+
+		status = http.StatusOK
+		Expect(t.flush(ctx)).To(Succeed())
+		Expect(t.flush(ctx)).To(Succeed())
+		Expect(received).To(Equal(3))
+		Expect(t.update(lw)).To(BeFalse())
+		Expect(t.flush(ctx)).To(Succeed())
+		Expect(received).To(Equal(3))
+	})
+
+	It("should fail if the webhook returns an error status", func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer ts.Close()
+
+		lw := opts.Evaluate(EvaluateResize(decisionTestPVC("95Gi", "100Gi"), decisionTestStats(95<<30, 90<<30)))
+		Expect(NewLimitWebhookNotifier(ts.URL).Notify(context.Background(), *lw)).NotTo(Succeed())
+	})
+})
@@ -2,6 +2,7 @@ package runners
 
 import (
 	"context"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -23,10 +24,19 @@ type MetricsClient interface {
 	GetMetrics(ctx context.Context) (map[types.NamespacedName]*VolumeStats, error)
 }
 
+// HistoricalMetricsClient is a MetricsClient which can also return the last-known volume stats of
+// PVCs whose metrics are no longer exported, such as volumes not mounted by any pod.
+type HistoricalMetricsClient interface {
+	MetricsClient
+
+	// GetLastKnownMetrics returns the latest volume stats of PVCs observed within the lookback period.
+	GetLastKnownMetrics(ctx context.Context, lookback time.Duration) (map[types.NamespacedName]*VolumeStats, error)
+}
+
 // VolumeStats is a struct containing metrics used by pvc-autoresizer
 type VolumeStats struct {
-	AvailableBytes     int64
-	CapacityBytes      int64
-	AvailableInodeSize int64
-	CapacityInodeSize  int64
+	AvailableBytes     int64 `json:"availableBytes"`
+	CapacityBytes      int64 `json:"capacityBytes"`
+	AvailableInodeSize int64 `json:"availableInodeSize"`
+	CapacityInodeSize  int64 `json:"capacityInodeSize"`
 }
@@ -2,9 +2,12 @@ package runners
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -12,8 +15,9 @@ import (
 )
 
 type prometheusClientMock struct {
-	stats map[types.NamespacedName]*VolumeStats
-	mutex sync.Mutex
+	stats     map[types.NamespacedName]*VolumeStats
+	lastKnown map[types.NamespacedName]*VolumeStats
+	mutex     sync.Mutex
 }
 
 func (c *prometheusClientMock) GetMetrics(ctx context.Context) (map[types.NamespacedName]*VolumeStats, error) {
@@ -26,6 +30,26 @@ func (c *prometheusClientMock) GetMetrics(ctx context.Context) (map[types.Namesp
 	return copied, nil
 }
 
+func (c *prometheusClientMock) GetLastKnownMetrics(ctx context.Context,
+	lookback time.Duration) (map[types.NamespacedName]*VolumeStats, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	copied := make(map[types.NamespacedName]*VolumeStats)
+	for k, v := range c.lastKnown {
+		copied[k] = v
+	}
+	return copied, nil
+}
+
+func (c *prometheusClientMock) setLastKnown(key types.NamespacedName, stats *VolumeStats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.lastKnown == nil {
+		c.lastKnown = make(map[types.NamespacedName]*VolumeStats)
+	}
+	c.lastKnown[key] = stats
+}
+
 func (c *prometheusClientMock) setResponce(key types.NamespacedName, stats *VolumeStats) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -62,4 +86,34 @@ var _ = Describe("test prometheusClient", func() {
 		}
 		Expect(value).NotTo(Equal(0))
 	})
+
+	It("test last-known metrics", func() {
+		var queries []string
+		var mu sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.FormValue("query")
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+				`{"metric":{"namespace":"default","persistentvolumeclaim":"offline-pvc"},"value":[0,"%d"]}]}}`,
+				len(query))
+		}))
+		defer ts.Close()
+
+		c, err := NewPrometheusClient(ts.URL)
+		Expect(err).ToNot(HaveOccurred())
+		hc, ok := c.(HistoricalMetricsClient)
+		Expect(ok).To(BeTrue())
+		vsMap, err := hc.GetLastKnownMetrics(context.TODO(), 7*24*time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vsMap).To(HaveKey(types.NamespacedName{Namespace: "default", Name: "offline-pvc"}))
+
+		Expect(queries).To(HaveLen(4))
+		for _, q := range queries {
+			Expect(strings.HasPrefix(q, "last_over_time(kubelet_volume_stats_")).To(BeTrue(), q)
+			Expect(strings.HasSuffix(q, "[1w])")).To(BeTrue(), q)
+		}
+	})
 })
@@ -0,0 +1,99 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NamespaceFilter selects the namespaces whose PVCs are resized. Unless the filter is empty, a
+// namespace is opted out by setting AutoResizeEnabledKey to "false".
+type NamespaceFilter struct {
+	// Selector selects the namespaces by their labels. nil selects all namespaces.
+	Selector labels.Selector
+
+	// ExcludeSelector excludes the namespaces selected by their labels. nil excludes none.
+	ExcludeSelector labels.Selector
+
+	// Exclude are the names of the namespaces to exclude.
+	Exclude []string
+}
+
+// ParseNamespaceFilter returns a NamespaceFilter from the label selectors and the excluded
+// namespaces. Empty selectors are regarded as not given.
+func ParseNamespaceFilter(selector, excludeSelector string, exclude []string) (NamespaceFilter, error) {
+	f := NamespaceFilter{Exclude: exclude}
+	var err error
+	if selector != "" {
+		f.Selector, err = labels.Parse(selector)
+		if err != nil {
+			return f, fmt.Errorf("invalid namespace selector %q: %w", selector, err)
+		}
+	}
+	if excludeSelector != "" {
+		f.ExcludeSelector, err = labels.Parse(excludeSelector)
+		if err != nil {
+			return f, fmt.Errorf("invalid namespace exclude selector %q: %w", excludeSelector, err)
+		}
+	}
+	return f, nil
+}
+
+// isEmpty returns true if the filter selects all the namespaces regardless of their labels.
+func (f *NamespaceFilter) isEmpty() bool {
+	return f.Selector == nil && f.ExcludeSelector == nil && len(f.Exclude) == 0
+}
+
+// Matches returns true if the PVCs in the namespace should be resized.
+func (f *NamespaceFilter) Matches(ns *corev1.Namespace) bool {
+	if slices.Contains(f.Exclude, ns.Name) {
+		return false
+	}
+	if ns.Annotations[pvcautoresizer.AutoResizeEnabledKey] == "false" {
+		return false
+	}
+	set := labels.Set(ns.Labels)
+	if f.ExcludeSelector != nil && f.ExcludeSelector.Matches(set) {
+		return false
+	}
+	return f.Selector == nil || f.Selector.Matches(set)
+}
+
+// namespaceSelection is the result of NamespaceFilter for the namespaces at a time.
+type namespaceSelection struct {
+	filter   NamespaceFilter
+	selected map[string]bool
+}
+
+// selectNamespaces evaluates the filter for all the namespaces. The namespaces are listed in every
+// call, so the changes of their labels and annotations are reflected without a restart. An empty
+// filter selects all the namespaces without listing them.
+func selectNamespaces(ctx context.Context, c client.Reader, filter NamespaceFilter) (*namespaceSelection, error) {
+	if filter.isEmpty() {
+		return &namespaceSelection{filter: filter}, nil
+	}
+	var nss corev1.NamespaceList
+	if err := c.List(ctx, &nss); err != nil {
+		return nil, err
+	}
+	s := &namespaceSelection{filter: filter, selected: make(map[string]bool, len(nss.Items))}
+	for i := range nss.Items {
+		s.selected[nss.Items[i].Name] = filter.Matches(&nss.Items[i])
+	}
+	return s, nil
+}
+
+// contains returns true if the PVCs in the namespace should be resized. A namespace not listed yet
+// is evaluated without its labels and annotations.
+func (s *namespaceSelection) contains(name string) bool {
+	if selected, ok := s.selected[name]; ok {
+		return selected
+	}
+	return s.filter.Matches(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+}
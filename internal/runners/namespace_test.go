@@ -0,0 +1,84 @@
+package runners
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("test namespace filter", func() {
+	namespace := func(name string, labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations},
+		}
+	}
+
+	It("should select the namespaces by the label selectors", func() {
+		f, err := ParseNamespaceFilter("autoresize in (enabled)", "tier=system", []string{"excluded"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(f.Matches(namespace("ns1", map[string]string{"autoresize": "enabled"}, nil))).To(BeTrue())
+		Expect(f.Matches(namespace("ns2", nil, nil))).To(BeFalse())
+		Expect(f.Matches(namespace("ns3", map[string]string{"autoresize": "enabled", "tier": "system"}, nil))).
+			To(BeFalse())
+		Expect(f.Matches(namespace("excluded", map[string]string{"autoresize": "enabled"}, nil))).To(BeFalse())
+
+		_, err = ParseNamespaceFilter("autoresize in", "", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should exclude the namespaces opted out by the annotation", func() {
+		var f NamespaceFilter
+		Expect(f.Matches(namespace("ns1", nil, nil))).To(BeTrue())
+		Expect(f.Matches(namespace("ns1", nil, map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true"}))).
+			To(BeTrue())
+		Expect(f.Matches(namespace("ns1", nil, map[string]string{pvcautoresizer.AutoResizeEnabledKey: "false"}))).
+			To(BeFalse())
+	})
+
+	It("should reflect the current labels of the namespaces", func() {
+		ns := namespace("ns1", nil, nil)
+		c := fake.NewClientBuilder().WithObjects(ns).Build()
+		f, err := ParseNamespaceFilter("autoresize=enabled", "", []string{"excluded"})
+		Expect(err).NotTo(HaveOccurred())
+
+		s, err := selectNamespaces(context.Background(), c, f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.contains("ns1")).To(BeFalse())
+
+		ns.Labels = map[string]string{"autoresize": "enabled"}
+		Expect(c.Update(context.Background(), ns)).To(Succeed())
+		s, err = selectNamespaces(context.Background(), c, f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.contains("ns1")).To(BeTrue())
+
+		// The namespaces not listed yet are evaluated without labels.
+		Expect(s.contains("unknown")).To(BeFalse())
+		s, err = selectNamespaces(context.Background(), c, NamespaceFilter{Exclude: []string{"excluded"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.contains("unknown")).To(BeTrue())
+		Expect(s.contains("excluded")).To(BeFalse())
+	})
+
+	It("should select all the namespaces without listing them by the empty filter", func() {
+		ns := namespace("ns1", nil, map[string]string{pvcautoresizer.AutoResizeEnabledKey: "false"})
+		c := fake.NewClientBuilder().WithObjects(ns).WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				return errors.New("namespaces should not be listed")
+			},
+		}).Build()
+
+		s, err := selectNamespaces(context.Background(), c, NamespaceFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.contains("ns1")).To(BeTrue())
+		Expect(s.contains("unknown")).To(BeTrue())
+	})
+})
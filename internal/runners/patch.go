@@ -0,0 +1,56 @@
+package runners
+
+import (
+	"context"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// patchPVC applies mutate to the PVC and patches it. On conflict, it re-reads the PVC from the
+// API server, since the cache may not have caught up with the conflicting update yet, and
+// applies mutate again. mutate returns false if the update is no longer needed, in which case
+// patchPVC returns false.
+func (w *pvcAutoresizer) patchPVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	mutate func(*corev1.PersistentVolumeClaim) bool) (bool, error) {
+	ctx, span := tracing.Start(ctx, "patchPVC", tracing.PVCAttributes(pvc.Namespace, pvc.Name)...)
+	updated := false
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if !first {
+			if err := w.apiReader.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+				metrics.KubernetesClientFailTotal.Increment()
+				return err
+			}
+		}
+		first = false
+
+		orig := pvc.DeepCopy()
+		if !mutate(pvc) {
+			updated = false
+			return nil
+		}
+		// The merge patch only contains the fields modified by mutate. The optimistic lock makes
+		// the patch fail with a conflict if the PVC has been modified since it was read.
+		patch := client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{})
+		if err := w.client.Patch(ctx, pvc, patch, w.patchOptions()...); err != nil {
+			metrics.KubernetesClientFailTotal.Increment()
+			return err
+		}
+		updated = true
+		return nil
+	})
+	tracing.End(span, err)
+	return updated, err
+}
+
+// patchOptions returns the options for the patches sent by the resizer.
+func (w *pvcAutoresizer) patchOptions() []client.PatchOption {
+	if w.opts.FieldManager == "" {
+		return nil
+	}
+	return []client.PatchOption{client.FieldOwner(w.opts.FieldManager)}
+}
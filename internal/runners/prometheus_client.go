@@ -9,6 +9,7 @@ import (
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -33,24 +34,44 @@ type prometheusClient struct {
 
 // GetMetrics implements MetricsClient.GetMetrics
 func (c *prometheusClient) GetMetrics(ctx context.Context) (map[types.NamespacedName]*VolumeStats, error) {
+	ctx, span := tracing.Start(ctx, "GetMetrics", tracing.MetricsSourceKey.String("prometheus"))
+	vsMap, err := c.getVolumeStats(ctx, func(query string) string { return query })
+	tracing.End(span, err)
+	return vsMap, err
+}
+
+// GetLastKnownMetrics implements HistoricalMetricsClient.GetLastKnownMetrics
+func (c *prometheusClient) GetLastKnownMetrics(ctx context.Context,
+	lookback time.Duration) (map[types.NamespacedName]*VolumeStats, error) {
+	ctx, span := tracing.Start(ctx, "GetLastKnownMetrics", tracing.MetricsSourceKey.String("prometheus"))
+	rng := model.Duration(lookback).String()
+	vsMap, err := c.getVolumeStats(ctx, func(query string) string {
+		return fmt.Sprintf("last_over_time(%s[%s])", query, rng)
+	})
+	tracing.End(span, err)
+	return vsMap, err
+}
+
+func (c *prometheusClient) getVolumeStats(ctx context.Context,
+	buildQuery func(string) string) (map[types.NamespacedName]*VolumeStats, error) {
 	volumeStatsMap := make(map[types.NamespacedName]*VolumeStats)
 
-	availableBytes, err := c.getMetricValues(ctx, volumeAvailableQuery)
+	availableBytes, err := c.getMetricValues(ctx, buildQuery(volumeAvailableQuery))
 	if err != nil {
 		return nil, err
 	}
 
-	capacityBytes, err := c.getMetricValues(ctx, volumeCapacityQuery)
+	capacityBytes, err := c.getMetricValues(ctx, buildQuery(volumeCapacityQuery))
 	if err != nil {
 		return nil, err
 	}
 
-	availableInodeSize, err := c.getMetricValues(ctx, inodesAvailableQuery)
+	availableInodeSize, err := c.getMetricValues(ctx, buildQuery(inodesAvailableQuery))
 	if err != nil {
 		return nil, err
 	}
 
-	capacityInodeSize, err := c.getMetricValues(ctx, inodesCapacityQuery)
+	capacityInodeSize, err := c.getMetricValues(ctx, buildQuery(inodesCapacityQuery))
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +100,9 @@ func (c *prometheusClient) GetMetrics(ctx context.Context) (map[types.Namespaced
 }
 
 func (c *prometheusClient) getMetricValues(ctx context.Context, query string) (map[types.NamespacedName]int64, error) {
+	ctx, span := tracing.Start(ctx, "prometheus.Query", tracing.MetricsQueryKey.String(query))
 	res, _, err := c.prometheusAPI.Query(ctx, query, time.Now())
+	tracing.End(span, err)
 	if err != nil {
 		metrics.MetricsClientFailTotal.Increment()
 		return nil, err
@@ -11,10 +11,13 @@ import (
 	"github.com/go-logr/logr"
 	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
 	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	"github.com/topolvm/pvc-autoresizer/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,59 +28,159 @@ import (
 //+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create
 //+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=resourcequotas,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=csistoragecapacities,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;patch
 
 const resizeEnableIndexKey = ".metadata.annotations[resize.topolvm.io/enabled]"
 const storageClassNameIndexKey = ".spec.storageClassName"
 const logLevelWarn = 3
+const logLevelDebug = 4
 
-// NewPVCAutoresizer returns a new pvcAutoresizer struct
-func NewPVCAutoresizer(mc MetricsClient, c client.Client, log logr.Logger, interval time.Duration,
-	recorder events.EventRecorder, metricsResetSizeThreshold uint64) manager.Runnable {
+// Options holds the settings of pvcAutoresizer.
+type Options struct {
+	// Interval is the interval to monitor PVC capacity.
+	Interval time.Duration
+
+	// MetricsResetSizeThreshold is the encoded size of the metrics in bytes to reset them.
+	// 0 disables the reset.
+	MetricsResetSizeThreshold uint64
+
+	// QuotaBumpAnnotation is the annotation key set to the namespace to request a bump of the
+	// ResourceQuota when it prevents a resize. Empty disables the request.
+	QuotaBumpAnnotation string
+
+	// CheckBackendCapacity enables checking the free capacity of the storage backend before
+	// resizing.
+	CheckBackendCapacity bool
+
+	// ResizeTimeout is the duration to wait for an expansion to complete before it is regarded
+	// as stuck. 0 disables the timeout.
+	ResizeTimeout time.Duration
+
+	// RecoverExpansionFailure enables retrying an infeasible expansion with a smaller size.
+	RecoverExpansionFailure bool
+
+	// OfflineResize enables resizing volumes not mounted by any pod based on their last-known
+	// volume stats. The metrics client must implement HistoricalMetricsClient.
+	OfflineResize bool
+
+	// OfflineStatsLookback is the period to look back for the last-known volume stats.
+	OfflineStatsLookback time.Duration
+
+	// FieldManager is the name of the field manager of the patches sent by the resizer.
+	FieldManager string
+
+	// DesiredSizeSinks receive the desired sizes of PVCs after they are resized.
+	DesiredSizeSinks []DesiredSizeSink
+
+	// DecisionSinks receive the decision records of the evaluations of PVCs.
+	DecisionSinks []DecisionSink
+
+	// State keeps the states of the targeted PVCs for introspection. nil disables it.
+	State *StateStore
+
+	// Budget holds the limits of the growth of PVCs.
+	Budget BudgetOptions
+
+	// Backoff holds the settings of the backoff for repeated resize failures.
+	Backoff BackoffOptions
+
+	// LimitWarning holds the warning levels of the PVCs approaching their storage limits.
+	LimitWarning LimitWarningOptions
+
+	// Alerts holds the settings of the alerts pushed to Alertmanager.
+	Alerts AlertOptions
+
+	// EventDedupInterval is the interval in which identical events to a PVC are emitted only once.
+	// 0 disables the de-duplication.
+	EventDedupInterval time.Duration
+
+	// Namespaces selects the namespaces whose PVCs are resized, within the namespaces cached by
+	// the client.
+	Namespaces NamespaceFilter
+
+	// Defaults are the values used for the annotations which are not given to PVCs.
+	Defaults ResizeDefaults
+
+	// Reloads receive the settings changed while pvcAutoresizer is running. nil disables reloading.
+	Reloads <-chan Reload
+}
+
+// NewPVCAutoresizer returns a new pvcAutoresizer struct. apiReader reads the objects which are
+// not cached by c, and the objects which must be up to date.
+func NewPVCAutoresizer(mc MetricsClient, c client.Client, apiReader client.Reader, log logr.Logger,
+	recorder events.EventRecorder, opts Options) manager.Runnable {
 
 	return &pvcAutoresizer{
-		metricsClient:             mc,
-		client:                    c,
-		log:                       log,
-		interval:                  interval,
-		recorder:                  recorder,
-		metricsResetSizeThreshold: metricsResetSizeThreshold,
+		metricsClient: mc,
+		client:        c,
+		apiReader:     apiReader,
+		log:           log,
+		recorder:      newDedupRecorder(recorder, opts.EventDedupInterval),
+		opts:          opts,
+		budget:        newGrowthBudget(opts.Budget),
+		failures:      newFailureTracker(opts.Backoff),
+		limitWarnings: newLimitWarningTracker(opts.LimitWarning.Notifiers),
+		alerts:        newAlertPusher(opts.Alerts, opts.Interval),
 	}
 }
 
 type pvcAutoresizer struct {
-	client                    client.Client
-	metricsClient             MetricsClient
-	interval                  time.Duration
-	log                       logr.Logger
-	recorder                  events.EventRecorder
-	metricsResetSizeThreshold uint64
+	client        client.Client
+	apiReader     client.Reader
+	metricsClient MetricsClient
+	log           logr.Logger
+	recorder      events.EventRecorder
+	opts          Options
+	budget        *growthBudget
+	failures      *failureTracker
+	limitWarnings *limitWarningTracker
+	alerts        *alertPusher
 }
 
 // Start implements manager.Runnable
 func (w *pvcAutoresizer) Start(ctx context.Context) error {
-	ticker := time.NewTicker(w.interval)
+	go w.limitWarnings.run(ctx, w.log.WithName("limit-warning"))
+
+	ticker := time.NewTicker(w.opts.Interval)
 
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case r := <-w.opts.Reloads:
+			w.reload(r)
+			ticker.Reset(w.opts.Interval)
 		case <-ticker.C:
 			startTime := time.Now()
 			w.reconcile(ctx)
 			metrics.ResizerLoopSecondsTotal.Add(time.Since(startTime).Seconds())
+			metrics.ResizerLoopDurationSeconds.Observe(time.Since(startTime).Seconds())
+			// The firing alerts are pushed even if the reconciliation has failed, so that they are
+			// not resolved by Alertmanager while the controller cannot evaluate the PVCs.
+			if err := w.alerts.push(ctx); err != nil {
+				w.log.Error(err, "failed to push alerts to alertmanager")
+			}
+			w.budget.exportMetrics(time.Now())
 
-			reset, err := metrics.ResetMetricsIfExceedsThreshold(w.metricsResetSizeThreshold)
+			reset, err := metrics.ResetMetricsIfExceedsThreshold(w.opts.MetricsResetSizeThreshold)
 			if err != nil {
 				w.log.Error(err, "failed to check metrics size for reset")
 			} else if reset {
-				w.log.Info("metrics reset because they exceeded threshold", "thresholdBytes", w.metricsResetSizeThreshold)
+				w.log.Info("metrics reset because they exceeded threshold", "thresholdBytes", w.opts.MetricsResetSizeThreshold)
 			}
 		}
 	}
 }
 
-func isTargetPVC(pvc *corev1.PersistentVolumeClaim) (bool, error) {
+// IsTargetPVC returns true if the PVC has a storage limit, is a filesystem volume and is bound.
+// It does not check the annotation of the StorageClass.
+func IsTargetPVC(pvc *corev1.PersistentVolumeClaim) (bool, error) {
 	quantity, err := PvcStorageLimit(pvc)
 	if err != nil {
 		return false, fmt.Errorf("invalid storage limit: %w", err)
@@ -104,48 +207,158 @@ func (w *pvcAutoresizer) getStorageClassList(ctx context.Context) (*storagev1.St
 	return &scs, nil
 }
 
+// IsAutoresizeEnabled returns true if the autoresize of the PVC is enabled. AutoResizeEnabledKey
+// of the PVC overrides scEnabled, which tells whether its StorageClass enables the autoresize.
+func IsAutoresizeEnabled(pvc *corev1.PersistentVolumeClaim, scEnabled bool) bool {
+	switch pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return scEnabled
+}
+
+// storageClassPVCs are the PVCs of a StorageClass.
+type storageClassPVCs struct {
+	name string
+	pvcs []corev1.PersistentVolumeClaim
+}
+
+// listEnabledPVCs returns the PVCs whose autoresize is enabled, grouped by their StorageClasses.
+// They are the PVCs of the enabled StorageClasses except the ones opted out, and the PVCs opted in
+// by themselves.
+func (w *pvcAutoresizer) listEnabledPVCs(ctx context.Context, scs *storagev1.StorageClassList) (
+	[]storageClassPVCs, error) {
+	result := make([]storageClassPVCs, 0, len(scs.Items))
+	indices := make(map[string]int, len(scs.Items))
+	for _, sc := range scs.Items {
+		var pvcs corev1.PersistentVolumeClaimList
+		err := w.client.List(ctx, &pvcs, client.MatchingFields(map[string]string{storageClassNameIndexKey: sc.Name}))
+		if err != nil {
+			return nil, err
+		}
+		enabled := storageClassPVCs{name: sc.Name}
+		for _, pvc := range pvcs.Items {
+			if IsAutoresizeEnabled(&pvc, true) {
+				enabled.pvcs = append(enabled.pvcs, pvc)
+			}
+		}
+		indices[sc.Name] = len(result)
+		result = append(result, enabled)
+	}
+
+	var optedIn corev1.PersistentVolumeClaimList
+	err := w.client.List(ctx, &optedIn, client.MatchingFields(map[string]string{resizeEnableIndexKey: "true"}))
+	if err != nil {
+		return nil, err
+	}
+	enabledSCs := len(result)
+	for _, pvc := range optedIn.Items {
+		// The PVCs without StorageClasses cannot be expanded.
+		if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+			continue
+		}
+		scName := *pvc.Spec.StorageClassName
+		i, ok := indices[scName]
+		if ok && i < enabledSCs {
+			// Already listed with the enabled StorageClass.
+			continue
+		}
+		if !ok {
+			i = len(result)
+			indices[scName] = i
+			result = append(result, storageClassPVCs{name: scName})
+		}
+		result[i].pvcs = append(result[i].pvcs, pvc)
+	}
+	return result, nil
+}
+
 func (w *pvcAutoresizer) reconcile(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "reconcile")
 	scs, err := w.getStorageClassList(ctx)
+	defer func() { tracing.End(span, err) }()
 	if err != nil {
 		w.log.Error(err, "getStorageClassList failed")
 		return
 	}
 
+	nss, err := selectNamespaces(ctx, w.client, w.opts.Namespaces)
+	if err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		w.log.Error(err, "list namespace failed")
+		return
+	}
+
 	vsMap, err := w.metricsClient.GetMetrics(ctx)
 	if err != nil {
 		w.log.Error(err, "metricsClient.GetMetrics failed")
 		return
 	}
 
-	for _, sc := range scs.Items {
-		var pvcs corev1.PersistentVolumeClaimList
-		err = w.client.List(ctx, &pvcs, client.MatchingFields(map[string]string{storageClassNameIndexKey: sc.Name}))
-		if err != nil {
-			metrics.KubernetesClientFailTotal.Increment()
-			w.log.Error(err, "list pvc failed")
-			return
-		}
-		for _, pvc := range pvcs.Items {
+	// lastKnownMap holds the last-known volume stats for offline volumes. It is retrieved only
+	// when an offline volume is found.
+	var lastKnownMap map[types.NamespacedName]*VolumeStats
+
+	seen := make(map[types.NamespacedName]struct{})
+	targeted := make(map[types.NamespacedName]struct{})
+	targets := make(map[string]int, len(scs.Items))
+	usage := make(map[metrics.PVCKey]float64)
+
+	enabledPVCs, err := w.listEnabledPVCs(ctx, scs)
+	if err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		w.log.Error(err, "list pvc failed")
+		return
+	}
+	for _, sc := range enabledPVCs {
+		targets[sc.name] = 0
+		for _, pvc := range sc.pvcs {
+			if !nss.contains(pvc.Namespace) {
+				continue
+			}
 			log := w.log.WithValues("namespace", pvc.Namespace, "name", pvc.Name)
-			isTarget, err := isTargetPVC(&pvc)
-			if err != nil {
+			isTarget, targetErr := IsTargetPVC(&pvc)
+			if targetErr != nil {
+				// The StorageClass is tracked first so that the failure is exported with it.
+				metrics.TrackPVC(pvc.Name, pvc.Namespace, sc.name)
 				metrics.ResizerFailedResizeTotal.Increment(pvc.Name, pvc.Namespace)
-				log.Error(err, "failed to check target PVC")
+				log.Error(targetErr, "failed to check target PVC")
 				continue
 			} else if !isTarget {
 				continue
 			}
 
+			targets[sc.name]++
+			metrics.TrackPVC(pvc.Name, pvc.Namespace, sc.name)
+
 			// To output the metric even if some events do not occur, we call SpecifyLabels() here.
 			metrics.ResizerSuccessResizeTotal.SpecifyLabels(pvc.Name, pvc.Namespace)
 			metrics.ResizerFailedResizeTotal.SpecifyLabels(pvc.Name, pvc.Namespace)
 			metrics.ResizerLimitReachedTotal.SpecifyLabels(pvc.Name, pvc.Namespace)
 
+			metrics.ResizerFileSystemResizePending.Set(pvc.Name, pvc.Namespace, isFileSystemResizePending(&pvc))
+
 			namespacedName := types.NamespacedName{
 				Namespace: pvc.Namespace,
 				Name:      pvc.Name,
 			}
-			if _, ok := vsMap[namespacedName]; !ok {
+			vs, ok := vsMap[namespacedName]
+			// kubelet exports the volume stats only while the volume is mounted.
+			online := ok
+			if !ok && w.opts.OfflineResize {
+				if lastKnownMap == nil {
+					lastKnownMap = w.getLastKnownMetrics(ctx)
+				}
+				vs, ok = lastKnownMap[namespacedName]
+				if ok {
+					log.Info("use last-known volume stats of the offline volume")
+				}
+			}
+			targeted[namespacedName] = struct{}{}
+			w.opts.State.observe(&pvc, vs)
+			if !ok {
 				// Do not increment ResizerFailedResizeTotal here. The controller cannot get volume
 				// stats for "offline" volumes (i.e. volumes not mounted by any pod) since kubelet
 				// exports volume stats of a persistent volume claim only if it is online. Besides,
@@ -155,112 +368,209 @@ func (w *pvcAutoresizer) reconcile(ctx context.Context) {
 				// the controller failed to retrieve volume stats for the PVC. This may result in a
 				// failure to increment the counter in the case which the PVC is online but fails
 				// to retrieve its metrics, but accept this as a limitation for now.
-				log.Info("failed to get volume stats")
+				// When OfflineResize is enabled, the last-known volume stats are used instead if
+				// they are found in the history of the metrics source.
+				w.recordDecision(ctx, &pvc, newDecision(&pvc).skip(ReasonNoVolumeStats, "failed to get volume stats"))
 				continue
 			}
 
-			err = w.resize(ctx, &pvc, vsMap[namespacedName])
-			if err != nil {
+			seen[namespacedName] = struct{}{}
+			if vs.CapacityBytes > 0 {
+				usage[metrics.PVCKey{Namespace: pvc.Namespace, Name: pvc.Name}] =
+					float64(vs.CapacityBytes-vs.AvailableBytes) / float64(vs.CapacityBytes)
+			}
+			skip, terminal := w.failures.shouldSkip(&pvc, time.Now())
+			metrics.ResizerResizeGaveUp.Set(pvc.Name, pvc.Namespace, terminal)
+			if skip {
+				msg := "backoff for the previous failures"
+				if terminal {
+					msg = "gave up after the consecutive failures"
+				}
+				w.recordDecision(ctx, &pvc, newDecision(&pvc).skip(ReasonBackoff, msg))
+				continue
+			}
+
+			fingerprint := pvcFingerprint(&pvc)
+			resizeCtx, resizeSpan := tracing.Start(ctx, "resize",
+				append(tracing.PVCAttributes(pvc.Namespace, pvc.Name), tracing.StorageClassKey.String(sc.name))...)
+			// A failure of a PVC is recorded in its own span, not in the span of the reconciliation.
+			resizeErr := w.resize(resizeCtx, &pvc, vs, online)
+			tracing.End(resizeSpan, resizeErr)
+			if resizeErr != nil {
 				metrics.ResizerFailedResizeTotal.Increment(pvc.Name, pvc.Namespace)
-				log.Error(err, "failed to resize PVC")
+				w.handleResizeFailure(&pvc, fingerprint, resizeErr)
+				continue
 			}
+			w.failures.success(&pvc)
+			w.opts.State.recordSuccess(&pvc)
+			w.alerts.setFailures(&pvc, 0, false, nil)
+			metrics.ResizerConsecutiveFailures.Set(pvc.Name, pvc.Namespace, 0)
 		}
 	}
+	w.failures.prune(seen)
+	w.opts.State.prune(targeted)
+	w.limitWarnings.prune(targeted)
+	w.alerts.prune(targeted)
+	w.budget.prune(targeted)
+	metrics.ResizerTargetPVCs.Set(targets)
+	total := 0
+	for _, n := range targets {
+		total += n
+	}
+	span.SetAttributes(tracing.TargetPVCsKey.Int(total))
+	metrics.UpdateTopPVCs(usage)
 }
 
-func (w *pvcAutoresizer) resize(ctx context.Context, pvc *corev1.PersistentVolumeClaim, vs *VolumeStats) error {
-	log := w.log.WithName("resize").WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+func (w *pvcAutoresizer) resize(ctx context.Context, pvc *corev1.PersistentVolumeClaim, vs *VolumeStats,
+	online bool) error {
+	d := EvaluateResizeWithDefaults(pvc, vs, w.opts.Defaults)
+	defer w.recordDecision(ctx, pvc, d)
 
-	threshold, err := convertSizeInBytes(pvc.Annotations[pvcautoresizer.ResizeThresholdAnnotation], vs.CapacityBytes, pvcautoresizer.DefaultThreshold)
-	if err != nil {
-		log.V(logLevelWarn).Info("failed to convert threshold annotation", "error", err.Error())
+	switch d.Reason {
+	case ReasonInvalidThreshold, ReasonInvalidInodesThreshold, ReasonCapacityUnknown, ReasonInvalidIncrease:
 		// lint:ignore nilerr ignores this because invalid annotations should be allowed.
 		return nil
 	}
 
-	annotation := pvc.Annotations[pvcautoresizer.ResizeInodesThresholdAnnotation]
-	inodesThreshold, err := convertSize(annotation, vs.CapacityInodeSize, pvcautoresizer.DefaultInodesThreshold)
+	// The volume metrics are exported even while waiting for the previous expansion, so that the
+	// usage of the volume is visible until the expansion completes.
+	if d.Action != DecisionActionError {
+		exportVolumeMetrics(pvc, vs, d.ThresholdBytes, d.Capacity, d.Limit)
+	}
+
+	reduced, err := w.detectExternalReduction(ctx, pvc)
 	if err != nil {
-		log.V(logLevelWarn).Info("failed to convert threshold annotation", "error", err.Error())
-		// lint:ignore nilerr ignores this because invalid annotations should be allowed.
+		return d.fail(ReasonUpdateFailed, err)
+	}
+	if reduced {
+		d.skip(ReasonExternalReduction, "storage request was reduced externally")
 		return nil
 	}
 
-	cap, exists := pvc.Status.Capacity[corev1.ResourceStorage]
-	if !exists {
-		log.Info("skip resizing because pvc capacity is not set yet")
+	waiting, err := w.checkResizeInProgress(ctx, pvc, vs, online)
+	if err != nil {
+		return d.fail(ReasonUpdateFailed, err)
+	}
+	if waiting {
+		d.skip(ReasonResizeInProgress, "")
+		return nil
+	}
+	if d.Action == DecisionActionError {
+		return d.Err()
+	}
+	if d.Reason == ReasonLimitReached {
+		metrics.ResizerLimitReachedTotal.Increment(pvc.Name, pvc.Namespace)
 		return nil
 	}
-	if cap.Value() == 0 {
-		log.Info("skip resizing because pvc capacity size is zero")
+	if d.Action != DecisionActionResize {
 		return nil
 	}
 
-	increase, err := convertSizeInBytes(pvc.Annotations[pvcautoresizer.ResizeIncreaseAnnotation], cap.Value(), pvcautoresizer.DefaultIncrease)
+	unsupported, err := w.checkVolumeExpansion(ctx, pvc)
 	if err != nil {
-		log.V(logLevelWarn).Info("failed to convert increase annotation", "error", err.Error())
+		return d.fail(ReasonUpdateFailed, err)
+	}
+	if unsupported != "" {
+		metrics.ResizerExpansionUnsupportedTotal.Increment(pvc.Name, pvc.Namespace)
+		w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonExpansionUnsupported, "Resize",
+			"PVC volume cannot be resized to %s: %s", d.NewSize.String(), unsupported)
+		d.skip(ReasonExpansionUnsupported, unsupported)
 		return nil
 	}
 
-	preCap, exist := pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation]
-	if exist {
-		preCapInt64, err := strconv.ParseInt(preCap, 10, 64)
-		if err != nil {
-			log.V(logLevelWarn).Info("failed to parse pre_cap_bytes annotation", "error", err.Error())
-			// lint:ignore nilerr ignores this because invalid annotations should be allowed.
-			return nil
-		}
-		if preCapInt64 == vs.CapacityBytes {
-			log.Info("waiting for resizing...", "capacity", vs.CapacityBytes)
-			return nil
-		}
+	return w.applyDecision(ctx, pvc, vs, d)
+}
+
+// applyDecision resizes the PVC as decided by EvaluateResize after checking the state of the
+// cluster, and updates the decision with the result.
+func (w *pvcAutoresizer) applyDecision(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	vs *VolumeStats, d *Decision) error {
+	// The growth budgets are checked first so that a paused resize does not request a quota bump.
+	newReq := w.capByGrowthBudget(pvc, *d.NewSize)
+	if newReq == nil {
+		d.skip(ReasonBudgetExceeded, "growth budget is exceeded")
+		return nil
 	}
-	limitRes, err := PvcStorageLimit(pvc)
+
+	newReq, err := w.capByResourceQuota(ctx, pvc, d.Capacity, *newReq)
 	if err != nil {
-		log.Error(err, "fetching storage limit failed")
-		return err
+		return d.fail(ReasonUpdateFailed, err)
 	}
-	if cap.Cmp(limitRes) >= 0 {
-		log.Info("volume storage limit reached")
-		metrics.ResizerLimitReachedTotal.Increment(pvc.Name, pvc.Namespace)
+	if newReq == nil {
+		d.skip(ReasonQuotaExceeded, "resource quota is exceeded")
 		return nil
 	}
 
-	if threshold > vs.AvailableBytes || inodesThreshold > vs.AvailableInodeSize {
-		if pvc.Annotations == nil {
-			pvc.Annotations = make(map[string]string)
-		}
-		newReqBytes := int64(math.Ceil(float64(cap.Value()+increase)/(1<<30))) << 30
-		newReq := resource.NewQuantity(newReqBytes, resource.BinarySI)
-		if newReq.Cmp(limitRes) > 0 {
-			newReq = &limitRes
-		}
+	newReq, err = w.capByBackendCapacity(ctx, pvc, *newReq)
+	if err != nil {
+		return d.fail(ReasonUpdateFailed, err)
+	}
+	if newReq == nil {
+		d.skip(ReasonInsufficientBackendCapacity, "backend capacity is insufficient")
+		return nil
+	}
+	d.NewSize = newReq
 
-		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = *newReq
-		pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation] = strconv.FormatInt(vs.CapacityBytes, 10)
-		err = w.client.Update(ctx, pvc)
-		if err != nil {
-			metrics.KubernetesClientFailTotal.Increment()
-			return err
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	growth := newReq.DeepCopy()
+	growth.Sub(curReq)
+
+	updated, err := w.patchPVC(ctx, pvc, func(pvc *corev1.PersistentVolumeClaim) bool {
+		return setNewRequest(pvc, *newReq, vs.CapacityBytes)
+	})
+	if err != nil {
+		if isQuotaExceededError(err) {
+			metrics.ResizerQuotaExceededTotal.Increment(pvc.Name, pvc.Namespace)
+			w.recorder.Eventf(pvc, nil, corev1.EventTypeWarning, eventReasonQuotaExceeded, "Resize",
+				"PVC volume cannot be resized to %s: %s", newReq.String(), err.Error())
+			return d.fail(ReasonQuotaExceeded, err)
 		}
-		log.Info("resize started",
-			"from", cap.Value(),
-			"to", newReq.Value(),
-			"threshold", threshold,
-			"available", vs.AvailableBytes,
-			"inodesThreshold", inodesThreshold,
-			"inodesAvailable", vs.AvailableInodeSize,
-		)
-		w.recorder.Eventf(pvc, nil, corev1.EventTypeNormal, "Resized", "Resized", "PVC volume is resized to %s", newReq.String())
-		metrics.ResizerSuccessResizeTotal.Increment(pvc.Name, pvc.Namespace)
+		return d.fail(ReasonUpdateFailed, err)
 	}
-
+	if !updated {
+		d.skip(ReasonAlreadyUpdated, "the request has already been updated")
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(tracing.ResizeFromKey.Int64(d.Capacity.Value()),
+		tracing.ResizeToKey.Int64(newReq.Value()))
+	w.recorder.Eventf(pvc, nil, corev1.EventTypeNormal, EventReasonResized, "Resized", "PVC volume is resized to %s", newReq.String())
+	metrics.ResizerSuccessResizeTotal.Increment(pvc.Name, pvc.Namespace)
+	w.budget.record(pvc, growth.Value(), time.Now())
+	w.recordDesiredSize(ctx, pvc, *newReq, curReq)
 	return nil
 }
 
+// exportVolumeMetrics exports the usage of the volume and the resize settings of the PVC.
+func exportVolumeMetrics(pvc *corev1.PersistentVolumeClaim, vs *VolumeStats, threshold int64,
+	capacity, limit resource.Quantity) {
+	if vs.CapacityBytes > 0 {
+		usage := float64(vs.CapacityBytes-vs.AvailableBytes) / float64(vs.CapacityBytes)
+		metrics.ResizerVolumeUsageRatio.Set(pvc.Name, pvc.Namespace, usage)
+	}
+	metrics.ResizerResizeThresholdBytes.Set(pvc.Name, pvc.Namespace, float64(threshold))
+	metrics.ResizerStorageLimitBytes.Set(pvc.Name, pvc.Namespace, float64(limit.Value()))
+	metrics.ResizerLimitHeadroomBytes.Set(pvc.Name, pvc.Namespace, math.Max(float64(limit.Value()-capacity.Value()), 0))
+}
+
+// setNewRequest sets newReq to the storage request of the PVC along with the annotations to
+// track the expansion. It returns false if the request is already larger than or equal to newReq.
+func setNewRequest(pvc *corev1.PersistentVolumeClaim, newReq resource.Quantity, preCapBytes int64) bool {
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if curReq.Cmp(newReq) >= 0 {
+		return false
+	}
+	if pvc.Annotations == nil {
+		pvc.Annotations = make(map[string]string)
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = newReq
+	pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation] = strconv.FormatInt(preCapBytes, 10)
+	pvc.Annotations[pvcautoresizer.ResizeStartedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation] = newReq.String()
+	return true
+}
+
 func indexByResizeEnableAnnotation(obj client.Object) []string {
-	sc := obj.(*storagev1.StorageClass)
-	if val, ok := sc.Annotations[pvcautoresizer.AutoResizeEnabledKey]; ok {
+	if val, ok := obj.GetAnnotations()[pvcautoresizer.AutoResizeEnabledKey]; ok {
 		return []string{val}
 	}
 
@@ -276,6 +586,27 @@ func indexByStorageClassName(obj client.Object) []string {
 	return []string{*scName}
 }
 
+// SetupMetricsCleanup deletes the metrics of PVCs when they are deleted.
+func SetupMetricsCleanup(mgr ctrl.Manager) error {
+	informer, err := mgr.GetCache().GetInformer(context.Background(), &corev1.PersistentVolumeClaim{})
+	if err != nil {
+		return err
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+			if !ok {
+				return
+			}
+			metrics.DeletePVC(pvc.Name, pvc.Namespace)
+		},
+	})
+	return err
+}
+
 // SetupIndexer setup indices for PVC auto resizer
 func SetupIndexer(mgr ctrl.Manager, skipAnnotationCheck bool) error {
 	idxFunc := indexByResizeEnableAnnotation
@@ -293,6 +624,13 @@ func SetupIndexer(mgr ctrl.Manager, skipAnnotationCheck bool) error {
 		return err
 	}
 
+	// The annotation of PVCs is always checked since it overrides their StorageClasses.
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.PersistentVolumeClaim{}, resizeEnableIndexKey,
+		indexByResizeEnableAnnotation)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
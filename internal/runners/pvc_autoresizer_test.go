@@ -10,9 +10,11 @@ import (
 	. "github.com/onsi/gomega"
 	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("test resizer", func() {
@@ -162,6 +164,56 @@ var _ = Describe("test resizer", func() {
 		})
 	})
 
+	Context("test listEnabledPVCs", func() {
+		newSC := func(name, enabled string) storagev1.StorageClass {
+			sc := storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			if enabled != "" {
+				sc.Annotations = map[string]string{pvcautoresizer.AutoResizeEnabledKey: enabled}
+			}
+			return sc
+		}
+		newPVC := func(name, scName, enabled string) *corev1.PersistentVolumeClaim {
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+				Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &scName},
+			}
+			if enabled != "" {
+				pvc.Annotations = map[string]string{pvcautoresizer.AutoResizeEnabledKey: enabled}
+			}
+			return pvc
+		}
+
+		It("should let the annotation of PVCs override their StorageClasses", func() {
+			c := fake.NewClientBuilder().
+				WithObjects(
+					newPVC("default", "enabled-sc", ""),
+					newPVC("opted-out", "enabled-sc", "false"),
+					newPVC("opted-in", "disabled-sc", "true"),
+					newPVC("enabled-twice", "enabled-sc", "true"),
+					newPVC("not-enabled", "disabled-sc", ""),
+					newPVC("no-storageclass", "", "true"),
+				).
+				WithIndex(&corev1.PersistentVolumeClaim{}, storageClassNameIndexKey, indexByStorageClassName).
+				WithIndex(&corev1.PersistentVolumeClaim{}, resizeEnableIndexKey, indexByResizeEnableAnnotation).
+				Build()
+			w := &pvcAutoresizer{client: c}
+			scs := &storagev1.StorageClassList{Items: []storagev1.StorageClass{newSC("enabled-sc", "true")}}
+
+			result, err := w.listEnabledPVCs(context.Background(), scs)
+			Expect(err).NotTo(HaveOccurred())
+			names := make(map[string][]string)
+			for _, sc := range result {
+				names[sc.name] = []string{}
+				for _, pvc := range sc.pvcs {
+					names[sc.name] = append(names[sc.name], pvc.Name)
+				}
+			}
+			Expect(names).To(HaveLen(2))
+			Expect(names["enabled-sc"]).To(ConsistOf("default", "enabled-twice"))
+			Expect(names["disabled-sc"]).To(ConsistOf("opted-in"))
+		})
+	})
+
 	Context("resize", func() {
 		Context("parameter tests", func() {
 			ctx := context.Background()
@@ -337,7 +389,471 @@ var _ = Describe("test resizer", func() {
 			}
 		})
 
+		Context("resource quota tests", func() {
+			It("should cap the resize by the resource quota", func() {
+				ctx := context.Background()
+				pvcNS := "quota-test"
+				pvcName := "test-resize-quota"
+
+				ns := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: pvcNS}}
+				Expect(k8sClient.Create(ctx, &ns)).To(Succeed())
+
+				quota := corev1.ResourceQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "storage-quota", Namespace: pvcNS},
+					Spec: corev1.ResourceQuotaSpec{
+						Hard: corev1.ResourceList{
+							corev1.ResourceRequestsStorage: resource.MustParse("15Gi"),
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, &quota)).To(Succeed())
+				quota.Status = corev1.ResourceQuotaStatus{
+					Hard: corev1.ResourceList{
+						corev1.ResourceRequestsStorage: resource.MustParse("15Gi"),
+					},
+					Used: corev1.ResourceList{
+						corev1.ResourceRequestsStorage: resource.MustParse("10Gi"),
+					},
+				}
+				Expect(k8sClient.Status().Update(ctx, &quota)).To(Succeed())
+
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is capped by the remaining quota")
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 15<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 15<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+
+				By("checking the quota bump is requested")
+				Eventually(func() error {
+					var ns corev1.Namespace
+					err := k8sClient.Get(ctx, types.NamespacedName{Name: pvcNS}, &ns)
+					if err != nil {
+						return err
+					}
+					if val := ns.Annotations[quotaBumpAnnotation]; val != "20Gi" {
+						return fmt.Errorf("quota bump annotation should be 20Gi, but %q", val)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("backend capacity tests", func() {
+			It("should cap the resize by CSIStorageCapacity", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-backend-capacity"
+				pvName := "test-pv-backend-capacity"
+				topologyKey := "topology.example.com/node"
+
+				pv := corev1.PersistentVolume{
+					ObjectMeta: metav1.ObjectMeta{Name: pvName},
+					Spec: corev1.PersistentVolumeSpec{
+						Capacity: corev1.ResourceList{
+							corev1.ResourceStorage: *resource.NewQuantity(10<<30, resource.BinarySI),
+						},
+						AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						PersistentVolumeSource: corev1.PersistentVolumeSource{
+							CSI: &corev1.CSIPersistentVolumeSource{Driver: provName, VolumeHandle: pvName},
+						},
+						NodeAffinity: &corev1.VolumeNodeAffinity{
+							Required: &corev1.NodeSelector{
+								NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+									MatchExpressions: []corev1.NodeSelectorRequirement{{
+										Key:      topologyKey,
+										Operator: corev1.NodeSelectorOpIn,
+										Values:   []string{"node1"},
+									}},
+								}},
+							},
+						},
+						StorageClassName: scName,
+					},
+				}
+				Expect(k8sClient.Create(ctx, &pv)).To(Succeed())
+
+				available := resource.MustParse("3Gi")
+				csc := storagev1.CSIStorageCapacity{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-capacity-node1", Namespace: pvcNS},
+					NodeTopology: &metav1.LabelSelector{
+						MatchLabels: map[string]string{topologyKey: "node1"},
+					},
+					StorageClassName: scName,
+					Capacity:         &available,
+				}
+				Expect(k8sClient.Create(ctx, &csc)).To(Succeed())
+
+				createPVCWithVolume(ctx, pvcNS, pvcName, scName, pvName, "50%", "10Gi", 10<<30, 100<<30, 10<<30)
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is capped by the backend capacity")
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 13<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 13<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("volume expansion tests", func() {
+			It("should not resize the PVC whose StorageClass does not allow volume expansion", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-expansion-not-allowed"
+				noExpansionSC := "test-storageclass-no-expansion"
+
+				allowed := false
+				sc := storagev1.StorageClass{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        noExpansionSC,
+						Annotations: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "true"},
+					},
+					Provisioner:          provName,
+					AllowVolumeExpansion: &allowed,
+				}
+				Expect(k8sClient.Create(ctx, &sc)).To(Succeed())
+
+				createPVC(ctx, pvcNS, pvcName, noExpansionSC, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is not changed")
+				Consistently(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 10<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 10<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("namespace tests", func() {
+			It("should not resize the PVC in the namespace opted out", func() {
+				ctx := context.Background()
+				pvcNS := "test-namespace-opted-out"
+				pvcName := "test-resize-opted-out"
+
+				ns := corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        pvcNS,
+						Annotations: map[string]string{pvcautoresizer.AutoResizeEnabledKey: "false"},
+					},
+				}
+				Expect(k8sClient.Create(ctx, &ns)).To(Succeed())
+
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is not changed")
+				Consistently(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 10<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 10<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("PVC annotation tests", func() {
+			It("should resize the PVC enabled by itself", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-opted-in"
+				disabledSC := "test-storageclass-disabled"
+
+				createStorageClass(ctx, disabledSC, provName)
+				var sc storagev1.StorageClass
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: disabledSC}, &sc)).To(Succeed())
+				delete(sc.Annotations, pvcautoresizer.AutoResizeEnabledKey)
+				Expect(k8sClient.Update(ctx, &sc)).To(Succeed())
+
+				createPVC(ctx, pvcNS, pvcName, disabledSC, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				var pvc corev1.PersistentVolumeClaim
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)).To(Succeed())
+				pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] = "true"
+				Expect(k8sClient.Update(ctx, &pvc)).To(Succeed())
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is increased")
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 20<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 20<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+
+			It("should not resize the PVC disabled by itself", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-opted-out-pvc"
+
+				// Set the storage limit along with the annotation not to be resized before it.
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 10<<30, 0, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				var pvc corev1.PersistentVolumeClaim
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)).To(Succeed())
+				pvc.Annotations[pvcautoresizer.StorageLimitAnnotation] = strconv.FormatInt(100<<30, 10)
+				pvc.Annotations[pvcautoresizer.AutoResizeEnabledKey] = "false"
+				Expect(k8sClient.Update(ctx, &pvc)).To(Succeed())
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is not changed")
+				Consistently(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 10<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 10<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("expansion failure tests", func() {
+			It("should retry an infeasible expansion with a smaller size", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-infeasible"
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 20<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+
+				var pvc corev1.PersistentVolumeClaim
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+				Expect(err).NotTo(HaveOccurred())
+				pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation] = strconv.FormatInt(10<<30, 10)
+				pvc.Annotations[pvcautoresizer.ResizeStartedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+				err = k8sClient.Update(ctx, &pvc)
+				Expect(err).NotTo(HaveOccurred())
+				pvc.Status.AllocatedResources = corev1.ResourceList{
+					corev1.ResourceStorage: *resource.NewQuantity(20<<30, resource.BinarySI),
+				}
+				pvc.Status.AllocatedResourceStatuses = map[corev1.ResourceName]corev1.ClaimResourceStatus{
+					corev1.ResourceStorage: corev1.PersistentVolumeClaimControllerResizeInfeasible,
+				}
+				err = k8sClient.Status().Update(ctx, &pvc)
+				Expect(err).NotTo(HaveOccurred())
+
+				setMetrics(pvcNS, pvcName, 1<<30, 10<<30, 100, 100)
+
+				By("checking the request is lowered")
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 15<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 15<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+
+				By("checking the stuck metrics")
+				mfs, err := getMetricsFamily()
+				Expect(err).NotTo(HaveOccurred())
+				mf, ok := mfs["pvcautoresizer_resize_stuck"]
+				Expect(ok).To(BeTrue())
+				var val float64
+				for _, m := range mf.Metric {
+					for _, label := range m.Label {
+						if label.GetName() == "persistentvolumeclaim" && label.GetValue() == pvcName {
+							val = m.Gauge.GetValue()
+						}
+					}
+				}
+				Expect(val).To(Equal(float64(1)))
+			})
+		})
+
+		Context("field manager tests", func() {
+			It("should patch the PVC with the field manager", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-field-manager"
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				promClient.setResponce(types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &VolumeStats{
+					AvailableBytes:     1 << 30,
+					CapacityBytes:      10 << 30,
+					AvailableInodeSize: 100,
+					CapacityInodeSize:  100,
+				})
+
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 20<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 20<<30, req)
+					}
+					if val := pvc.Annotations[pvcautoresizer.DesiredSizeAnnotation]; val != "20Gi" {
+						return fmt.Errorf("desired size annotation should be 20Gi, but %s", val)
+					}
+					for _, f := range pvc.ManagedFields {
+						if f.Manager == fieldManager {
+							return nil
+						}
+					}
+					return fmt.Errorf("managed fields of %s are not found", fieldManager)
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("offline resize tests", func() {
+			It("should resize an offline volume based on the last-known stats", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-offline"
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 10<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+				promClient.setLastKnown(types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &VolumeStats{
+					AvailableBytes:     1 << 30,
+					CapacityBytes:      10 << 30,
+					AvailableInodeSize: 100,
+					CapacityInodeSize:  100,
+				})
+
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 20<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 20<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+
+				By("completing the expansion while the volume is not mounted")
+				var pvc corev1.PersistentVolumeClaim
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+				Expect(err).NotTo(HaveOccurred())
+				pvc.Status.Capacity = corev1.ResourceList{
+					corev1.ResourceStorage: *resource.NewQuantity(20<<30, resource.BinarySI),
+				}
+				Expect(k8sClient.Status().Update(ctx, &pvc)).To(Succeed())
+
+				By("checking the request is not changed until the stats of the expanded volume are found")
+				Consistently(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 20<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 20<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+
+				By("updating the last-known stats after the volume is mounted again")
+				promClient.setLastKnown(types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &VolumeStats{
+					AvailableBytes:     1 << 30,
+					CapacityBytes:      20 << 30,
+					AvailableInodeSize: 100,
+					CapacityInodeSize:  100,
+				})
+
+				Eventually(func() error {
+					var pvc corev1.PersistentVolumeClaim
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+					if err != nil {
+						return err
+					}
+					req := pvc.Spec.Resources.Requests.Storage().Value()
+					if req != 30<<30 {
+						return fmt.Errorf("request size should be %d, but %d", 30<<30, req)
+					}
+					return nil
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+		})
+
 		Context("metrics tests", func() {
+			It("should output the volume usage while waiting for the expansion", func() {
+				ctx := context.Background()
+				pvcNS := "default"
+				pvcName := "test-resize-metrics-waiting"
+				createPVC(ctx, pvcNS, pvcName, scName, "50%", "", "10Gi", 20<<30, 100<<30, 10<<30,
+					corev1.PersistentVolumeFilesystem)
+
+				var pvc corev1.PersistentVolumeClaim
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: pvcNS, Name: pvcName}, &pvc)
+				Expect(err).NotTo(HaveOccurred())
+				pvc.Annotations[pvcautoresizer.PreviousCapacityBytesAnnotation] = strconv.FormatInt(10<<30, 10)
+				Expect(k8sClient.Update(ctx, &pvc)).To(Succeed())
+				setMetrics(pvcNS, pvcName, 3<<30, 10<<30, 100, 100)
+
+				Eventually(func() error {
+					mfs, err := getMetricsFamily()
+					if err != nil {
+						return err
+					}
+					for _, m := range mfs["pvcautoresizer_volume_usage_ratio"].GetMetric() {
+						for _, label := range m.Label {
+							if label.GetName() == "persistentvolumeclaim" && label.GetValue() == pvcName {
+								if m.Gauge.GetValue() != 0.7 {
+									return fmt.Errorf("usage ratio should be 0.7, but %f", m.Gauge.GetValue())
+								}
+								return nil
+							}
+						}
+					}
+					return fmt.Errorf("usage ratio of %s is not found", pvcName)
+				}, 3*time.Second).ShouldNot(HaveOccurred())
+			})
+
 			It("should output metrics", func() {
 				ctx := context.Background()
 				pvcNS := "default"
@@ -475,6 +991,19 @@ func createPVC(ctx context.Context, ns, name, scName, threshold, inodesThreshold
 	Expect(err).NotTo(HaveOccurred())
 }
 
+func createPVCWithVolume(ctx context.Context, ns, name, scName, volumeName, threshold, increase string,
+	request, limit, capacity int64) {
+	createPVC(ctx, ns, name, scName, threshold, "", increase, request, limit, capacity,
+		corev1.PersistentVolumeFilesystem)
+
+	var pvc corev1.PersistentVolumeClaim
+	err := k8sClient.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, &pvc)
+	Expect(err).NotTo(HaveOccurred())
+	pvc.Spec.VolumeName = volumeName
+	err = k8sClient.Update(ctx, &pvc)
+	Expect(err).NotTo(HaveOccurred())
+}
+
 func setMetrics(ns, name string, availableBytes, capacityBytes, availableInodeSize, capacityInodeSize int64) {
 	promClient.setResponce(types.NamespacedName{
 		Namespace: ns,
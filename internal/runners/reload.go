@@ -0,0 +1,37 @@
+package runners
+
+// Reload is a change of the settings of a running pvcAutoresizer.
+type Reload struct {
+	// MetricsClient replaces the metrics client.
+	MetricsClient MetricsClient
+
+	// Options are the new settings. Only the settings referred to in every loop are applied, i.e.
+	// the interval, the namespace filter, the checks before resizing, the defaults of the
+	// annotations, the growth budget, the backoff and the limit warnings. The others, such as the
+	// sinks, require a restart.
+	Options Options
+}
+
+// reload applies the settings. It is called from the loop of pvcAutoresizer, so the settings do
+// not change during a reconciliation.
+func (w *pvcAutoresizer) reload(r Reload) {
+	opts := r.Options
+	w.metricsClient = r.MetricsClient
+	w.opts.Interval = opts.Interval
+	w.opts.MetricsResetSizeThreshold = opts.MetricsResetSizeThreshold
+	w.opts.QuotaBumpAnnotation = opts.QuotaBumpAnnotation
+	w.opts.CheckBackendCapacity = opts.CheckBackendCapacity
+	w.opts.ResizeTimeout = opts.ResizeTimeout
+	w.opts.RecoverExpansionFailure = opts.RecoverExpansionFailure
+	w.opts.OfflineResize = opts.OfflineResize
+	w.opts.OfflineStatsLookback = opts.OfflineStatsLookback
+	w.opts.Namespaces = opts.Namespaces
+	w.opts.Defaults = opts.Defaults
+	w.opts.Budget = opts.Budget
+	w.budget.setOptions(opts.Budget)
+	w.opts.Backoff = opts.Backoff
+	w.failures.setOptions(opts.Backoff)
+	w.opts.LimitWarning = opts.LimitWarning
+	w.limitWarnings.setNotifiers(opts.LimitWarning.Notifiers)
+	w.log.Info("settings reloaded")
+}
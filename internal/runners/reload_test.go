@@ -0,0 +1,38 @@
+package runners
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("test reloading settings", func() {
+	It("should apply the reloadable settings and keep the others", func() {
+		w := NewPVCAutoresizer(nil, nil, nil, logr.Discard(), nil, Options{
+			Interval:     time.Minute,
+			FieldManager: "pvc-autoresizer",
+			Backoff:      BackoffOptions{BaseDelay: time.Second},
+		}).(*pvcAutoresizer)
+
+		mc := &fakeReloadMetricsClient{}
+		w.reload(Reload{MetricsClient: mc, Options: Options{
+			Interval:     10 * time.Second,
+			FieldManager: "changed",
+			Defaults:     ResizeDefaults{Threshold: "20%"},
+			Budget:       BudgetOptions{MaxResizesPerPVCPerDay: 3},
+			Backoff:      BackoffOptions{BaseDelay: time.Minute},
+		}})
+		Expect(w.metricsClient).To(BeIdenticalTo(mc))
+		Expect(w.opts.Interval).To(Equal(10 * time.Second))
+		Expect(w.opts.Defaults.Threshold).To(Equal("20%"))
+		Expect(w.budget.opts.MaxResizesPerPVCPerDay).To(Equal(3))
+		Expect(w.failures.opts.BaseDelay).To(Equal(time.Minute))
+		Expect(w.opts.FieldManager).To(Equal("pvc-autoresizer"))
+	})
+})
+
+type fakeReloadMetricsClient struct {
+	MetricsClient
+}
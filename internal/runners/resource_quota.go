@@ -0,0 +1,156 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// storageClassRequestsStorage returns the name of the quota resource which limits the total
+// storage requests of the PVCs of the StorageClass.
+func storageClassRequestsStorage(scName string) corev1.ResourceName {
+	return corev1.ResourceName(scName + ".storageclass.storage.k8s.io/" + string(corev1.ResourceRequestsStorage))
+}
+
+// storageQuotaRemaining is the remaining storage request of the most restrictive ResourceQuota.
+type storageQuotaRemaining struct {
+	quota     *corev1.ResourceQuota
+	resource  corev1.ResourceName
+	used      resource.Quantity
+	remaining resource.Quantity
+}
+
+// getStorageQuotaRemaining returns the most restrictive remaining storage request among the
+// ResourceQuotas of the PVC's namespace, or nil if no ResourceQuota limits the storage requests.
+// ResourceQuotas with scopes are ignored since they may not match the PVC.
+func (w *pvcAutoresizer) getStorageQuotaRemaining(ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim) (*storageQuotaRemaining, error) {
+	var quotas corev1.ResourceQuotaList
+	err := w.client.List(ctx, &quotas, client.InNamespace(pvc.Namespace))
+	if err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return nil, err
+	}
+
+	resourceNames := []corev1.ResourceName{corev1.ResourceRequestsStorage}
+	if pvc.Spec.StorageClassName != nil {
+		resourceNames = append(resourceNames, storageClassRequestsStorage(*pvc.Spec.StorageClassName))
+	}
+
+	var res *storageQuotaRemaining
+	for i := range quotas.Items {
+		quota := &quotas.Items[i]
+		if len(quota.Spec.Scopes) != 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for _, name := range resourceNames {
+			hard, ok := quota.Status.Hard[name]
+			if !ok {
+				// The quota controller has not calculated the status yet.
+				hard, ok = quota.Spec.Hard[name]
+				if !ok {
+					continue
+				}
+			}
+			used := quota.Status.Used[name]
+			remaining := hard.DeepCopy()
+			remaining.Sub(used)
+			if res == nil || remaining.Cmp(res.remaining) < 0 {
+				res = &storageQuotaRemaining{
+					quota:     quota,
+					resource:  name,
+					used:      used,
+					remaining: remaining,
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// capByResourceQuota caps newReq so that the increase of the storage request fits in the
+// ResourceQuotas of the PVC's namespace. It returns nil if the PVC cannot be expanded at all.
+func (w *pvcAutoresizer) capByResourceQuota(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	capacity, newReq resource.Quantity) (*resource.Quantity, error) {
+	remaining, err := w.getStorageQuotaRemaining(ctx, pvc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource quotas: %w", err)
+	}
+	if remaining == nil {
+		return &newReq, nil
+	}
+
+	curReq := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	increase := newReq.DeepCopy()
+	increase.Sub(curReq)
+	if increase.Cmp(remaining.remaining) <= 0 {
+		return &newReq, nil
+	}
+
+	metrics.ResizerQuotaExceededTotal.Increment(pvc.Name, pvc.Namespace)
+	w.requestQuotaBump(ctx, pvc, remaining, increase)
+
+	// The capped request is rounded down to GiB like the size computed by NextSize.
+	capped := resource.NewQuantity((curReq.Value()+remaining.remaining.Value())>>30<<30, resource.BinarySI)
+	if capped.Cmp(curReq) <= 0 || capped.Cmp(capacity) <= 0 {
+		w.recorder.Eventf(pvc, remaining.quota, corev1.EventTypeWarning, eventReasonQuotaExceeded, "Resize",
+			"PVC volume cannot be resized to %s because %s of ResourceQuota %s is exceeded",
+			newReq.String(), remaining.resource, remaining.quota.Name)
+		return nil, nil
+	}
+	w.recorder.Eventf(pvc, remaining.quota, corev1.EventTypeWarning, eventReasonQuotaExceeded, "Resize",
+		"PVC volume resize is capped from %s to %s by %s of ResourceQuota %s",
+		newReq.String(), capped.String(), remaining.resource, remaining.quota.Name)
+	return capped, nil
+}
+
+// requestQuotaBump sets the QuotaBumpAnnotation to the namespace of the PVC. The value is the
+// amount of the quota resource required to complete the resize. If the annotation already
+// requests a larger amount, it is kept as is.
+func (w *pvcAutoresizer) requestQuotaBump(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	remaining *storageQuotaRemaining, increase resource.Quantity) {
+	if w.opts.QuotaBumpAnnotation == "" {
+		return
+	}
+	log := w.log.WithValues("namespace", pvc.Namespace, "name", pvc.Name)
+
+	required := remaining.used.DeepCopy()
+	required.Add(increase)
+
+	// Namespaces are already cached for the namespace filter.
+	var ns corev1.Namespace
+	if err := w.client.Get(ctx, client.ObjectKey{Name: pvc.Namespace}, &ns); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		log.Error(err, "failed to get namespace to request quota bump")
+		return
+	}
+	if val, ok := ns.Annotations[w.opts.QuotaBumpAnnotation]; ok {
+		if q, err := resource.ParseQuantity(val); err == nil && q.Cmp(required) >= 0 {
+			return
+		}
+	}
+
+	patch := client.MergeFrom(ns.DeepCopy())
+	if ns.Annotations == nil {
+		ns.Annotations = make(map[string]string)
+	}
+	ns.Annotations[w.opts.QuotaBumpAnnotation] = required.String()
+	if err := w.client.Patch(ctx, &ns, patch, w.patchOptions()...); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		log.Error(err, "failed to request quota bump")
+		return
+	}
+	log.Info("requested quota bump", "quota", remaining.quota.Name, "resource", remaining.resource,
+		"required", required.String())
+}
+
+// isQuotaExceededError returns true if the API server rejected the request due to ResourceQuota.
+func isQuotaExceededError(err error) bool {
+	return apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
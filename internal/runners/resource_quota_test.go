@@ -0,0 +1,53 @@
+package runners
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("test capByResourceQuota", func() {
+	It("should round the capped request down to GiB", func() {
+		ctx := context.Background()
+		quota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "quota"},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("11776Mi")},
+				Used: corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("10Gi")},
+			},
+		}
+		w := &pvcAutoresizer{
+			client:   fake.NewClientBuilder().WithObjects(quota).Build(),
+			log:      logr.Discard(),
+			recorder: events.NewFakeRecorder(10),
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pvc1"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				},
+			},
+		}
+
+		// The remaining 1.5Gi is rounded down to 1Gi.
+		newReq, err := w.capByResourceQuota(ctx, pvc, resource.MustParse("10Gi"), resource.MustParse("15Gi"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newReq).NotTo(BeNil())
+		Expect(newReq.Value()).To(Equal(int64(11 << 30)))
+
+		// The remaining 512Mi is rounded down to the current request.
+		quota.Status.Used[corev1.ResourceRequestsStorage] = resource.MustParse("11Gi")
+		Expect(w.client.Update(ctx, quota)).To(Succeed())
+		newReq, err = w.capByResourceQuota(ctx, pvc, resource.MustParse("10Gi"), resource.MustParse("15Gi"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newReq).To(BeNil())
+	})
+})
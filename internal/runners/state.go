@@ -0,0 +1,161 @@
+package runners
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PVCState is the state of a PVC targeted by the resizer.
+type PVCState struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	StorageClass string `json:"storageClass"`
+
+	// VolumeStats is the volume stats used in the last evaluation.
+	VolumeStats *VolumeStats `json:"volumeStats,omitempty"`
+
+	// LastDecision is the decision of the last evaluation. Its action is the next planned action
+	// unless the PVC or its usage changes.
+	LastDecision *Decision `json:"lastDecision,omitempty"`
+
+	// LastError is the error of the last failed resize.
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+
+	// ConsecutiveFailures is the number of the consecutive failures of the resize.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	// LastSeen is the time when the PVC was last targeted.
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// StateStore keeps the states of the PVCs targeted by the resizer and serves them in JSON over
+// HTTP, optionally filtered by the "namespace" and "name" query parameters.
+type StateStore struct {
+	mu     sync.Mutex
+	states map[types.NamespacedName]*PVCState
+}
+
+// NewStateStore returns an empty StateStore.
+func NewStateStore() *StateStore {
+	return &StateStore{states: make(map[types.NamespacedName]*PVCState)}
+}
+
+func (s *StateStore) get(key types.NamespacedName) *PVCState {
+	st, ok := s.states[key]
+	if !ok {
+		st = &PVCState{Namespace: key.Namespace, Name: key.Name}
+		s.states[key] = st
+	}
+	return st
+}
+
+// observe records that the PVC is targeted, with its volume stats if found.
+func (s *StateStore) observe(pvc *corev1.PersistentVolumeClaim, vs *VolumeStats) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.get(types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name})
+	if pvc.Spec.StorageClassName != nil {
+		st.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if vs != nil {
+		copied := *vs
+		st.VolumeStats = &copied
+	} else {
+		st.VolumeStats = nil
+	}
+	st.LastSeen = time.Now().UTC()
+}
+
+// recordFailure records the error of the resize of the PVC.
+func (s *StateStore) recordFailure(pvc *corev1.PersistentVolumeClaim, err error, count int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.get(types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name})
+	now := time.Now().UTC()
+	st.LastError = err.Error()
+	st.LastErrorTime = &now
+	st.ConsecutiveFailures = count
+}
+
+// recordSuccess clears the consecutive failures of the PVC. The last error is kept.
+func (s *StateStore) recordSuccess(pvc *corev1.PersistentVolumeClaim) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}).ConsecutiveFailures = 0
+}
+
+// prune drops the states of the PVCs not in targets.
+func (s *StateStore) prune(targets map[types.NamespacedName]struct{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.states {
+		if _, ok := targets[key]; !ok {
+			delete(s.states, key)
+		}
+	}
+}
+
+// recordDecision records the decision of the last evaluation of the PVC.
+func (s *StateStore) recordDecision(d *Decision) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *d
+	s.get(types.NamespacedName{Namespace: d.Namespace, Name: d.Name}).LastDecision = &copied
+}
+
+// List returns the states sorted by the namespace and the name.
+func (s *StateStore) List() []PVCState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]PVCState, 0, len(s.states))
+	for _, st := range s.states {
+		states = append(states, *st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Namespace != states[j].Namespace {
+			return states[i].Namespace < states[j].Namespace
+		}
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+func (s *StateStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ns := r.URL.Query().Get("namespace")
+	name := r.URL.Query().Get("name")
+	states := make([]PVCState, 0)
+	for _, st := range s.List() {
+		if (ns != "" && st.Namespace != ns) || (name != "" && st.Name != name) {
+			continue
+		}
+		states = append(states, st)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(states)
+}
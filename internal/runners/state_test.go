@@ -0,0 +1,54 @@
+package runners
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("test state store", func() {
+	It("should keep the states of the targeted PVCs", func() {
+		s := NewStateStore()
+		pvc := decisionTestPVC("10Gi", "100Gi")
+		vs := decisionTestStats(10<<30, 1<<30)
+
+		s.observe(pvc, vs)
+		s.recordDecision(EvaluateResize(pvc, vs))
+		s.recordFailure(pvc, errors.New("update failed"), 2)
+
+		other := decisionTestPVC("10Gi", "100Gi")
+		other.Name = "other-pvc"
+		s.observe(other, nil)
+
+		states := s.List()
+		Expect(states).To(HaveLen(2))
+		Expect(states[0].Name).To(Equal("other-pvc"))
+		Expect(states[0].VolumeStats).To(BeNil())
+		Expect(states[1].Name).To(Equal("test-pvc"))
+		Expect(states[1].StorageClass).To(Equal("test-sc"))
+		Expect(*states[1].VolumeStats).To(Equal(*vs))
+		Expect(states[1].LastDecision.Action).To(Equal(DecisionActionResize))
+		Expect(states[1].LastError).To(Equal("update failed"))
+		Expect(states[1].ConsecutiveFailures).To(Equal(2))
+
+		s.recordSuccess(pvc)
+		Expect(s.List()[1].ConsecutiveFailures).To(Equal(0))
+		Expect(s.List()[1].LastError).To(Equal("update failed"))
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pvcs?namespace=default&name=test-pvc", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var served []PVCState
+		Expect(json.Unmarshal(rec.Body.Bytes(), &served)).To(Succeed())
+		Expect(served).To(HaveLen(1))
+		Expect(served[0].LastDecision.NewSize.String()).To(Equal("20Gi"))
+
+		s.prune(map[types.NamespacedName]struct{}{{Namespace: "default", Name: "other-pvc"}: {}})
+		Expect(s.List()).To(HaveLen(1))
+	})
+})
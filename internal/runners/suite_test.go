@@ -38,6 +38,8 @@ var promClient = prometheusClientMock{}
 
 var scName string = "test-storageclass"
 var provName string = "test-provisioner"
+var quotaBumpAnnotation string = "example.com/requested-storage-quota"
+var fieldManager string = "pvc-autoresizer"
 
 func TestRunners(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -81,16 +83,30 @@ var _ = BeforeSuite(func() {
 	err = SetupIndexer(mgr, noCheck)
 	Expect(err).ToNot(HaveOccurred())
 
-	pvcAutoresizer := NewPVCAutoresizer(&promClient, mgr.GetClient(),
-		logf.Log.WithName("pvc-autoresizer"),
-		1*time.Second, mgr.GetEventRecorder("pvc-autoresizer"), 100*1024*1024)
+	pvcAutoresizer := NewPVCAutoresizer(&promClient, mgr.GetClient(), mgr.GetAPIReader(),
+		logf.Log.WithName("pvc-autoresizer"), mgr.GetEventRecorder("pvc-autoresizer"),
+		Options{
+			Interval:                  1 * time.Second,
+			MetricsResetSizeThreshold: 100 * 1024 * 1024,
+			QuotaBumpAnnotation:       quotaBumpAnnotation,
+			CheckBackendCapacity:      true,
+			RecoverExpansionFailure:   true,
+			OfflineResize:             true,
+			OfflineStatsLookback:      time.Hour,
+			FieldManager:              fieldManager,
+			// The namespaces opt out by the annotation only when they are filtered.
+			Namespaces: NamespaceFilter{Exclude: []string{"kube-system"}},
+		})
 	err = mgr.Add(pvcAutoresizer)
 	Expect(err).ToNot(HaveOccurred())
 
 	// Add pvcAutoresizer with FakeClientWrapper for metrics tests
-	pvcAutoresizer2 := NewPVCAutoresizer(&promClient, NewFakeClientWrapper(mgr.GetClient()),
-		logf.Log.WithName("pvc-autoresizer2"),
-		1*time.Second, mgr.GetEventRecorder("pvc-autoresizer2"), 100*1024*1024)
+	pvcAutoresizer2 := NewPVCAutoresizer(&promClient, NewFakeClientWrapper(mgr.GetClient()), mgr.GetAPIReader(),
+		logf.Log.WithName("pvc-autoresizer2"), mgr.GetEventRecorder("pvc-autoresizer2"),
+		Options{
+			Interval:                  1 * time.Second,
+			MetricsResetSizeThreshold: 100 * 1024 * 1024,
+		})
 	err = mgr.Add(pvcAutoresizer2)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,35 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/topolvm/pvc-autoresizer/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CheckVolumeExpansion returns the reason why the volumes of the StorageClass cannot be expanded,
+// or an empty string if they can. The CSI driver is not checked since CSIDriver objects expose no
+// capability of volume expansion.
+func CheckVolumeExpansion(sc *storagev1.StorageClass) string {
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return fmt.Sprintf("StorageClass %s does not allow volume expansion", sc.Name)
+	}
+	return ""
+}
+
+// checkVolumeExpansion returns the reason why the volume of the PVC cannot be expanded, or an
+// empty string if it can.
+func (w *pvcAutoresizer) checkVolumeExpansion(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	if pvc.Spec.StorageClassName == nil {
+		return "", nil
+	}
+	var sc storagev1.StorageClass
+	if err := w.client.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, &sc); err != nil {
+		metrics.KubernetesClientFailTotal.Increment()
+		return "", err
+	}
+	return CheckVolumeExpansion(&sc), nil
+}
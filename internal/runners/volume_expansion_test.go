@@ -0,0 +1,21 @@
+package runners
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("test volume expansion checks", func() {
+	It("should reject StorageClasses not allowing volume expansion", func() {
+		allowed, denied := true, false
+		meta := metav1.ObjectMeta{Name: "test-sc"}
+		Expect(CheckVolumeExpansion(&storagev1.StorageClass{ObjectMeta: meta})).
+			To(ContainSubstring("does not allow volume expansion"))
+		Expect(CheckVolumeExpansion(&storagev1.StorageClass{ObjectMeta: meta, AllowVolumeExpansion: &denied})).
+			To(ContainSubstring("does not allow volume expansion"))
+		Expect(CheckVolumeExpansion(&storagev1.StorageClass{ObjectMeta: meta, AllowVolumeExpansion: &allowed})).
+			To(BeEmpty())
+	})
+})
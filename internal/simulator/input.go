@@ -0,0 +1,144 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Sample is a usage of the volume at a time. The inodes are zero if unknown.
+type Sample struct {
+	Time           time.Time
+	UsedBytes      int64
+	UsedInodes     int64
+	CapacityInodes int64
+}
+
+// Formats of the usage time series.
+const (
+	FormatCSV        = "csv"
+	FormatPrometheus = "prometheus"
+)
+
+// ReadSamples reads the usage time series in the format and returns the samples sorted by time.
+func ReadSamples(r io.Reader, format string) ([]Sample, error) {
+	var samples []Sample
+	var err error
+	switch format {
+	case FormatCSV:
+		samples, err = readCSV(r)
+	case FormatPrometheus:
+		samples, err = readPrometheus(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q: must be %s or %s", format, FormatCSV, FormatPrometheus)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("no samples found")
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be in RFC 3339 or Unix seconds: %s", s)
+	}
+	return time.UnixMilli(int64(sec * 1000)).UTC(), nil
+}
+
+// readCSV reads the lines of "time,used_bytes[,used_inodes,capacity_inodes]". The time is in
+// RFC 3339 or Unix seconds, and the used bytes can be a quantity such as "5Gi". A header line,
+// empty lines and lines beginning with "#" are skipped. Additional columns are ignored.
+func readCSV(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	header := true
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected time and used bytes: %s", lineNo, line)
+		}
+		t, err := parseTime(strings.TrimSpace(fields[0]))
+		if err != nil && header {
+			header = false
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		header = false
+		used, err := resource.ParseQuantity(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid used bytes %q: %w", lineNo, fields[1], err)
+		}
+		sample := Sample{Time: t, UsedBytes: used.Value()}
+		if len(fields) >= 4 {
+			sample.UsedInodes, err = strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid used inodes %q: %w", lineNo, fields[2], err)
+			}
+			sample.CapacityInodes, err = strconv.ParseInt(strings.TrimSpace(fields[3]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid capacity inodes %q: %w", lineNo, fields[3], err)
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// readPrometheus reads the result of a range query of Prometheus, either the whole response of
+// the HTTP API or only the matrix. It must contain exactly one series of the used bytes, so the
+// inodes are unknown.
+func readPrometheus(r io.Reader) ([]Sample, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var matrix model.Matrix
+	var resp struct {
+		Status string `json:"status"`
+		Data   *struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err == nil && resp.Data != nil {
+		if resp.Data.ResultType != model.ValMatrix.String() {
+			return nil, fmt.Errorf("result type must be %s: %s", model.ValMatrix, resp.Data.ResultType)
+		}
+		data = resp.Data.Result
+	}
+	if err := json.Unmarshal(data, &matrix); err != nil {
+		return nil, fmt.Errorf("failed to read the range query result: %w", err)
+	}
+	if len(matrix) != 1 {
+		return nil, fmt.Errorf("the range query result must contain exactly one series, but contains %d; "+
+			"filter the query to a PVC", len(matrix))
+	}
+
+	samples := make([]Sample, 0, len(matrix[0].Values))
+	for _, v := range matrix[0].Values {
+		samples = append(samples, Sample{Time: v.Timestamp.Time().UTC(), UsedBytes: int64(v.Value)})
+	}
+	return samples, nil
+}
@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+
+	pvcautoresizer "github.com/topolvm/pvc-autoresizer"
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Policy is the resize policy to simulate. The values are the same as the annotations of PVCs.
+type Policy struct {
+	// InitialSize is the capacity of the PVC at the first sample.
+	InitialSize resource.Quantity
+
+	// StorageLimit is the value of the resize.topolvm.io/storage_limit annotation.
+	StorageLimit string
+
+	// Threshold is the value of the resize.topolvm.io/threshold annotation. Empty means the default.
+	Threshold string
+
+	// InodesThreshold is the value of the resize.topolvm.io/inodes-threshold annotation. Empty means
+	// the default. It is evaluated only for the samples with inodes.
+	InodesThreshold string
+
+	// Increase is the value of the resize.topolvm.io/increase annotation. Empty means the default.
+	Increase string
+
+	// Defaults are the defaults of the annotations, which should be the same as the controller.
+	Defaults runners.ResizeDefaults
+
+	// ExpansionDelay is the time until the requested size is reflected to the capacity of the volume.
+	// Zero reflects it at the next sample.
+	ExpansionDelay time.Duration
+}
+
+// EventType is the type of an event in the timeline of a simulation.
+type EventType string
+
+// Types of the events.
+const (
+	// EventResize is a resize requested by the controller.
+	EventResize EventType = "Resize"
+
+	// EventLimitReached is the first evaluation which needed a resize but reached the storage limit.
+	EventLimitReached EventType = "LimitReached"
+
+	// EventFull is the first sample where the volume is full.
+	EventFull EventType = "Full"
+)
+
+// Event is an event in the timeline of a simulation.
+type Event struct {
+	Time           time.Time          `json:"time"`
+	Type           EventType          `json:"type"`
+	UsedBytes      int64              `json:"usedBytes"`
+	CapacityBytes  int64              `json:"capacityBytes"`
+	UsedInodes     int64              `json:"usedInodes,omitempty"`
+	CapacityInodes int64              `json:"capacityInodes,omitempty"`
+	NewSize        *resource.Quantity `json:"newSize,omitempty"`
+}
+
+// Period is a period of time.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Result is the result of a simulation.
+type Result struct {
+	Timeline      []Event           `json:"timeline"`
+	Expansions    int               `json:"expansions"`
+	FinalCapacity resource.Quantity `json:"finalCapacity"`
+
+	// PeakOverProvisioningBytes is the largest free bytes of the volume, and
+	// PeakOverProvisioningRatio is the ratio of them to the capacity at that time.
+	PeakOverProvisioningBytes int64     `json:"peakOverProvisioningBytes"`
+	PeakOverProvisioningRatio float64   `json:"peakOverProvisioningRatio"`
+	PeakOverProvisioningTime  time.Time `json:"peakOverProvisioningTime"`
+
+	// FullPeriods are the periods when the volume would have been full, i.e. the used bytes
+	// reached the capacity. The end is the last sample of the period.
+	FullPeriods []Period `json:"fullPeriods"`
+}
+
+func (p *Policy) pvc(capacity resource.Quantity) *corev1.PersistentVolumeClaim {
+	annotations := map[string]string{
+		pvcautoresizer.StorageLimitAnnotation: p.StorageLimit,
+	}
+	if p.Threshold != "" {
+		annotations[pvcautoresizer.ResizeThresholdAnnotation] = p.Threshold
+	}
+	if p.InodesThreshold != "" {
+		annotations[pvcautoresizer.ResizeInodesThresholdAnnotation] = p.InodesThreshold
+	}
+	if p.Increase != "" {
+		annotations[pvcautoresizer.ResizeIncreaseAnnotation] = p.Increase
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "simulated", Annotations: annotations},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: capacity},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: capacity},
+		},
+	}
+}
+
+// pendingExpansion is an expansion requested but not reflected to the capacity yet.
+type pendingExpansion struct {
+	size resource.Quantity
+	at   time.Time
+}
+
+// Simulate replays the samples through the same evaluation as the controller and returns the
+// result. The capacity of the filesystem is regarded as the capacity of the PVC. The inodes of
+// filesystems such as ext4 and XFS grow with the size, so the capacity of the inodes is scaled by
+// the capacity of the PVC against the initial size. Checks depending on the cluster, such as
+// ResourceQuotas and growth budgets, are not simulated.
+func Simulate(samples []Sample, policy Policy) (*Result, error) {
+	if policy.InitialSize.IsZero() {
+		return nil, fmt.Errorf("initial size must be positive")
+	}
+	pvc := policy.pvc(policy.InitialSize)
+	if ok, err := runners.IsTargetPVC(pvc); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("storage limit must be set")
+	}
+
+	res := &Result{Timeline: []Event{}, FullPeriods: []Period{}}
+	capacity := policy.InitialSize
+	var pending *pendingExpansion
+	var full *Period
+	limitReached := false
+
+	for _, s := range samples {
+		// Like the controller, do not resize again until the previous expansion completes.
+		if pending != nil && !s.Time.Before(pending.at) {
+			capacity = pending.size
+			pending = nil
+		}
+		capBytes := capacity.Value()
+		capInodes := int64(float64(s.CapacityInodes) * float64(capBytes) / float64(policy.InitialSize.Value()))
+
+		if s.UsedBytes >= capBytes {
+			if full == nil {
+				res.Timeline = append(res.Timeline, Event{
+					Time: s.Time, Type: EventFull, UsedBytes: s.UsedBytes, CapacityBytes: capBytes,
+				})
+				res.FullPeriods = append(res.FullPeriods, Period{Start: s.Time})
+				full = &res.FullPeriods[len(res.FullPeriods)-1]
+			}
+			full.End = s.Time
+		} else {
+			full = nil
+		}
+		if free := capBytes - s.UsedBytes; free > res.PeakOverProvisioningBytes {
+			res.PeakOverProvisioningBytes = free
+			res.PeakOverProvisioningRatio = float64(free) / float64(capBytes)
+			res.PeakOverProvisioningTime = s.Time
+		}
+		if pending != nil {
+			continue
+		}
+
+		pvc.Status.Capacity[corev1.ResourceStorage] = capacity
+		d := runners.EvaluateResizeWithDefaults(pvc, &runners.VolumeStats{
+			CapacityBytes:      capBytes,
+			AvailableBytes:     max(capBytes-s.UsedBytes, 0),
+			CapacityInodeSize:  capInodes,
+			AvailableInodeSize: max(capInodes-s.UsedInodes, 0),
+		}, policy.Defaults)
+		switch {
+		case d.Action == runners.DecisionActionResize:
+			res.Expansions++
+			res.Timeline = append(res.Timeline, Event{
+				Time: s.Time, Type: EventResize, UsedBytes: s.UsedBytes, CapacityBytes: capBytes,
+				UsedInodes: s.UsedInodes, CapacityInodes: capInodes, NewSize: d.NewSize,
+			})
+			pending = &pendingExpansion{size: *d.NewSize, at: s.Time.Add(policy.ExpansionDelay)}
+			if policy.ExpansionDelay == 0 {
+				pending.at = s.Time.Add(time.Nanosecond)
+			}
+		case d.Reason == runners.ReasonLimitReached:
+			if !limitReached && (d.AvailableBytes < d.ThresholdBytes || d.AvailableInodes < d.InodesThreshold) {
+				limitReached = true
+				res.Timeline = append(res.Timeline, Event{
+					Time: s.Time, Type: EventLimitReached, UsedBytes: s.UsedBytes, CapacityBytes: capBytes,
+					UsedInodes: s.UsedInodes, CapacityInodes: capInodes,
+				})
+			}
+		case d.Action == runners.DecisionActionError || d.Reason != runners.ReasonBelowThreshold:
+			return nil, fmt.Errorf("invalid policy (%s): %s", d.Reason, d.Message)
+		}
+	}
+
+	if pending != nil {
+		capacity = pending.size
+	}
+	res.FinalCapacity = capacity
+	return res, nil
+}
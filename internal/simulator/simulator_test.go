@@ -0,0 +1,238 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/topolvm/pvc-autoresizer/internal/runners"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// linearSamples returns hourly samples from the used bytes increased by the step.
+func linearSamples(n int, start, step int64) []Sample {
+	samples := make([]Sample, 0, n)
+	for i := 0; i < n; i++ {
+		samples = append(samples, Sample{
+			Time:      testStart.Add(time.Duration(i) * time.Hour),
+			UsedBytes: start + int64(i)*step,
+		})
+	}
+	return samples
+}
+
+func TestReadCSV(t *testing.T) {
+	input := `# usage of data-0
+time,used_bytes
+2024-01-01T01:00:00Z,2Gi
+1704067200,1073741824
+`
+	samples, err := ReadSamples(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatalf("ReadSamples returned error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("number of samples is not 2: %+v", samples)
+	}
+	if !samples[0].Time.Equal(testStart) || samples[0].UsedBytes != 1<<30 {
+		t.Errorf("unexpected first sample: %+v", samples[0])
+	}
+	if !samples[1].Time.Equal(testStart.Add(time.Hour)) || samples[1].UsedBytes != 2<<30 {
+		t.Errorf("unexpected second sample: %+v", samples[1])
+	}
+
+	_, err = ReadSamples(strings.NewReader("time,used\n2024-01-01T00:00:00Z,1Gi\ninvalid,1Gi\n"), FormatCSV)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("invalid line is not reported: %v", err)
+	}
+}
+
+func TestReadPrometheus(t *testing.T) {
+	series := `[{"metric":{"persistentvolumeclaim":"data-0"},"values":[[1704067200,"1073741824"],[1704070800,"2147483648"]]}]`
+	for _, input := range []string{
+		`{"status":"success","data":{"resultType":"matrix","result":` + series + `}}`,
+		series,
+	} {
+		samples, err := ReadSamples(strings.NewReader(input), FormatPrometheus)
+		if err != nil {
+			t.Fatalf("ReadSamples returned error: %v", err)
+		}
+		if len(samples) != 2 || !samples[1].Time.Equal(testStart.Add(time.Hour)) || samples[1].UsedBytes != 2<<30 {
+			t.Errorf("unexpected samples: %+v", samples)
+		}
+	}
+
+	_, err := ReadSamples(strings.NewReader(`[{"metric":{},"values":[]},{"metric":{},"values":[]}]`), FormatPrometheus)
+	if err == nil {
+		t.Error("multiple series are accepted")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// 10Gi volume filled by 1Gi an hour from 5Gi.
+	res, err := Simulate(linearSamples(10, 5<<30, 1<<30), Policy{
+		InitialSize:  resource.MustParse("10Gi"),
+		StorageLimit: "12Gi",
+		Threshold:    "20%",
+		Increase:     "1Gi",
+	})
+	if err != nil {
+		t.Fatalf("Simulate returned error: %v", err)
+	}
+
+	expected := []struct {
+		hour    int
+		typ     EventType
+		newSize string
+	}{
+		// 8Gi used: 2Gi available is not less than 2Gi threshold, so resized at 9Gi.
+		{4, EventResize, "11Gi"},
+		{5, EventResize, "12Gi"},
+		{6, EventLimitReached, ""},
+		{7, EventFull, ""},
+	}
+	if len(res.Timeline) != len(expected) {
+		t.Fatalf("unexpected timeline: %+v", res.Timeline)
+	}
+	for i, e := range expected {
+		ev := res.Timeline[i]
+		if !ev.Time.Equal(testStart.Add(time.Duration(e.hour)*time.Hour)) || ev.Type != e.typ {
+			t.Errorf("event %d is not %s at %d: %+v", i, e.typ, e.hour, ev)
+		}
+		if e.newSize != "" && ev.NewSize.String() != e.newSize {
+			t.Errorf("new size of event %d is not %s: %s", i, e.newSize, ev.NewSize.String())
+		}
+	}
+	if res.Expansions != 2 || res.FinalCapacity.String() != "12Gi" {
+		t.Errorf("unexpected expansions or final capacity: %d, %s", res.Expansions, res.FinalCapacity.String())
+	}
+	if len(res.FullPeriods) != 1 || !res.FullPeriods[0].Start.Equal(testStart.Add(7*time.Hour)) ||
+		!res.FullPeriods[0].End.Equal(testStart.Add(9*time.Hour)) {
+		t.Errorf("unexpected full periods: %+v", res.FullPeriods)
+	}
+	if res.PeakOverProvisioningBytes != 5<<30 || res.PeakOverProvisioningRatio != 0.5 ||
+		!res.PeakOverProvisioningTime.Equal(testStart) {
+		t.Errorf("unexpected peak over-provisioning: %d, %f, %s",
+			res.PeakOverProvisioningBytes, res.PeakOverProvisioningRatio, res.PeakOverProvisioningTime)
+	}
+}
+
+func TestSimulateExpansionDelay(t *testing.T) {
+	// The resize at 1h is not requested since the first expansion takes 90 minutes.
+	res, err := Simulate(linearSamples(6, 9<<30, 1<<29), Policy{
+		InitialSize:    resource.MustParse("10Gi"),
+		StorageLimit:   "100Gi",
+		Threshold:      "20%",
+		Increase:       "1Gi",
+		ExpansionDelay: 90 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Simulate returned error: %v", err)
+	}
+	if res.Expansions != 3 || len(res.Timeline) != 3 ||
+		!res.Timeline[1].Time.Equal(testStart.Add(2*time.Hour)) || res.Timeline[1].NewSize.String() != "12Gi" {
+		t.Errorf("unexpected timeline: %+v", res.Timeline)
+	}
+}
+
+func TestSimulateDefaults(t *testing.T) {
+	// The defaults are used only for the policy not given.
+	for _, tc := range []struct {
+		increase string
+		expected string
+	}{
+		{increase: "", expected: "15Gi"},
+		{increase: "1Gi", expected: "11Gi"},
+	} {
+		res, err := Simulate(linearSamples(1, 9<<30, 0), Policy{
+			InitialSize:  resource.MustParse("10Gi"),
+			StorageLimit: "100Gi",
+			Increase:     tc.increase,
+			Defaults:     runners.ResizeDefaults{Threshold: "20%", Increase: "5Gi"},
+		})
+		if err != nil {
+			t.Fatalf("Simulate returned error: %v", err)
+		}
+		if res.Expansions != 1 || res.Timeline[0].NewSize.String() != tc.expected {
+			t.Errorf("increase %q: unexpected timeline: %+v", tc.increase, res.Timeline)
+		}
+	}
+}
+
+func TestSimulateInvalidPolicy(t *testing.T) {
+	samples := linearSamples(2, 1<<30, 0)
+	for _, policy := range []Policy{
+		{InitialSize: resource.MustParse("10Gi")},
+		{InitialSize: resource.MustParse("10Gi"), StorageLimit: "100Gi", Threshold: "200%"},
+		{StorageLimit: "100Gi"},
+	} {
+		if _, err := Simulate(samples, policy); err == nil {
+			t.Errorf("invalid policy is accepted: %+v", policy)
+		}
+	}
+}
+
+func TestSimulateInodes(t *testing.T) {
+	input := `time,used_bytes,used_inodes,capacity_inodes
+2024-01-01T00:00:00Z,1Gi,800,1000
+2024-01-01T01:00:00Z,1Gi,950,1000
+2024-01-01T02:00:00Z,1Gi,1050,1000
+2024-01-01T03:00:00Z,1Gi,1300,1000
+`
+	samples, err := ReadSamples(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatalf("ReadSamples returned error: %v", err)
+	}
+	if samples[1].UsedInodes != 950 || samples[1].CapacityInodes != 1000 {
+		t.Fatalf("unexpected sample: %+v", samples[1])
+	}
+
+	// 10Gi volume with 1000 inodes. The used bytes are below the threshold all the time.
+	res, err := Simulate(samples, Policy{
+		InitialSize:     resource.MustParse("10Gi"),
+		StorageLimit:    "12Gi",
+		InodesThreshold: "10%",
+		Increase:        "1Gi",
+	})
+	if err != nil {
+		t.Fatalf("Simulate returned error: %v", err)
+	}
+
+	expected := []struct {
+		hour           int
+		typ            EventType
+		capacityInodes int64
+	}{
+		// 50 inodes available are less than 100 inodes threshold.
+		{1, EventResize, 1000},
+		// The inodes grow to 1100 with the capacity of 11Gi, and 50 inodes available are less than 110.
+		{2, EventResize, 1100},
+		// The inodes are 1200 with the capacity of 12Gi and used up.
+		{3, EventLimitReached, 1200},
+	}
+	if len(res.Timeline) != len(expected) {
+		t.Fatalf("unexpected timeline: %+v", res.Timeline)
+	}
+	for i, e := range expected {
+		ev := res.Timeline[i]
+		if !ev.Time.Equal(testStart.Add(time.Duration(e.hour)*time.Hour)) || ev.Type != e.typ ||
+			ev.CapacityInodes != e.capacityInodes {
+			t.Errorf("event %d is not %s at %d with %d inodes: %+v", i, e.typ, e.hour, e.capacityInodes, ev)
+		}
+	}
+
+	// The inodes are not evaluated without them.
+	res, err = Simulate(linearSamples(4, 1<<30, 0), Policy{
+		InitialSize:     resource.MustParse("10Gi"),
+		StorageLimit:    "12Gi",
+		InodesThreshold: "10%",
+	})
+	if err != nil {
+		t.Fatalf("Simulate returned error: %v", err)
+	}
+	if res.Expansions != 0 {
+		t.Errorf("resized without inodes: %+v", res.Timeline)
+	}
+}
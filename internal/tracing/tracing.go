@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracerName is the name of the tracer of pvc-autoresizer.
+	TracerName = "github.com/topolvm/pvc-autoresizer"
+
+	serviceName = "pvc-autoresizer"
+)
+
+// Attribute keys of the spans.
+const (
+	NamespaceKey     = attribute.Key("k8s.namespace.name")
+	PVCNameKey       = attribute.Key("k8s.persistentvolumeclaim.name")
+	NodeNameKey      = attribute.Key("k8s.node.name")
+	StorageClassKey  = attribute.Key("k8s.storageclass.name")
+	MetricsSourceKey = attribute.Key("pvcautoresizer.metrics.source")
+	MetricsQueryKey  = attribute.Key("pvcautoresizer.metrics.query")
+	ResizeFromKey    = attribute.Key("pvcautoresizer.resize.from_bytes")
+	ResizeToKey      = attribute.Key("pvcautoresizer.resize.to_bytes")
+	TargetPVCsKey    = attribute.Key("pvcautoresizer.target_pvcs")
+)
+
+// Options holds the settings of the tracing.
+type Options struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint, e.g. http://otel-collector:4318/v1/traces.
+	// The connection is insecure if the scheme is http.
+	Endpoint string
+
+	// SampleRatio is the ratio of the traces to be sampled.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider which exports the spans via OTLP. It returns a
+// function to flush the spans and shut down the provider.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return nil, errors.New("the OTLP endpoint is not specified")
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, errors.New("the sample ratio must be between 0 and 1")
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span with the tracer of pvc-autoresizer. The spans are not recorded unless Setup
+// has been called.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// PVCAttributes returns the attributes identifying a PVC.
+func PVCAttributes(namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{NamespaceKey.String(namespace), PVCNameKey.String(name)}
+}
+
+// End records the error to the span if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process OTLP/HTTP collector which keeps the received spans.
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			c.spans = append(c.spans, ss.GetSpans()...)
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	data, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	_, _ = w.Write(data)
+}
+
+func TestSetupInvalid(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{SampleRatio: 1}); err == nil {
+		t.Fatalf("expected error for empty endpoint")
+	}
+	if _, err := Setup(context.Background(), Options{Endpoint: "http://localhost:4318/v1/traces", SampleRatio: 2}); err == nil {
+		t.Fatalf("expected error for invalid sample ratio")
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{}
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	orig := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(orig)
+
+	shutdown, err := Setup(context.Background(), Options{Endpoint: ts.URL + "/v1/traces", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+
+	ctx, parent := Start(context.Background(), "reconcile")
+	_, child := Start(ctx, "resize", PVCAttributes("ns-a", "pvc-a")...)
+	End(child, nil)
+	End(parent, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown returned error: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.spans) != 2 {
+		t.Fatalf("span count is not %d: %d", 2, len(c.spans))
+	}
+	var resize, reconcile *tracepb.Span
+	for _, span := range c.spans {
+		switch span.GetName() {
+		case "resize":
+			resize = span
+		case "reconcile":
+			reconcile = span
+		}
+	}
+	if resize == nil || reconcile == nil {
+		t.Fatalf("spans are not exported: %v", c.spans)
+	}
+	if string(resize.GetParentSpanId()) != string(reconcile.GetSpanId()) {
+		t.Fatalf("resize span is not a child of reconcile span")
+	}
+	attrs := make(map[string]string)
+	for _, kv := range resize.GetAttributes() {
+		attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	if attrs[string(NamespaceKey)] != "ns-a" || attrs[string(PVCNameKey)] != "pvc-a" {
+		t.Fatalf("PVC attributes are not exported: %v", attrs)
+	}
+}
@@ -443,6 +443,41 @@ var _ = Describe("pvc-autoresizer", func() {
 		By("checking the PVC size is not mutated")
 		checkDoesNotResize(pvcName, "1Gi")
 	})
+
+	It("should reject invalid updates of the autoresize settings", func() {
+		pvcName := "validate-update-pvc"
+		sc := "topolvm-provisioner-annotated"
+		mode := string(corev1.PersistentVolumeFilesystem)
+		request := "2Gi"
+		threshold := "50%"
+		increase := "1Gi"
+		storageLimit := "10Gi"
+		initialResizeGroupByAnnotation := "test-group"
+		groupXLabel := map[string]string{
+			initialResizeGroupByAnnotation: "group-x",
+		}
+		resources = createPodPVC(resources, pvcName, sc, mode, pvcName, request,
+			threshold, "", increase, storageLimit, initialResizeGroupByAnnotation, groupXLabel)
+		checkDiskResize(pvcName, request, true)
+
+		By("lowering the storage limit below the current capacity")
+		stdout, stderr, err := kubectl("-n", testNamespace, "annotate", "--overwrite", "pvc", pvcName,
+			"resize.topolvm.io/storage_limit=1Gi")
+		Expect(err).Should(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
+
+		By("removing the value of the group label")
+		stdout, stderr, err = kubectl("-n", testNamespace, "label", "--overwrite", "pvc", pvcName,
+			initialResizeGroupByAnnotation+"=")
+		Expect(err).Should(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
+
+		By("raising the storage limit and changing the group")
+		stdout, stderr, err = kubectl("-n", testNamespace, "annotate", "--overwrite", "pvc", pvcName,
+			"resize.topolvm.io/storage_limit=20Gi")
+		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
+		stdout, stderr, err = kubectl("-n", testNamespace, "label", "--overwrite", "pvc", pvcName,
+			initialResizeGroupByAnnotation+"=group-y")
+		Expect(err).ShouldNot(HaveOccurred(), "stdout=%s, stderr=%s", stdout, stderr)
+	})
 })
 
 func buildPodPVCTemplateYAML(ns, pvcName, storageClassName, volumeMode, podName, request, threshold, inodesThreshold,